@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	. "github.com/yuuki0xff/clustertest/cmdutils"
+	"github.com/yuuki0xff/clustertest/config"
+)
+
+func configValidateFn(cmd *cobra.Command, args []string) error {
+	files, err := findConfigs(args)
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+
+	vars, err := varsFromFlags(cmd)
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+
+	var count int
+	for _, file := range files {
+		for _, p := range config.ValidateFile(file, vars) {
+			if p.Line > 0 {
+				fmt.Printf("%s:%d: %s\n", p.File, p.Line, p)
+			} else {
+				fmt.Printf("%s: %s\n", p.File, p)
+			}
+			count++
+		}
+	}
+	if count > 0 {
+		// Exit with non-zero status to use this command in CI.
+		err := errors.Errorf("found %d problems", count)
+		ShowError(err)
+		return err
+	}
+	return nil
+}
@@ -7,11 +7,6 @@ import (
 	"os"
 )
 
-func notImplemented(cmd *cobra.Command, args []string) error {
-	// TODO
-	panic("not implemented")
-}
-
 var rootCmd = &cobra.Command{
 	Use:              "clustertest",
 	Short:            "An automated testing system for clustered system",
@@ -50,22 +45,71 @@ var taskListCmd = &cobra.Command{
 var taskCancelCmd = &cobra.Command{
 	Use:   "cancel",
 	Short: "Cancel tasks",
-	RunE:  notImplemented,
+	RunE:  taskCancelFn,
+}
+var taskReleaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "Release the held infrastructure of tasks",
+	RunE:  taskReleaseFn,
 }
 var taskOutputCmd = &cobra.Command{
 	Use:   "output",
 	Short: "Show output data of a task",
 	RunE:  taskOutputFn,
 }
+var taskLogsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Show output of a running task",
+	RunE:  taskLogsFn,
+}
+var taskArtifactsCmd = &cobra.Command{
+	Use:   "artifacts",
+	Short: "List or download files collected from hosts",
+	RunE:  taskArtifactsFn,
+}
 var taskDeleteCmd = &cobra.Command{
 	Use:   "delete",
 	Short: "Delete finished tasks",
-	RunE:  notImplemented,
+	RunE:  taskDeleteFn,
+	// The errors are already shown by taskDeleteFn.
+	SilenceErrors: true,
+	SilenceUsage:  true,
+}
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage config files",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return InvalidArgument
+	},
+}
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check config files and show all problems",
+	RunE:  configValidateFn,
+	// The problems are already shown by configValidateFn.
+	SilenceErrors: true,
+	SilenceUsage:  true,
 }
 
 func init() {
-	rootCmd.AddCommand(taskCmd)
-	taskCmd.AddCommand(taskRunCmd, taskStartCmd, taskWaitCmd, taskListCmd, taskCancelCmd, taskOutputCmd, taskDeleteCmd)
+	rootCmd.AddCommand(taskCmd, configCmd)
+	configCmd.AddCommand(configValidateCmd)
+	taskCmd.AddCommand(taskRunCmd, taskStartCmd, taskWaitCmd, taskListCmd, taskCancelCmd, taskReleaseCmd, taskOutputCmd, taskLogsCmd, taskArtifactsCmd, taskDeleteCmd)
+	addTaskOptionFlags(taskRunCmd)
+	addTaskOptionFlags(taskStartCmd)
+	addVarFlags(taskRunCmd)
+	addVarFlags(taskStartCmd)
+	addVarFlags(configValidateCmd)
+	addFormatFlag(taskRunCmd)
+	addFormatFlag(taskOutputCmd)
+	taskListCmd.Flags().StringSlice("selector", nil, "show tasks that have all specified labels (e.g. suite=raft,branch=main)")
+	taskListCmd.Flags().StringSlice("status", nil, "show tasks in the specified status (e.g. running,failed)")
+	taskListCmd.Flags().String("since", "", "show tasks created within the specified duration (e.g. 24h)")
+	taskListCmd.Flags().String("output", "text", "output format (text or json)")
+	taskLogsCmd.Flags().BoolP("follow", "f", false, "follow the output until the task is finished")
+	taskArtifactsCmd.Flags().String("download", "", "download all artifacts into the directory")
+	taskDeleteCmd.Flags().StringSlice("status", nil, "delete tasks in the specified status (e.g. succeeded,canceled)")
+	taskDeleteCmd.Flags().String("older-than", "", "delete tasks created before the specified duration (e.g. 7d, 12h)")
 }
 
 func main() {
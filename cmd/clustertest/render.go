@@ -2,18 +2,54 @@ package main
 
 import (
 	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
 	"github.com/yuuki0xff/clustertest/models"
 	"io"
+	"sort"
+	"strings"
 )
 
 type resultRender interface {
 	Render(w io.Writer, d models.TaskDetail)
+	// Flush writes the buffered data.  It must be called after all tasks are rendered.
+	Flush(w io.Writer)
+}
+
+func addFormatFlag(cmd *cobra.Command) {
+	cmd.Flags().String("format", "text", "output format (text, junit, tap or json)")
+}
+
+// newResultRender returns a resultRender for the format.
+// The n is the number of tasks to render.
+func newResultRender(format string, n int) (resultRender, error) {
+	switch format {
+	case "", "text":
+		if n > 1 {
+			return &multipleResultRender{}, nil
+		}
+		return &singleResultRender{}, nil
+	case "junit":
+		return &junitResultRender{}, nil
+	case "tap":
+		return &tapResultRender{}, nil
+	case "json":
+		return &jsonResultRender{}, nil
+	default:
+		return nil, errors.Errorf("unsupported format: %s", format)
+	}
 }
 
 type singleResultRender struct{}
 
 func (render singleResultRender) Render(w io.Writer, d models.TaskDetail) {
 	fmt.Fprintf(w, "Status: %s\n", d.State())
+	if vars := d.Options().Vars; len(vars) > 0 {
+		fmt.Fprintf(w, "Vars: %s\n", formatVars(vars))
+	}
+	if hold := d.HoldInfo(); hold != nil {
+		render.renderHold(w, hold)
+	}
 	tr := d.Result()
 	if tr == nil {
 		// Result is not available.
@@ -23,6 +59,9 @@ func (render singleResultRender) Render(w io.Writer, d models.TaskDetail) {
 	if err := tr.Error(); err != nil {
 		fmt.Fprintf(w, "Error: %s\n", err)
 	}
+	if err := tr.TeardownError(); err != nil {
+		fmt.Fprintf(w, "TeardownError: %s\n", err)
+	}
 	if r := tr.BeforeResult(); r != nil {
 		render.renderHeader(w, "Before")
 		render.renderResult(w, r)
@@ -36,11 +75,34 @@ func (render singleResultRender) Render(w io.Writer, d models.TaskDetail) {
 		render.renderResult(w, r)
 	}
 }
+func (singleResultRender) Flush(w io.Writer) {}
+func (singleResultRender) renderHold(w io.Writer, hold *models.HoldInfo) {
+	fmt.Fprintf(w, "Hold: the %s script failed.  Resources are held until %s\n", hold.Phase, hold.Until.String())
+	fmt.Fprintf(w, "Hosts:\n")
+	var groups []string
+	for group := range hold.Hosts {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		fmt.Fprintf(w, "  %s: %s\n", group, strings.Join(hold.Hosts[group], " "))
+	}
+}
 func (singleResultRender) renderHeader(w io.Writer, name string) {
 	fmt.Fprintf(w, "-------------------- %s --------------------\n", name)
 }
-func (singleResultRender) renderResult(w io.Writer, r models.ScriptResult) {
+func (render singleResultRender) renderResult(w io.Writer, r models.ScriptResult) {
 	fmt.Fprintf(w, "ExitCode: %d\n", r.ExitCode())
+	render.renderSummary(w, r)
+	if len(r.Children()) == 0 {
+		// The result does not have the per-host results.
+		io.WriteString(w, "Output:\n")
+		w.Write(r.Output())
+		return
+	}
+	render.renderHosts(w, nil, r)
+}
+func (singleResultRender) renderSummary(w io.Writer, r models.ScriptResult) {
 	if host := r.Host(); host != "" {
 		fmt.Fprintf(w, "Host: %s\n", host)
 	}
@@ -50,10 +112,53 @@ func (singleResultRender) renderResult(w io.Writer, r models.ScriptResult) {
 			fmt.Fprintf(w, "End: %s\n", end.String())
 		}
 	}
+}
+
+// renderHosts writes a section for each host.
+// The path is the names of ancestors of the r (e.g. provisioner and VM group).
+func (render singleResultRender) renderHosts(w io.Writer, path []string, r models.ScriptResult) {
+	children := r.Children()
+	if !isHostResult(r) {
+		for _, c := range children {
+			render.renderHosts(w, appendName(path, c.Name()), c)
+		}
+		return
+	}
+
+	name := strings.Join(path, " / ")
+	if name == "" {
+		name = r.Host()
+	}
+	fmt.Fprintf(w, "----- %s -----\n", name)
+	fmt.Fprintf(w, "ExitCode: %d\n", r.ExitCode())
+	render.renderSummary(w, r)
 	io.WriteString(w, "Output:\n")
 	w.Write(r.Output())
 }
 
+// isHostResult returns true if the r is the result of a host.
+// The children of a host result are the results of the commands, which does not have children.
+func isHostResult(r models.ScriptResult) bool {
+	children := r.Children()
+	if len(children) == 0 {
+		return true
+	}
+	for _, c := range children {
+		if len(c.Children()) > 0 {
+			return false
+		}
+	}
+	return true
+}
+func appendName(path []string, name string) []string {
+	if name == "" {
+		return path
+	}
+	p := make([]string, len(path), len(path)+1)
+	copy(p, path)
+	return append(p, name)
+}
+
 type multipleResultRender struct {
 	notFirst bool
 }
@@ -70,3 +175,4 @@ func (render *multipleResultRender) Render(w io.Writer, d models.TaskDetail) {
 	r := singleResultRender{}
 	r.Render(w, d)
 }
+func (*multipleResultRender) Flush(w io.Writer) {}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/yuuki0xff/clustertest/models"
+	"io"
+	"strings"
+	"time"
+)
+
+// testCase is a unit of the reports for CI systems.
+// Each command is mapped to a test case.  The phase, provisioner, VM group and host are mapped to the class name.
+type testCase struct {
+	Class    []string
+	Name     string
+	Duration time.Duration
+	// Failure is a failure message.  It is empty if the test case succeeded.
+	Failure string
+	Output  []byte
+}
+
+// testCases converts the result of the task to the test cases.
+func testCases(d models.TaskDetail) []*testCase {
+	var cases []*testCase
+	tr := d.Result()
+	if tr == nil {
+		return []*testCase{{
+			Class:   []string{"task"},
+			Name:    "result",
+			Failure: fmt.Sprintf("result is not available: task is %s", d.State()),
+		}}
+	}
+
+	failed := false
+	for _, phase := range []struct {
+		name string
+		r    models.ScriptResult
+	}{
+		{"before", tr.BeforeResult()},
+		{"main", tr.ScriptResult()},
+		{"after", tr.AfterResult()},
+	} {
+		if phase.r == nil {
+			continue
+		}
+		// Use the phase name instead of the name of the phase result.
+		class := []string{phase.name}
+		var phaseCases []*testCase
+		if children := phase.r.Children(); len(children) > 0 {
+			for _, c := range children {
+				phaseCases = append(phaseCases, scriptTestCases(class, c)...)
+			}
+		} else {
+			phaseCases = scriptTestCases(class, phase.r)
+		}
+		for _, c := range phaseCases {
+			if c.Failure != "" {
+				failed = true
+			}
+			cases = append(cases, c)
+		}
+	}
+	if err := tr.Error(); err != nil && !failed {
+		// The task failed without failed commands (e.g. failed to create VMs).
+		cases = append(cases, &testCase{
+			Class:   []string{"task"},
+			Name:    "result",
+			Failure: err.Error(),
+		})
+	}
+	if err := tr.TeardownError(); err != nil {
+		cases = append(cases, &testCase{
+			Class:   []string{"task"},
+			Name:    "teardown",
+			Failure: err.Error(),
+		})
+	}
+	return cases
+}
+
+// scriptTestCases converts the r and its descendants to the test cases.
+// The class is the names of ancestors of the r.
+func scriptTestCases(class []string, r models.ScriptResult) []*testCase {
+	children := r.Children()
+	if len(children) == 0 {
+		c := &testCase{
+			Class:  class,
+			Name:   r.Name(),
+			Output: r.Output(),
+		}
+		if c.Name == "" {
+			c.Name = r.Host()
+		}
+		if !r.StartTime().IsZero() && !r.EndTime().IsZero() {
+			c.Duration = r.EndTime().Sub(r.StartTime())
+		}
+		if code := r.ExitCode(); code != 0 {
+			c.Failure = fmt.Sprintf("exit code %d", code)
+		}
+		return []*testCase{c}
+	}
+
+	var cases []*testCase
+	for _, c := range children {
+		cases = append(cases, scriptTestCases(appendName(class, r.Name()), c)...)
+	}
+	return cases
+}
+
+// junitResultRender writes the results in the JUnit XML format.
+// All tasks are written as test suites in one document by Flush().
+type junitResultRender struct {
+	suites junitTestSuites
+}
+type junitTestSuites struct {
+	XMLName xml.Name          `xml:"testsuites"`
+	Suites  []*junitTestSuite `xml:"testsuite"`
+}
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Time      string           `xml:"time,attr"`
+	Timestamp string           `xml:"timestamp,attr,omitempty"`
+	Cases     []*junitTestCase `xml:"testcase"`
+}
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+func (render *junitResultRender) Render(w io.Writer, d models.TaskDetail) {
+	suite := &junitTestSuite{
+		Name: "task " + d.TaskID().String(),
+	}
+	if created := d.CreatedTime(); !created.IsZero() {
+		suite.Timestamp = created.Format(time.RFC3339)
+	}
+	var total time.Duration
+	for _, c := range testCases(d) {
+		tc := &junitTestCase{
+			ClassName: strings.Join(c.Class, "."),
+			Name:      c.Name,
+			Time:      junitSeconds(c.Duration),
+			SystemOut: string(c.Output),
+		}
+		if c.Failure != "" {
+			tc.Failure = &junitFailure{Message: c.Failure}
+			suite.Failures++
+		}
+		suite.Tests++
+		total += c.Duration
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Time = junitSeconds(total)
+	render.suites.Suites = append(render.suites.Suites, suite)
+}
+func (render *junitResultRender) Flush(w io.Writer) {
+	b, err := xml.MarshalIndent(&render.suites, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	io.WriteString(w, xml.Header)
+	w.Write(b)
+	io.WriteString(w, "\n")
+}
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// tapResultRender writes the results in the TAP (Test Anything Protocol) version 13 format.
+type tapResultRender struct {
+	n int
+}
+
+func (render *tapResultRender) Render(w io.Writer, d models.TaskDetail) {
+	if render.n == 0 {
+		io.WriteString(w, "TAP version 13\n")
+	}
+	for _, c := range testCases(d) {
+		render.n++
+		status := "ok"
+		if c.Failure != "" {
+			status = "not ok"
+		}
+		name := strings.Join(append(append([]string{"task", d.TaskID().String()}, c.Class...), c.Name), " ")
+		fmt.Fprintf(w, "%s %d - %s\n", status, render.n, tapEscape(name))
+
+		// Write the details as a YAML block.
+		io.WriteString(w, "  ---\n")
+		fmt.Fprintf(w, "  duration_ms: %d\n", c.Duration.Milliseconds())
+		if c.Failure != "" {
+			fmt.Fprintf(w, "  message: %q\n", c.Failure)
+		}
+		if len(c.Output) > 0 {
+			io.WriteString(w, "  output: |\n")
+			for _, line := range strings.SplitAfter(strings.TrimSuffix(string(c.Output), "\n"), "\n") {
+				fmt.Fprintf(w, "    %s", line)
+				if !strings.HasSuffix(line, "\n") {
+					io.WriteString(w, "\n")
+				}
+			}
+		}
+		io.WriteString(w, "  ...\n")
+	}
+}
+func (render *tapResultRender) Flush(w io.Writer) {
+	fmt.Fprintf(w, "1..%d\n", render.n)
+}
+func tapEscape(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "#", "\\#")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// jsonResultRender writes the results as a JSON array.
+type jsonResultRender struct {
+	tasks []*jsonTask
+}
+type jsonTask struct {
+	ID            string
+	State         string
+	Error         string      `json:",omitempty"`
+	TeardownError string      `json:",omitempty"`
+	Before        *jsonResult `json:",omitempty"`
+	Main          *jsonResult `json:",omitempty"`
+	After         *jsonResult `json:",omitempty"`
+}
+type jsonResult struct {
+	Name     string
+	Host     string `json:",omitempty"`
+	Start    time.Time
+	End      time.Time
+	ExitCode int
+	Output   string        `json:",omitempty"`
+	Children []*jsonResult `json:",omitempty"`
+}
+
+func (render *jsonResultRender) Render(w io.Writer, d models.TaskDetail) {
+	t := &jsonTask{
+		ID:    d.TaskID().String(),
+		State: d.State(),
+	}
+	if tr := d.Result(); tr != nil {
+		if err := tr.Error(); err != nil {
+			t.Error = err.Error()
+		}
+		if err := tr.TeardownError(); err != nil {
+			t.TeardownError = err.Error()
+		}
+		t.Before = newJSONResult(tr.BeforeResult())
+		t.Main = newJSONResult(tr.ScriptResult())
+		t.After = newJSONResult(tr.AfterResult())
+	}
+	render.tasks = append(render.tasks, t)
+}
+func (render *jsonResultRender) Flush(w io.Writer) {
+	tasks := render.tasks
+	if tasks == nil {
+		tasks = []*jsonTask{}
+	}
+	b, err := json.MarshalIndent(tasks, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	w.Write(b)
+	io.WriteString(w, "\n")
+}
+func newJSONResult(r models.ScriptResult) *jsonResult {
+	if r == nil {
+		return nil
+	}
+	jr := &jsonResult{
+		Name:     r.Name(),
+		Host:     r.Host(),
+		Start:    r.StartTime(),
+		End:      r.EndTime(),
+		ExitCode: r.ExitCode(),
+	}
+	children := r.Children()
+	if len(children) == 0 {
+		// Output of the parent is the concatenation of the children.  Write it only once.
+		jr.Output = string(r.Output())
+	}
+	for _, c := range children {
+		jr.Children = append(jr.Children, newJSONResult(c))
+	}
+	return jr
+}
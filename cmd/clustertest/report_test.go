@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/clustertest/rpc"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newReportTestDetail() *rpc.Detail {
+	start := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	command := func(cmd string, exit int) *rpc.ScriptResult {
+		return &rpc.ScriptResult{
+			NameStr:  cmd,
+			Start:    start,
+			End:      start.Add(2 * time.Second),
+			Hostname: "root@192.168.0.10",
+			Out:      []byte("root@192.168.0.10$ " + cmd + "\n"),
+			Exit:     exit,
+		}
+	}
+	return &rpc.Detail{
+		ID:        &rpc.TaskID{ID: "1"},
+		StatusStr: "finished",
+		ResultObj: &rpc.Result{
+			ErrMsg: "failed",
+			Main: &rpc.ScriptResult{
+				NameStr: "main",
+				Exit:    1,
+				ChildResults: []*rpc.ScriptResult{{
+					NameStr: "web",
+					Exit:    1,
+					ChildResults: []*rpc.ScriptResult{
+						command("true", 0),
+						command("false", 1),
+					},
+				}},
+			},
+		},
+	}
+}
+
+func TestJunitResultRender(t *testing.T) {
+	t.Run("should_map_commands_to_test_cases", func(t *testing.T) {
+		var buf bytes.Buffer
+		render := &junitResultRender{}
+		render.Render(&buf, newReportTestDetail())
+		render.Flush(&buf)
+
+		suites := &junitTestSuites{}
+		if !assert.NoError(t, xml.Unmarshal(buf.Bytes(), suites)) {
+			return
+		}
+		if !assert.Len(t, suites.Suites, 1) {
+			return
+		}
+		suite := suites.Suites[0]
+		assert.Equal(t, 2, suite.Tests)
+		assert.Equal(t, 1, suite.Failures)
+		assert.Equal(t, "4.000", suite.Time)
+		if !assert.Len(t, suite.Cases, 2) {
+			return
+		}
+		assert.Equal(t, "main.web", suite.Cases[1].ClassName)
+		assert.Equal(t, "false", suite.Cases[1].Name)
+		assert.Equal(t, "exit code 1", suite.Cases[1].Failure.Message)
+		assert.Equal(t, "root@192.168.0.10$ false\n", suite.Cases[1].SystemOut)
+	})
+}
+
+func TestTapResultRender(t *testing.T) {
+	t.Run("should_report_each_command", func(t *testing.T) {
+		var buf bytes.Buffer
+		render := &tapResultRender{}
+		render.Render(&buf, newReportTestDetail())
+		render.Flush(&buf)
+
+		out := buf.String()
+		assert.True(t, strings.HasPrefix(out, "TAP version 13\n"))
+		assert.Contains(t, out, "ok 1 - task 1 main web true\n")
+		assert.Contains(t, out, "not ok 2 - task 1 main web false\n")
+		assert.True(t, strings.HasSuffix(out, "1..2\n"))
+	})
+}
@@ -1,22 +1,38 @@
 package main
 
 import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	. "github.com/yuuki0xff/clustertest/cmdutils"
+	"github.com/yuuki0xff/clustertest/config"
 	"github.com/yuuki0xff/clustertest/models"
-	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
 )
 
 type FileTask struct {
 	name string
 	data []byte
+	opts models.TaskOptions
 }
 
-func newTaskFromFile(name string) (models.Task, error) {
-	data, err := ioutil.ReadFile(name)
+// newTaskFromFile reads the config, renders it with the variables and merges the included files.
+// The merged config is sent to the daemon with the local files referred by it, and the resolved variables are
+// recorded in the TaskOptions.
+func newTaskFromFile(name string, opts models.TaskOptions, vars config.Vars) (models.Task, error) {
+	data, resolved, err := config.ReadFile(name, vars)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrapf(err, "failed to read %s", name)
+	}
+	data, err = config.AttachLocalFiles(data, filepath.Dir(name))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", name)
 	}
+	opts.Vars = resolved
 
-	return &FileTask{name, data}, nil
+	return &FileTask{name, data, opts}, nil
 }
 func (t *FileTask) String() string {
 	return t.name
@@ -24,3 +40,121 @@ func (t *FileTask) String() string {
 func (t *FileTask) SpecData() []byte {
 	return t.data
 }
+func (t *FileTask) Options() models.TaskOptions {
+	return t.opts
+}
+
+// addTaskOptionFlags adds flags to specify the TaskOptions.
+func addTaskOptionFlags(cmd *cobra.Command) {
+	cmd.Flags().String("hold-on-failure", "", "keep the infrastructure for specified duration after a script failed (e.g. 30m)")
+	cmd.Flags().Int("priority", 0, "tasks with higher priority are executed first")
+	cmd.Flags().String("name", "", "name to refer the task instead of ID (default is the name of the config)")
+	cmd.Flags().StringArray("label", nil, "add a label to the task (e.g. --label branch=main)")
+}
+
+// taskOptionsFromFlags builds the TaskOptions from flags added by addTaskOptionFlags().
+func taskOptionsFromFlags(cmd *cobra.Command) (models.TaskOptions, error) {
+	var opts models.TaskOptions
+
+	hold, err := cmd.Flags().GetString("hold-on-failure")
+	if err != nil {
+		return opts, err
+	}
+	if hold != "" {
+		opts.HoldOnFailure, err = ParseDuration(hold)
+		if err != nil {
+			return opts, errors.Wrap(err, "invalid --hold-on-failure")
+		}
+	}
+
+	opts.Priority, err = cmd.Flags().GetInt("priority")
+	if err != nil {
+		return opts, err
+	}
+
+	opts.Name, err = cmd.Flags().GetString("name")
+	if err != nil {
+		return opts, err
+	}
+
+	labels, err := cmd.Flags().GetStringArray("label")
+	if err != nil {
+		return opts, err
+	}
+	opts.Labels, err = parseLabels(labels)
+	if err != nil {
+		return opts, errors.Wrap(err, "invalid --label")
+	}
+	opts.Submitter = submitter()
+	return opts, nil
+}
+
+// addVarFlags adds flags to override the variables in the config.
+func addVarFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("var", nil, "override a variable in the config (e.g. --var nodes=5)")
+	cmd.Flags().StringArray("var-file", nil, "override variables in the config by a YAML file")
+}
+
+// varsFromFlags returns the variables specified by flags added by addVarFlags().
+// The --var flags take precedence over the --var-file flags.
+func varsFromFlags(cmd *cobra.Command) (config.Vars, error) {
+	files, err := cmd.Flags().GetStringArray("var-file")
+	if err != nil {
+		return nil, err
+	}
+	ss, err := cmd.Flags().GetStringArray("var")
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 && len(ss) == 0 {
+		return nil, nil
+	}
+
+	vars := config.Vars{}
+	for _, file := range files {
+		fvars, err := config.LoadVarsFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range fvars {
+			vars[k] = v
+		}
+	}
+	for _, s := range ss {
+		k, v, err := config.ParseVar(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid --var")
+		}
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+// parseLabels parses the list of "key=value".
+func parseLabels(ss []string) (map[string]string, error) {
+	if len(ss) == 0 {
+		return nil, nil
+	}
+	labels := map[string]string{}
+	for _, s := range ss {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.Errorf("label must be key=value: %s", s)
+		}
+		labels[kv[0]] = kv[1]
+	}
+	return labels, nil
+}
+
+// submitter returns the name of the current user and the host.
+func submitter() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return name
+	}
+	return name + "@" + host
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rgeoghegan/tabulate"
+	"github.com/spf13/cobra"
+	. "github.com/yuuki0xff/clustertest/cmdutils"
+	"github.com/yuuki0xff/clustertest/models"
+	"github.com/yuuki0xff/clustertest/rpc"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+func taskArtifactsFn(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		err := errors.New("specify a TaskID")
+		ShowError(err)
+		return nil
+	}
+	dir, err := cmd.Flags().GetString("download")
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+
+	c, err := rpc.NewClient()
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+
+	id, err := c.Resolve(args[0])
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+	artifacts, err := c.Artifacts(id)
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+	if dir == "" {
+		artifactListRender{}.Render(os.Stdout, artifacts)
+		return nil
+	}
+
+	for _, a := range artifacts {
+		err := downloadArtifact(c, id, a.Name, dir)
+		if err != nil {
+			ShowError(err)
+			return nil
+		}
+	}
+	return nil
+}
+
+// downloadArtifact saves the artifact into the dir.
+func downloadArtifact(c *rpc.Client, id models.TaskID, name, dir string) error {
+	// Prevent to write files outside of the dir.
+	p := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+name)))
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+
+	r, err := c.OpenArtifact(id, name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return errors.Wrapf(err, "failed to download %s", name)
+}
+
+type artifactListRender struct{}
+
+func (artifactListRender) Render(w io.Writer, artifacts []models.Artifact) {
+	var rows []*artifactListRow
+	for _, a := range artifacts {
+		rows = append(rows, &artifactListRow{
+			Name: a.Name,
+			Size: a.Size,
+		})
+	}
+	if len(rows) == 0 {
+		return
+	}
+
+	layout := &tabulate.Layout{
+		Format: tabulate.SimpleFormat,
+	}
+	table, err := tabulate.Tabulate(rows, layout)
+	if err != nil {
+		panic(err)
+	}
+	io.WriteString(w, table)
+}
+
+type artifactListRow struct {
+	Name string
+	Size int64
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	. "github.com/yuuki0xff/clustertest/cmdutils"
+	"github.com/yuuki0xff/clustertest/rpc"
+)
+
+func taskCancelFn(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		err := errors.New("no TaskID specified")
+		ShowError(err)
+		return nil
+	}
+
+	c, err := rpc.NewClient()
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+
+	for _, sid := range args {
+		id, err := c.Resolve(sid)
+		if err != nil {
+			ShowError(err)
+			return nil
+		}
+		err = c.Cancel(id)
+		if err != nil {
+			ShowError(err)
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	. "github.com/yuuki0xff/clustertest/cmdutils"
+	"github.com/yuuki0xff/clustertest/models"
+	"github.com/yuuki0xff/clustertest/rpc"
+	"time"
+)
+
+func taskDeleteFn(cmd *cobra.Command, args []string) error {
+	statuses, err := cmd.Flags().GetStringSlice("status")
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+	olderThanStr, err := cmd.Flags().GetString("older-than")
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+	if len(args) == 0 && len(statuses) == 0 && olderThanStr == "" {
+		err := errors.New("no TaskID or filter specified")
+		ShowError(err)
+		return nil
+	}
+
+	filter := &taskDeleteFilter{
+		IDs:      args,
+		Statuses: statuses,
+	}
+	if olderThanStr != "" {
+		olderThan, err := ParseDuration(olderThanStr)
+		if err != nil {
+			ShowError(errors.Wrap(err, "invalid --older-than"))
+			return nil
+		}
+		filter.Before = time.Now().Add(-olderThan)
+	}
+
+	c, err := rpc.NewClient()
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+
+	// Continue to delete other tasks even if some tasks failed, and report the failures at last.
+	var failed int
+	var ids []models.TaskID
+	if len(statuses) == 0 && filter.Before.IsZero() {
+		// Delete the specified tasks.
+		for _, ref := range args {
+			id, err := c.Resolve(ref)
+			if err != nil {
+				ShowError(errors.Wrapf(err, "failed to resolve %s", ref))
+				failed++
+				continue
+			}
+			ids = append(ids, id)
+		}
+	} else {
+		tasks, err := c.List()
+		if err != nil {
+			ShowError(err)
+			return nil
+		}
+		for _, t := range tasks {
+			if filter.Match(t) {
+				ids = append(ids, t.TaskID())
+			}
+		}
+	}
+
+	for _, id := range ids {
+		err := c.Delete(id)
+		if err != nil {
+			ShowError(errors.Wrapf(err, "failed to delete %s", id))
+			failed++
+			continue
+		}
+		fmt.Printf("deleted %s\n", id)
+	}
+	if failed > 0 {
+		// Exit with non-zero status to detect failures in scripts.
+		err := errors.Errorf("failed to delete %d tasks", failed)
+		ShowError(err)
+		return err
+	}
+	return nil
+}
+
+// taskDeleteFilter selects tasks to be deleted.
+type taskDeleteFilter struct {
+	// IDs or names of tasks.  If it is empty, all tasks are matched.
+	IDs []string
+	// Statuses of tasks.  If it is empty, only terminated tasks are matched.
+	Statuses []string
+	// Matches tasks created before this time.  If it is zero, all tasks are matched.
+	Before time.Time
+}
+
+func (f *taskDeleteFilter) Match(d models.TaskDetail) bool {
+	if len(f.IDs) > 0 && !containsString(f.IDs, d.TaskID().String()) && !containsString(f.IDs, d.Options().Name) {
+		return false
+	}
+	if len(f.Statuses) > 0 {
+		if !containsString(f.Statuses, d.State()) {
+			return false
+		}
+	} else if !models.IsTerminalState(d.State()) {
+		return false
+	}
+	if !f.Before.IsZero() && !d.CreatedTime().Before(f.Before) {
+		return false
+	}
+	return true
+}
+
+func containsString(ss []string, s string) bool {
+	for _, item := range ss {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
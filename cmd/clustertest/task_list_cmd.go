@@ -1,6 +1,9 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
 	"github.com/rgeoghegan/tabulate"
 	"github.com/spf13/cobra"
 	. "github.com/yuuki0xff/clustertest/cmdutils"
@@ -11,9 +14,33 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func taskListFn(cmd *cobra.Command, args []string) error {
+	filter, err := taskListFilterFromFlags(cmd)
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+	var render interface {
+		Render(w io.Writer, tasks []models.TaskDetail)
+	}
+	switch output {
+	case "", "text":
+		render = taskListRender{}
+	case "json":
+		render = taskListJSONRender{}
+	default:
+		ShowError(errors.Errorf("unsupported output format: %s", output))
+		return nil
+	}
+
 	c, err := rpc.NewClient()
 	if err != nil {
 		ShowError(err)
@@ -25,6 +52,13 @@ func taskListFn(cmd *cobra.Command, args []string) error {
 		ShowError(err)
 		return nil
 	}
+	var matched []models.TaskDetail
+	for _, t := range tasks {
+		if filter.Match(t) {
+			matched = append(matched, t)
+		}
+	}
+	tasks = matched
 
 	// Sort by ID.
 	sort.SliceStable(tasks, func(i, j int) bool {
@@ -40,18 +74,84 @@ func taskListFn(cmd *cobra.Command, args []string) error {
 		return a < b
 	})
 
-	taskListRender{}.Render(os.Stdout, tasks)
+	render.Render(os.Stdout, tasks)
 	return nil
 }
 
+// taskListFilter selects tasks to be listed.
+type taskListFilter struct {
+	// Selector matches tasks that have all labels.  If it is empty, all tasks are matched.
+	Selector map[string]string
+	// Statuses of tasks.  If it is empty, all tasks are matched.
+	Statuses []string
+	// Matches tasks created after this time.  If it is zero, all tasks are matched.
+	Since time.Time
+}
+
+func taskListFilterFromFlags(cmd *cobra.Command) (*taskListFilter, error) {
+	f := &taskListFilter{}
+	selector, err := cmd.Flags().GetStringSlice("selector")
+	if err != nil {
+		return nil, err
+	}
+	f.Selector, err = parseLabels(selector)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid --selector")
+	}
+
+	f.Statuses, err = cmd.Flags().GetStringSlice("status")
+	if err != nil {
+		return nil, err
+	}
+
+	since, err := cmd.Flags().GetString("since")
+	if err != nil {
+		return nil, err
+	}
+	if since != "" {
+		d, err := ParseDuration(since)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid --since")
+		}
+		f.Since = time.Now().Add(-d)
+	}
+	return f, nil
+}
+func (f *taskListFilter) Match(d models.TaskDetail) bool {
+	labels := d.Options().Labels
+	for k, v := range f.Selector {
+		if lv, ok := labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	if len(f.Statuses) > 0 && !containsString(f.Statuses, d.State()) {
+		return false
+	}
+	if !f.Since.IsZero() && d.CreatedTime().Before(f.Since) {
+		return false
+	}
+	return true
+}
+
 type taskListRender struct{}
 
 func (taskListRender) Render(w io.Writer, tasks []models.TaskDetail) {
 	var rows []*taskListRow
 	for _, t := range tasks {
+		opts := t.Options()
 		row := &taskListRow{
-			ID:     t.TaskID().String(),
-			Status: t.State(),
+			ID:        t.TaskID().String(),
+			Name:      opts.Name,
+			Status:    t.State(),
+			Priority:  opts.Priority,
+			Duration:  taskDuration(t).Truncate(time.Second).String(),
+			Submitter: opts.Submitter,
+			Labels:    formatLabels(opts.Labels),
+		}
+		// Show how long the task has been in the current state.
+		if h := t.History(); len(h) > 0 {
+			last := h[len(h)-1]
+			row.Since = time.Since(last.Time).Truncate(time.Second).String()
 		}
 		rows = append(rows, row)
 	}
@@ -67,6 +167,94 @@ func (taskListRender) Render(w io.Writer, tasks []models.TaskDetail) {
 }
 
 type taskListRow struct {
-	ID     string
-	Status string
+	ID        string
+	Name      string
+	Status    string
+	Priority  int
+	Since     string
+	Duration  string
+	Submitter string
+	Labels    string
+}
+
+// taskListJSONRender writes the tasks as a JSON array.
+type taskListJSONRender struct{}
+type jsonTaskListItem struct {
+	ID        string
+	Name      string
+	Status    string
+	Priority  int
+	Created   time.Time
+	Duration  string
+	Submitter string
+	Labels    map[string]string
+	Vars      map[string]interface{}
+	History   []models.StateTransition
+}
+
+func (taskListJSONRender) Render(w io.Writer, tasks []models.TaskDetail) {
+	items := []*jsonTaskListItem{}
+	for _, t := range tasks {
+		opts := t.Options()
+		items = append(items, &jsonTaskListItem{
+			ID:        t.TaskID().String(),
+			Name:      opts.Name,
+			Status:    t.State(),
+			Priority:  opts.Priority,
+			Created:   t.CreatedTime(),
+			Duration:  taskDuration(t).String(),
+			Submitter: opts.Submitter,
+			Labels:    opts.Labels,
+			Vars:      opts.Vars,
+			History:   t.History(),
+		})
+	}
+	b, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	w.Write(b)
+	io.WriteString(w, "\n")
+}
+
+// taskDuration returns the running time of the task.
+// The task that has not been started yet returns zero.
+func taskDuration(d models.TaskDetail) time.Duration {
+	var start, end time.Time
+	for _, t := range d.History() {
+		switch {
+		case t.State == models.WaitingTaskState:
+		case models.IsTerminalState(t.State):
+			end = t.Time
+		case start.IsZero():
+			start = t.Time
+		}
+	}
+	if start.IsZero() {
+		return 0
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return end.Sub(start)
+}
+
+// formatLabels returns labels as "key=value" separated by comma in order of keys.
+func formatLabels(labels map[string]string) string {
+	var ss []string
+	for k, v := range labels {
+		ss = append(ss, k+"="+v)
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ",")
+}
+
+// formatVars returns variables as "key=value" separated by comma in order of keys.
+func formatVars(vars map[string]interface{}) string {
+	var ss []string
+	for k, v := range vars {
+		ss = append(ss, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ",")
 }
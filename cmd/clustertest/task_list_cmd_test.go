@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/clustertest/models"
+	"github.com/yuuki0xff/clustertest/rpc"
+	"testing"
+	"time"
+)
+
+func TestTaskListFilter_Match(t *testing.T) {
+	now := time.Now()
+	d := &rpc.Detail{
+		ID:        &rpc.TaskID{ID: "1"},
+		StatusStr: models.FailedTaskState,
+		Created:   now.Add(-time.Hour),
+		Opts: models.TaskOptions{
+			Labels: map[string]string{"branch": "main", "suite": "raft"},
+		},
+	}
+
+	t.Run("should_match_all_labels", func(t *testing.T) {
+		f := &taskListFilter{Selector: map[string]string{"suite": "raft"}}
+		assert.True(t, f.Match(d))
+		f = &taskListFilter{Selector: map[string]string{"suite": "raft", "branch": "dev"}}
+		assert.False(t, f.Match(d))
+		f = &taskListFilter{Selector: map[string]string{"os": ""}}
+		assert.False(t, f.Match(d))
+	})
+
+	t.Run("should_match_status_and_since", func(t *testing.T) {
+		f := &taskListFilter{Statuses: []string{models.FailedTaskState}, Since: now.Add(-2 * time.Hour)}
+		assert.True(t, f.Match(d))
+		f = &taskListFilter{Statuses: []string{models.SucceededTaskState}}
+		assert.False(t, f.Match(d))
+		f = &taskListFilter{Since: now.Add(-time.Minute)}
+		assert.False(t, f.Match(d))
+	})
+}
+
+func TestTaskDuration(t *testing.T) {
+	start := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	t.Run("should_measure_from_start_to_end", func(t *testing.T) {
+		d := &rpc.Detail{Transitions: []models.StateTransition{
+			{State: models.WaitingTaskState, Time: start},
+			{State: models.RunningTaskState, Time: start.Add(time.Minute)},
+			{State: models.MainTaskState, Time: start.Add(2 * time.Minute)},
+			{State: models.SucceededTaskState, Time: start.Add(3 * time.Minute)},
+		}}
+		assert.Equal(t, 2*time.Minute, taskDuration(d))
+	})
+
+	t.Run("should_be_zero_when_not_started", func(t *testing.T) {
+		d := &rpc.Detail{Transitions: []models.StateTransition{
+			{State: models.WaitingTaskState, Time: start},
+			{State: models.CanceledTaskState, Time: start.Add(time.Minute)},
+		}}
+		assert.Equal(t, time.Duration(0), taskDuration(d))
+	})
+}
+
+func TestParseLabels(t *testing.T) {
+	t.Run("should_parse_key_value", func(t *testing.T) {
+		labels, err := parseLabels([]string{"branch=main", "expr=a=b"})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"branch": "main", "expr": "a=b"}, labels)
+	})
+
+	t.Run("should_fail_without_equal", func(t *testing.T) {
+		_, err := parseLabels([]string{"branch"})
+		assert.EqualError(t, err, "label must be key=value: branch")
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	. "github.com/yuuki0xff/clustertest/cmdutils"
+	"github.com/yuuki0xff/clustertest/rpc"
+	"os"
+)
+
+func taskLogsFn(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		err := errors.New("specify a TaskID")
+		ShowError(err)
+		return nil
+	}
+	follow, err := cmd.Flags().GetBool("follow")
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+
+	c, err := rpc.NewClient()
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+
+	id, err := c.Resolve(args[0])
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+	if !follow {
+		out, err := c.Logs(id, 0)
+		if err != nil {
+			ShowError(err)
+			return nil
+		}
+		os.Stdout.Write(out)
+		return nil
+	}
+
+	offset := 0
+	for {
+		// The server returns when the new output is available or the task is finished.
+		out, finished, err := c.FollowLogs(id, offset)
+		if err != nil {
+			ShowError(err)
+			return nil
+		}
+		os.Stdout.Write(out)
+		offset += len(out)
+		if finished {
+			return nil
+		}
+	}
+}
@@ -22,15 +22,23 @@ func taskOutputFn(cmd *cobra.Command, args []string) error {
 	}
 
 	taskIDs := args
-	var render resultRender
-	if len(taskIDs) > 1 {
-		render = &multipleResultRender{}
-	} else {
-		render = &singleResultRender{}
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+	render, err := newResultRender(format, len(taskIDs))
+	if err != nil {
+		ShowError(err)
+		return nil
 	}
 
 	for _, sid := range taskIDs {
-		id := &StringTaskID{sid}
+		id, err := c.Resolve(sid)
+		if err != nil {
+			ShowError(err)
+			return nil
+		}
 		d, err := c.Inspect(id)
 		if err != nil {
 			ShowError(err)
@@ -39,5 +47,6 @@ func taskOutputFn(cmd *cobra.Command, args []string) error {
 
 		render.Render(os.Stdout, d)
 	}
+	render.Flush(os.Stdout)
 	return nil
 }
@@ -22,9 +22,31 @@ func taskRunFn(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
+	opts, err := taskOptionsFromFlags(cmd)
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+	vars, err := varsFromFlags(cmd)
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+	render, err := newResultRender(format, len(files))
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+
 	var ids []models.TaskID
 	for _, file := range files {
-		task, err := newTaskFromFile(file)
+		task, err := newTaskFromFile(file, opts, vars)
 		if err != nil {
 			ShowError(err)
 			return nil
@@ -46,13 +68,6 @@ func taskRunFn(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	var render resultRender
-	if len(ids) > 1 {
-		render = &multipleResultRender{}
-	} else {
-		render = &singleResultRender{}
-	}
-
 	for _, id := range ids {
 		d, err := c.Inspect(id)
 		if err != nil {
@@ -62,5 +77,6 @@ func taskRunFn(cmd *cobra.Command, args []string) error {
 
 		render.Render(os.Stdout, d)
 	}
+	render.Flush(os.Stdout)
 	return nil
 }
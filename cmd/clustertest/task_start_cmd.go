@@ -20,8 +20,19 @@ func taskStartFn(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
+	opts, err := taskOptionsFromFlags(cmd)
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+	vars, err := varsFromFlags(cmd)
+	if err != nil {
+		ShowError(err)
+		return nil
+	}
+
 	for _, file := range files {
-		task, err := newTaskFromFile(file)
+		task, err := newTaskFromFile(file, opts, vars)
 		if err != nil {
 			ShowError(err)
 			return nil
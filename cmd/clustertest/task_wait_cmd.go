@@ -18,8 +18,12 @@ func taskWaitFn(cmd *cobra.Command, args []string) error {
 
 	ctx := context.Background()
 	for _, sid := range taskIDs {
-		id := &StringTaskID{sid}
-		err := c.Wait(id, ctx)
+		id, err := c.Resolve(sid)
+		if err != nil {
+			ShowError(err)
+			return nil
+		}
+		err = c.Wait(id, ctx)
 		if err != nil {
 			ShowError(err)
 			return nil
@@ -27,11 +31,3 @@ func taskWaitFn(cmd *cobra.Command, args []string) error {
 	}
 	return nil
 }
-
-type StringTaskID struct {
-	id string
-}
-
-func (s *StringTaskID) String() string {
-	return s.id
-}
@@ -43,6 +43,10 @@ func init() {
 	rootCmd.Flags().Int32P("jobs", "j", 8, "number of jobs to run simultaneously")
 	rootCmd.Flags().StringP("listen", "l", "0.0.0.0", "listen address")
 	rootCmd.Flags().Int32P("port", "p", 9571, "port to connect to clustertestd RPC")
+	rootCmd.Flags().String("db", "memory", "type of task database (memory or file)")
+	rootCmd.Flags().String("data-dir", "/var/lib/clustertest", "directory to store data of the file database")
+	rootCmd.Flags().String("secrets-dir", "", "directory of secrets referred by ${secret:name} in configs")
+	rootCmd.Flags().StringSlice("secrets-env", nil, "environment variables referred by ${env:NAME} in configs (NAME or PREFIX*)")
 }
 
 func main() {
@@ -3,9 +3,12 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/yuuki0xff/clustertest/databases"
+	"github.com/yuuki0xff/clustertest/models"
 	"github.com/yuuki0xff/clustertest/rpc"
+	"github.com/yuuki0xff/clustertest/secrets"
 	"github.com/yuuki0xff/clustertest/worker"
 	"golang.org/x/sync/errgroup"
 	"os"
@@ -38,14 +41,34 @@ func rootCmdFn(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	db := databases.NewMemTaskDB()
+	secretsDir, err := cmd.Flags().GetString("secrets-dir")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR: invalid args", err)
+		return nil
+	}
+	secretsEnv, err := cmd.Flags().GetStringSlice("secrets-env")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR: invalid args", err)
+		return nil
+	}
+	store := &secrets.Store{
+		Dir:  secretsDir,
+		Envs: secretsEnv,
+	}
+
+	db, err := openDB(cmd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		return nil
+	}
 
 	ctx := context.Background()
 	g, _ := errgroup.WithContext(ctx)
 	for i := int32(0); i < jobs; i++ {
 		g.Go(func() error {
 			w := worker.Worker{
-				Queue: db,
+				Queue:   db,
+				Secrets: store,
 			}
 			return w.Serve(ctx)
 		})
@@ -57,3 +80,28 @@ func rootCmdFn(cmd *cobra.Command, args []string) error {
 	})
 	return g.Wait()
 }
+
+type taskDB interface {
+	models.TaskDB
+	models.TaskQueue
+}
+
+func openDB(cmd *cobra.Command) (taskDB, error) {
+	dbType, err := cmd.Flags().GetString("db")
+	if err != nil {
+		return nil, err
+	}
+	dataDir, err := cmd.Flags().GetString("data-dir")
+	if err != nil {
+		return nil, err
+	}
+
+	switch dbType {
+	case "memory":
+		return databases.NewMemTaskDB(), nil
+	case "file":
+		return databases.OpenFileTaskDB(dataDir)
+	default:
+		return nil, errors.Errorf("--db must be memory or file: %s", dbType)
+	}
+}
@@ -0,0 +1,32 @@
+package cmdutils
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var longUnitRegexp = regexp.MustCompile(`([0-9]*\.?[0-9]+)([dw])`)
+
+// ParseDuration parses a duration string.
+// In addition to the units of time.ParseDuration(), it accepts "d" (day) and "w" (week).
+//
+//	Example: "7d", "1w2d", "36h", "1d12h"
+func ParseDuration(s string) (time.Duration, error) {
+	s = longUnitRegexp.ReplaceAllStringFunc(s, func(token string) string {
+		m := longUnitRegexp.FindStringSubmatch(token)
+		n, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			// Keep the token.  time.ParseDuration() will report an error.
+			return token
+		}
+		switch m[2] {
+		case "d":
+			n *= 24
+		case "w":
+			n *= 24 * 7
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64) + "h"
+	})
+	return time.ParseDuration(s)
+}
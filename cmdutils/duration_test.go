@@ -0,0 +1,37 @@
+package cmdutils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	t.Run("should_accept_standard_units", func(t *testing.T) {
+		d, err := ParseDuration("1h30m")
+		assert.NoError(t, err)
+		assert.Equal(t, 90*time.Minute, d)
+	})
+
+	t.Run("should_accept_days_and_weeks", func(t *testing.T) {
+		d, err := ParseDuration("7d")
+		assert.NoError(t, err)
+		assert.Equal(t, 7*24*time.Hour, d)
+
+		d, err = ParseDuration("1w1d12h")
+		assert.NoError(t, err)
+		assert.Equal(t, (8*24+12)*time.Hour, d)
+
+		d, err = ParseDuration("1.5d")
+		assert.NoError(t, err)
+		assert.Equal(t, 36*time.Hour, d)
+	})
+
+	t.Run("should_fail_when_invalid_duration", func(t *testing.T) {
+		_, err := ParseDuration("7days")
+		assert.Error(t, err)
+
+		_, err = ParseDuration("")
+		assert.Error(t, err)
+	})
+}
@@ -3,14 +3,26 @@ package config
 import (
 	"errors"
 	"fmt"
+	"github.com/yuuki0xff/clustertest/cmdutils"
 	"github.com/yuuki0xff/clustertest/models"
 	"github.com/yuuki0xff/yaml"
+	"time"
 )
 
 type Config struct {
 	Version int
 	Name    string
 	Specs_  []*SpecConfig `yaml:"specs"`
+	// (Optional) Duration to keep the infrastructure after a script failed (e.g. "30m").
+	HoldOnFailure_ string `yaml:"hold_on_failure"`
+	// Contents of the local files encoded in base64.  It is appended by AttachLocalFiles() on submission.
+	LocalFiles_ map[string]string `yaml:"local_files"`
+	// Variables to render the config.  It is removed by Render(), so the loaded config must not have it.
+	Vars_ interface{} `yaml:"vars"`
+
+	HoldOnFailure time.Duration `yaml:"-"`
+	// Contents of the local files referred by the scripts.  The keys are the paths written in the config.
+	LocalFiles map[string][]byte `yaml:"-"`
 }
 
 func (c *Config) String() string {
@@ -24,18 +36,59 @@ func (c *Config) Specs() []models.Spec {
 	return specs
 }
 func (c *Config) init() error {
+	if errs := c.validateFields(); len(errs) > 0 {
+		// Report the first problem.  Validate() reports all problems.
+		return errors.New(errs[0].Message)
+	}
+	if c.HoldOnFailure_ != "" {
+		// Already validated.
+		c.HoldOnFailure, _ = cmdutils.ParseDuration(c.HoldOnFailure_)
+	}
+	// Already validated.
+	c.LocalFiles, _ = decodeLocalFiles(c.LocalFiles_)
+	return nil
+}
+
+// validateFields checks the top-level fields of the config.  It is shared by init() and Validate().
+func (c *Config) validateFields() models.ValidationErrors {
+	var errs models.ValidationErrors
 	if c.Version != 1 {
-		return fmt.Errorf("unsupported config version: %d", c.Version)
+		errs.Add("version", "unsupported config version: %d", c.Version)
 	}
 	if c.Name == "" {
-		return errors.New("the Config.Name is empty")
+		errs.Add("name", "the Config.Name is empty")
 	}
 	if len(c.Specs_) == 0 {
-		return errors.New("the Config.Specs is empty")
+		errs.Add("specs", "the Config.Specs is empty")
 	}
-	return nil
+	if c.HoldOnFailure_ != "" {
+		if _, err := cmdutils.ParseDuration(c.HoldOnFailure_); err != nil {
+			errs.Add("hold_on_failure", "invalid Config.HoldOnFailure: %s", err)
+		}
+	}
+	if _, err := decodeLocalFiles(c.LocalFiles_); err != nil {
+		errs.Add("local_files", "%s", err)
+	}
+	if c.Vars_ != nil {
+		errs.Add("vars", "the config is not rendered (submit the task by the clustertest command)")
+	}
+	return errs
+}
+
+// LoadNameFromBytes returns the name of the config without validation.
+func LoadNameFromBytes(b []byte) (string, error) {
+	conf := &struct {
+		Name string
+	}{}
+	err := yaml.Unmarshal(b, conf)
+	if err != nil {
+		return "", err
+	}
+	return conf.Name, nil
 }
 
+// LoadFromBytes loads the config.  It does not render the config, so the config that has the "vars" section must be
+// rendered by Render() or ReadFile() before loading.
 func LoadFromBytes(b []byte) (*Config, error) {
 	conf := &Config{}
 	err := yaml.Unmarshal(b, conf)
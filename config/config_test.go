@@ -77,6 +77,18 @@ specs:
 		assert.Equal(t, "c", s.Nested.NestedField1)
 	})
 }
+func TestLoadNameFromBytes(t *testing.T) {
+	t.Run("should_return_name_of_invalid_config", func(t *testing.T) {
+		name, err := LoadNameFromBytes([]byte(`
+version: 1
+name: test_config
+specs:
+- type: unknown_spec
+`))
+		assert.NoError(t, err)
+		assert.Equal(t, "test_config", name)
+	})
+}
 
 func init() {
 	SpecInitializers[models.SpecType("fake_spec")] = func() models.Spec { return &fakeSpec{} }
@@ -98,6 +110,14 @@ func (s *fakeSpec) String() string {
 func (*fakeSpec) Type() models.SpecType {
 	return models.SpecType("fake_spec")
 }
+func (s *fakeSpec) Validate() models.ValidationErrors {
+	var errs models.ValidationErrors
+	if s.FakeField1 == "" {
+		errs.Add("fake_field1", "must not be empty")
+	}
+	errs.Extend("scripts", s.Scripts.Validate())
+	return errs
+}
 
 type fakeScript struct {
 	FakeField1 string `yaml:"fake_field1"`
@@ -105,6 +125,8 @@ type fakeScript struct {
 	Nested     struct {
 		NestedField1 string `yaml:"nested_field1"`
 	}
+	// Path to the local file.
+	File string `yaml:"file"`
 }
 
 func (s *fakeScript) String() string {
@@ -119,3 +141,13 @@ func (*fakeScript) SetAttr(key, value interface{}) {
 func (*fakeScript) GetAttr(key interface{}) interface{} {
 	panic("not implemented")
 }
+func (s *fakeScript) LocalFiles() []string {
+	return []string{s.File}
+}
+func (s *fakeScript) Validate() models.ValidationErrors {
+	var errs models.ValidationErrors
+	if s.FakeField1 == "" {
+		errs.Add("fake_field1", "must not be empty")
+	}
+	return errs
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/yuuki0xff/clustertest/models"
+	"github.com/yuuki0xff/yaml"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// localFilesKey is the top-level key of the section that has the contents of the local files.
+const localFilesKey = "local_files"
+
+// AttachLocalFiles reads the local files referred by the scripts in the config (e.g. the "src" of the upload
+// scripts), and appends their contents to the config.  The relative paths are relative to the dir.
+// The files are appended to the end of the document as the "local_files" section, so the line numbers of other
+// fields are kept.  The daemon uses the attached contents instead of reading the files.
+func AttachLocalFiles(b []byte, dir string) ([]byte, error) {
+	var doc map[interface{}]interface{}
+	if yaml.Unmarshal(b, &doc) != nil {
+		// The syntax errors are reported on loading the config.
+		return b, nil
+	}
+	if _, ok := doc[localFilesKey]; ok {
+		return nil, errors.Errorf("the %s section is reserved", localFilesKey)
+	}
+
+	paths := map[string]bool{}
+	collectLocalFiles(doc, paths)
+	if len(paths) == 0 {
+		return b, nil
+	}
+	var names []string
+	for p := range paths {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+
+	var out strings.Builder
+	out.Write(b)
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		out.WriteString("\n")
+	}
+	out.WriteString(localFilesKey + ":\n")
+	for _, name := range names {
+		content, err := ioutil.ReadFile(joinPath(dir, name))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the local file")
+		}
+		fmt.Fprintf(&out, "  %s: %s\n", strconv.Quote(name), base64.StdEncoding.EncodeToString(content))
+	}
+	return []byte(out.String()), nil
+}
+
+// collectLocalFiles finds the scripts in the v, and adds the paths of the local files referred by them.
+func collectLocalFiles(v interface{}, paths map[string]bool) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		if t, ok := v["type"].(string); ok {
+			if _, ok := ScriptInitializers[models.ScriptType(t)]; ok {
+				addLocalFiles(v, paths)
+				return
+			}
+		}
+		for _, value := range v {
+			collectLocalFiles(value, paths)
+		}
+	case []interface{}:
+		for _, value := range v {
+			collectLocalFiles(value, paths)
+		}
+	}
+}
+
+// addLocalFiles decodes the script, and adds the paths of the local files referred by it.
+func addLocalFiles(m map[interface{}]interface{}, paths map[string]bool) {
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		return
+	}
+	c := &ScriptConfig{}
+	if yaml.Unmarshal(b, c) != nil {
+		// The invalid script is reported on loading the config.
+		return
+	}
+	r, ok := c.Data.(models.LocalFileReferrer)
+	if !ok {
+		return
+	}
+	for _, p := range r.LocalFiles() {
+		if p != "" {
+			paths[p] = true
+		}
+	}
+}
+
+// decodeLocalFiles decodes the contents of the files in the "local_files" section.
+func decodeLocalFiles(encoded map[string]string) (map[string][]byte, error) {
+	if encoded == nil {
+		return nil, nil
+	}
+	files := map[string][]byte{}
+	for name, s := range encoded {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid local file: %s", name)
+		}
+		files[name] = b
+	}
+	return files, nil
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttachLocalFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clustertest-config-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "build"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "build", "server"), []byte("binary\x00data"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "it's.conf"), []byte("conf"), 0644)
+
+	t.Run("should_attach_local_files", func(t *testing.T) {
+		data := `version: 1
+name: test_config
+specs:
+- type: fake_spec
+  fake_field1: foo
+  scripts:
+    before:
+      type: fake_script
+      file: build/server
+    main:
+      type: fake_script
+      file: "it's.conf"`
+		b, err := AttachLocalFiles([]byte(data), dir)
+		if !assert.NoError(t, err) {
+			return
+		}
+		// The original lines are kept.
+		assert.True(t, strings.HasPrefix(string(b), data+"\n"))
+
+		conf, err := LoadFromBytes(b)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, map[string][]byte{
+			"build/server": []byte("binary\x00data"),
+			"it's.conf":    []byte("conf"),
+		}, conf.LocalFiles)
+	})
+
+	t.Run("should_not_change_config_without_local_files", func(t *testing.T) {
+		data := []byte("version: 1\nname: test_config\n")
+		b, err := AttachLocalFiles(data, dir)
+		assert.NoError(t, err)
+		assert.Equal(t, data, b)
+	})
+
+	t.Run("should_fail_when_file_is_not_found", func(t *testing.T) {
+		_, err := AttachLocalFiles([]byte(`
+specs:
+- scripts:
+    main:
+      type: fake_script
+      file: not-found
+`), dir)
+		assert.Error(t, err)
+	})
+
+	t.Run("should_fail_when_local_files_are_written", func(t *testing.T) {
+		_, err := AttachLocalFiles([]byte("local_files: {}\n"), dir)
+		assert.EqualError(t, err, "the local_files section is reserved")
+	})
+}
@@ -0,0 +1,294 @@
+package config
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/yuuki0xff/yaml"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// ReadFile reads the config file and renders it with the variables.  See Render() for details of variables.
+// It also merges the files referred by "include" and "extends" in the config, and returns the merged config.
+//
+// The top-level "include" is a path or a list of paths to config files.  They are merged in order, and the fields in
+// the config override them.  The "extends" in a spec is a path to a file that has the base fields of the spec.
+// The paths are relative to the file that refers them.  Mappings are merged recursively, and other values (including
+// sequences) are replaced.  The included files are rendered with the variables of the config.
+func ReadFile(path string, overrides Vars) ([]byte, Vars, error) {
+	b, vars, _, err := readFile(path, overrides)
+	return b, vars, err
+}
+
+// readFile is ReadFile that also returns the files merged into the config.  The origins is nil if no files were
+// merged.  If merged, the config is re-encoded, so the line numbers in the result do not match the files.  Use the
+// origins to find the positions of fields.
+func readFile(path string, overrides Vars) (b []byte, vars Vars, o origins, err error) {
+	b, err = ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	b, vars, err = Render(b, overrides)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var doc map[interface{}]interface{}
+	if yaml.Unmarshal(b, &doc) != nil || !hasIncludes(doc) {
+		// Nothing to merge.  The syntax errors are reported on loading the config.
+		return b, vars, nil, nil
+	}
+	r := &includeResolver{vars: vars}
+	doc, o, err = r.resolveConfig(path, doc, newLineIndex(b))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	b, err = yaml.Marshal(doc)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return b, vars, o, nil
+}
+
+// origin is a file merged into the config.
+type origin struct {
+	file string
+	// Path to the field in the merged config that the root of the file is merged into (e.g. "specs[0]" for the file
+	// referred by "extends").  It is empty for the config and the included files.
+	prefix string
+	lines  lineIndex
+}
+
+// relPath converts the path to the field in the merged config into the path in the file.
+func (o *origin) relPath(path string) (string, bool) {
+	switch {
+	case o.prefix == "":
+		return path, true
+	case strings.HasPrefix(path, o.prefix+"."):
+		return path[len(o.prefix)+1:], true
+	default:
+		return "", false
+	}
+}
+
+// origins is the list of files merged into the config.  It is sorted by priority in descending order, so the first
+// file that has a field is the file that the value of the field came from.
+type origins []*origin
+
+// Lookup returns the file and the line number of the field in the merged config.
+// If the field is not found, it returns the position of the nearest ancestor.  It returns an empty file if unknown.
+func (o origins) Lookup(path string) (string, int) {
+	for ; path != ""; path = parentPath(path) {
+		for _, f := range o {
+			rel, ok := f.relPath(path)
+			if !ok {
+				continue
+			}
+			if line, ok := f.lines[rel]; ok {
+				return f.file, line
+			}
+		}
+	}
+	return "", 0
+}
+
+// hasIncludes returns true if the config refers other files.
+func hasIncludes(doc map[interface{}]interface{}) bool {
+	if _, ok := doc["include"]; ok {
+		return true
+	}
+	specs, _ := doc["specs"].([]interface{})
+	for _, s := range specs {
+		if m, ok := s.(map[interface{}]interface{}); ok {
+			if _, ok := m["extends"]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// includeResolver merges the files referred by "include" and "extends".
+type includeResolver struct {
+	vars Vars
+	// Absolute paths of files being resolved to detect circular references.
+	stack []string
+}
+
+// resolveConfig merges the files referred by the config at the path.  The lines is the index of the config.
+// It returns the merged config and the files merged into it.
+func (r *includeResolver) resolveConfig(path string, doc map[interface{}]interface{}, lines lineIndex) (map[interface{}]interface{}, origins, error) {
+	if err := r.push(path); err != nil {
+		return nil, nil, err
+	}
+	defer r.pop()
+	dir := filepath.Dir(path)
+
+	// The files merged by "include".  The later files override the earlier ones.
+	var included origins
+	if inc, ok := doc["include"]; ok {
+		delete(doc, "include")
+		paths, err := stringList(inc)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid include in %s", path)
+		}
+		base := map[interface{}]interface{}{}
+		for _, p := range paths {
+			p = joinPath(dir, p)
+			inc, incLines, err := r.load(p)
+			if err != nil {
+				return nil, nil, err
+			}
+			inc, incOrigins, err := r.resolveConfig(p, inc, incLines)
+			if err != nil {
+				return nil, nil, err
+			}
+			base = mergeMap(base, inc)
+			included = append(incOrigins, included...)
+		}
+		doc = mergeMap(base, doc)
+	}
+
+	// The files merged by "extends".  They are overridden by this file, and override the included files.
+	var extended origins
+	specs, _ := doc["specs"].([]interface{})
+	for i, s := range specs {
+		m, ok := s.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		spec, o, err := r.resolveSpec(path, fmt.Sprintf("specs[%d]", i), m)
+		if err != nil {
+			return nil, nil, err
+		}
+		specs[i] = spec
+		extended = append(extended, o...)
+	}
+
+	o := origins{{file: path, lines: lines}}
+	o = append(o, extended...)
+	o = append(o, included...)
+	return doc, o, nil
+}
+
+// resolveSpec merges the file referred by "extends" of the spec.  The path is the file that has the spec, and the
+// field is the path to the spec in the merged config.  It returns the merged spec and the files merged into it.
+func (r *includeResolver) resolveSpec(path, field string, spec map[interface{}]interface{}) (map[interface{}]interface{}, origins, error) {
+	ext, ok := spec["extends"]
+	if !ok {
+		return spec, nil, nil
+	}
+	delete(spec, "extends")
+	p, ok := ext.(string)
+	if !ok || p == "" {
+		return nil, nil, errors.Errorf("invalid extends in %s: must be a path", path)
+	}
+	p = joinPath(filepath.Dir(path), p)
+
+	if err := r.push(p); err != nil {
+		return nil, nil, err
+	}
+	defer r.pop()
+	base, lines, err := r.load(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The base can extend another file.
+	base, o, err := r.resolveSpec(p, field, base)
+	if err != nil {
+		return nil, nil, err
+	}
+	o = append(origins{{file: p, prefix: field, lines: lines}}, o...)
+	return mergeMap(base, spec), o, nil
+}
+
+// load reads the included file and renders it with the variables of the config.
+// It returns the parsed file and the index of it.
+func (r *includeResolver) load(path string) (map[interface{}]interface{}, lineIndex, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.vars != nil {
+		if _, _, ok := varsSection(b); ok {
+			return nil, nil, errors.Errorf("failed to load %s: the vars section is allowed only in the root config", path)
+		}
+		b, err = renderTemplate(string(b), r.vars)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to load %s", path)
+		}
+	}
+
+	var doc map[interface{}]interface{}
+	err = yaml.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to load %s", path)
+	}
+	if doc == nil {
+		doc = map[interface{}]interface{}{}
+	}
+	return doc, newLineIndex(b), nil
+}
+func (r *includeResolver) push(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for _, p := range r.stack {
+		if p == abs {
+			return errors.Errorf("circular reference: %s", strings.Join(append(r.stack, abs), " -> "))
+		}
+	}
+	r.stack = append(r.stack, abs)
+	return nil
+}
+func (r *includeResolver) pop() {
+	r.stack = r.stack[:len(r.stack)-1]
+}
+
+// mergeMap returns a new mapping that the fields in the override are merged into the base.
+func mergeMap(base, override map[interface{}]interface{}) map[interface{}]interface{} {
+	m := map[interface{}]interface{}{}
+	for k, v := range base {
+		m[k] = v
+	}
+	for k, v := range override {
+		bm, ok1 := m[k].(map[interface{}]interface{})
+		om, ok2 := v.(map[interface{}]interface{})
+		if ok1 && ok2 {
+			m[k] = mergeMap(bm, om)
+		} else {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// stringList converts a string or a list of strings into []string.
+func stringList(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		var ss []string
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, errors.Errorf("must be a path or a list of paths")
+			}
+			ss = append(ss, s)
+		}
+		return ss, nil
+	default:
+		return nil, errors.Errorf("must be a path or a list of paths")
+	}
+}
+
+// joinPath resolves the path relative to the dir.
+func joinPath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
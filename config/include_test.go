@@ -0,0 +1,126 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clustertest-config-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	writeFile("shared/common.yaml", `
+version: 1
+hold_on_failure: 10m
+`)
+	writeFile("shared/base-spec.yaml", `
+extends: base-base-spec.yaml
+fake_field1: base
+nested:
+  nested_field1: base
+`)
+	writeFile("shared/base-base-spec.yaml", `
+type: fake_spec
+fake_field2: base-base
+`)
+
+	t.Run("should_merge_included_files", func(t *testing.T) {
+		path := writeFile("configs/clustertest.yaml", `
+include: ../shared/common.yaml
+name: test_config
+vars:
+  field: overridden
+specs:
+- extends: ../shared/base-spec.yaml
+  fake_field1: "{{ .Vars.field }}"
+`)
+		b, vars, err := ReadFile(path, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, Vars{"field": "overridden"}, vars)
+		conf, err := LoadFromBytes(b)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "test_config", conf.Name)
+		assert.Equal(t, "10m0s", conf.HoldOnFailure.String())
+		f := conf.Specs()[0].(*fakeSpec)
+		assert.Equal(t, "overridden", f.FakeField1)
+		assert.Equal(t, "base-base", f.FakeField2)
+		assert.Equal(t, "base", f.Nested.NestedField1)
+	})
+
+	t.Run("should_not_change_config_without_includes", func(t *testing.T) {
+		data := "version: 1\n# comment\nname: test_config\n"
+		path := writeFile("plain.yaml", data)
+		b, _, err := ReadFile(path, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, data, string(b))
+	})
+
+	t.Run("should_fail_when_circular_reference", func(t *testing.T) {
+		writeFile("loop-a.yaml", "include: loop-b.yaml\n")
+		writeFile("loop-b.yaml", "include: [loop-a.yaml]\n")
+		_, _, err := ReadFile(filepath.Join(dir, "loop-a.yaml"), nil)
+		assert.EqualError(t, err, "circular reference: "+
+			filepath.Join(dir, "loop-a.yaml")+" -> "+
+			filepath.Join(dir, "loop-b.yaml")+" -> "+
+			filepath.Join(dir, "loop-a.yaml"))
+	})
+
+	t.Run("should_report_problems_at_merged_files", func(t *testing.T) {
+		common := writeFile("shared/invalid-common.yaml", `
+version: 1
+hold_on_failure: soon
+`)
+		base := writeFile("shared/invalid-base-spec.yaml", `
+extends: base-base-spec.yaml
+fake_field1: base
+scripts:
+  before:
+    type: unknown_script
+  main:
+    type: fake_script
+`)
+		path := writeFile("invalid.yaml", `
+include: shared/invalid-common.yaml
+name: test_config
+specs:
+- extends: shared/base-base-spec.yaml
+- extends: shared/invalid-base-spec.yaml
+  scripts:
+    main:
+      fake_field2: b
+`)
+		assert.Equal(t, []*Problem{
+			{File: path, Line: 5, Field: "specs[0].fake_field1", Message: "must not be empty"},
+			{File: path, Line: 8, Field: "specs[1].scripts.main.fake_field1", Message: "must not be empty"},
+			{File: base, Line: 6, Message: "unsupported type: unknown_script"},
+			{File: common, Line: 3, Field: "hold_on_failure", Message: `invalid Config.HoldOnFailure: time: invalid duration "soon"`},
+		}, ValidateFile(path, nil))
+	})
+
+	t.Run("should_report_problems_with_file_without_includes", func(t *testing.T) {
+		path := writeFile("invalid-plain.yaml", "version: 1\nname: test_config\nspecs:\n- type: fake_spec\n  fake_field1: foo\nhold_on_failure: soon\n")
+		assert.Equal(t, []*Problem{
+			{File: path, Line: 6, Field: "hold_on_failure", Message: `invalid Config.HoldOnFailure: time: invalid duration "soon"`},
+		}, ValidateFile(path, nil))
+	})
+}
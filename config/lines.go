@@ -0,0 +1,231 @@
+package config
+
+import (
+	"fmt"
+	"github.com/yuuki0xff/clustertest/models"
+	"github.com/yuuki0xff/yaml"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// linePattern matches the line number in the error messages of the yaml package.
+var linePattern = regexp.MustCompile(`(?s)^(?:yaml: )?line (\d+): (.*)$`)
+
+// withLine converts the err to *yaml.TypeError with the line number of the node being unmarshaled.
+// The yaml package continues decoding other nodes when the *yaml.TypeError is returned, so all errors in the
+// document are reported at once.
+func withLine(unmarshal func(interface{}) error, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*yaml.TypeError); ok {
+		// It already has line numbers.
+		return err
+	}
+	line := nodeLine(unmarshal)
+	if line == 0 {
+		return &yaml.TypeError{Errors: []string{err.Error()}}
+	}
+	return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: %s", line, err)}}
+}
+
+// nodeLine returns the line number of the node being unmarshaled.  It returns zero if unknown.
+// The yaml package does not expose the position of nodes, so it is taken from the error of unmarshaling the node
+// into an incompatible type.
+func nodeLine(unmarshal func(interface{}) error) int {
+	var probe int
+	err := unmarshal(&probe)
+	if terr, ok := err.(*yaml.TypeError); ok && len(terr.Errors) > 0 {
+		line, _ := splitLine(terr.Errors[0])
+		return line
+	}
+	return 0
+}
+
+// splitLine splits the error message of the yaml package into the line number and the message.
+// The line number is zero if the message does not have it.
+func splitLine(msg string) (int, string) {
+	m := linePattern.FindStringSubmatch(msg)
+	if m == nil {
+		return 0, msg
+	}
+	line, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, msg
+	}
+	return line, m[2]
+}
+
+// lineIndex maps the paths to fields (e.g. "specs[0].vms.web.nodes") to line numbers in the YAML document.
+// It supports the block style used in config files.  The children of values in the flow style (e.g. "{a: 1}") are
+// not indexed, so Lookup() returns the line of the parent.
+type lineIndex map[string]int
+
+// lineEntry is a mapping key or a sequence item in the current path.
+type lineEntry struct {
+	col    int
+	path   string
+	isItem bool
+	// Number of sequence items found in the children.
+	items int
+}
+
+// newLineIndex scans the YAML document and builds the lineIndex.
+func newLineIndex(data []byte) lineIndex {
+	idx := lineIndex{}
+	var stack []*lineEntry
+	// Lines indented deeper than this column are the contents of a block scalar.  It is -1 outside of block scalars.
+	blockCol := -1
+
+	for i, text := range strings.Split(string(data), "\n") {
+		lineNo := i + 1
+		text = strings.TrimRight(text, " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		col := len(text) - len(trimmed)
+
+		if blockCol >= 0 {
+			if trimmed == "" || col > blockCol {
+				continue
+			}
+			blockCol = -1
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "---") || strings.HasPrefix(trimmed, "%") {
+			continue
+		}
+
+		// Sequence items.  A line can start with multiple items (e.g. "- - a").
+		for trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			for len(stack) > 0 {
+				top := stack[len(stack)-1]
+				if top.col > col || (top.col == col && top.isItem) {
+					stack = stack[:len(stack)-1]
+					continue
+				}
+				break
+			}
+			parent := &lineEntry{col: -1}
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			e := &lineEntry{
+				col:    col,
+				path:   fmt.Sprintf("%s[%d]", parent.path, parent.items),
+				isItem: true,
+			}
+			parent.items++
+			stack = append(stack, e)
+			idx.add(e.path, lineNo)
+
+			rest := strings.TrimLeft(trimmed[1:], " ")
+			col += len(trimmed) - len(rest)
+			trimmed = rest
+		}
+		if trimmed == "" {
+			continue
+		}
+
+		key, value, ok := splitKey(trimmed)
+		if !ok {
+			// Scalar value.
+			if isBlockScalar(trimmed) && len(stack) > 0 {
+				blockCol = stack[len(stack)-1].col
+			}
+			continue
+		}
+		for len(stack) > 0 && stack[len(stack)-1].col >= col {
+			stack = stack[:len(stack)-1]
+		}
+		var parentPath string
+		if len(stack) > 0 {
+			parentPath = stack[len(stack)-1].path
+		}
+		e := &lineEntry{
+			col:  col,
+			path: models.JoinFieldPath(parentPath, key),
+		}
+		stack = append(stack, e)
+		idx.add(e.path, lineNo)
+
+		if isBlockScalar(value) {
+			blockCol = col
+		}
+	}
+	return idx
+}
+func (idx lineIndex) add(path string, line int) {
+	if _, ok := idx[path]; !ok {
+		idx[path] = line
+	}
+}
+
+// Lookup returns the line number of the field.
+// If the field is not found, it returns the line number of the nearest ancestor.  It returns zero if unknown.
+func (idx lineIndex) Lookup(path string) int {
+	for ; path != ""; path = parentPath(path) {
+		if line, ok := idx[path]; ok {
+			return line
+		}
+	}
+	return 0
+}
+
+// PathAt returns the path to the deepest field that starts at the line.  It returns an empty string if unknown.
+func (idx lineIndex) PathAt(line int) string {
+	var found string
+	for path, l := range idx {
+		if l == line && len(path) > len(found) {
+			found = path
+		}
+	}
+	return found
+}
+
+// parentPath returns the path to the parent of the field.  It returns an empty string if the field is top-level.
+func parentPath(path string) string {
+	i := strings.LastIndexAny(path, ".[")
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+// splitKey splits the "key: value" into the key and the value.
+func splitKey(s string) (key, value string, ok bool) {
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, `'`) {
+		end := strings.IndexByte(s[1:], s[0])
+		if end < 0 {
+			return "", "", false
+		}
+		key = s[1 : end+1]
+		rest := s[end+2:]
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(rest[1:]), true
+	}
+	if strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[") {
+		// Flow style.
+		return "", "", false
+	}
+
+	if strings.HasSuffix(s, ":") && !strings.Contains(s, ": ") {
+		return s[:len(s)-1], "", true
+	}
+	i := strings.Index(s, ": ")
+	if i < 0 || strings.Contains(s[:i], " #") {
+		return "", "", false
+	}
+	return s[:i], strings.TrimSpace(s[i+2:]), true
+}
+
+// isBlockScalar returns true if the value starts a literal or folded block scalar (e.g. "|", ">-").
+func isBlockScalar(value string) bool {
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	if value == "" || (value[0] != '|' && value[0] != '>') {
+		return false
+	}
+	return strings.Trim(value[1:], "+-0123456789") == ""
+}
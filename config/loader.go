@@ -2,7 +2,6 @@ package config
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path"
 )
@@ -42,10 +41,11 @@ func FindConfigFromDirsOrFiles(paths []string) ([]string, error) {
 }
 
 // Load config files from files.
+// The files referred by "include" and "extends" in the configs are merged.  See ReadFile() for details.
 func LoadFromFiles(files []string) ([]*Config, error) {
 	var confs []*Config
 	for _, file := range files {
-		b, err := ioutil.ReadFile(file)
+		b, _, err := ReadFile(file, nil)
 		if err != nil {
 			return nil, err
 		}
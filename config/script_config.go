@@ -14,6 +14,9 @@ type ScriptConfigSet struct {
 	Before *ScriptConfig
 	Main   *ScriptConfig
 	After  *ScriptConfig
+	// (Optional) Paths of files to collect from hosts after the scripts finished or failed.
+	// The paths can contain glob patterns (e.g. "/var/log/*.log").
+	Artifacts []string
 }
 
 type ScriptConfig struct {
@@ -22,7 +25,7 @@ type ScriptConfig struct {
 }
 
 func (c *ScriptConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	return cmdutils.UnmarshalYAMLInterface(unmarshal, func(typeName string) (concrete interface{}, err error) {
+	err := cmdutils.UnmarshalYAMLInterface(unmarshal, func(typeName string) (concrete interface{}, err error) {
 		t := models.ScriptType(typeName)
 		fn, ok := ScriptInitializers[t]
 		if ok {
@@ -32,6 +35,16 @@ func (c *ScriptConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		}
 		return nil, fmt.Errorf("unsupported type: %s", typeName)
 	})
+	return withLine(unmarshal, err)
+}
+
+// Validate checks the script and returns all problems.
+func (c *ScriptConfig) Validate() models.ValidationErrors {
+	if c == nil || c.Data == nil {
+		// The script is not specified, or the unsupported type was already reported by the decoder.
+		return nil
+	}
+	return c.Data.Validate()
 }
 func (c *ScriptConfig) SetAttrs(attrs map[interface{}]interface{}) *ScriptConfig {
 	s := c.Get()
@@ -48,3 +61,20 @@ func (c *ScriptConfig) Get() models.Script {
 	}
 	return c.Data
 }
+
+// Validate checks all scripts in the set and returns all problems.
+func (c *ScriptConfigSet) Validate() models.ValidationErrors {
+	if c == nil {
+		return nil
+	}
+	var errs models.ValidationErrors
+	errs.Extend("before", c.Before.Validate())
+	errs.Extend("main", c.Main.Validate())
+	errs.Extend("after", c.After.Validate())
+	for i, a := range c.Artifacts {
+		if a == "" {
+			errs.Add(fmt.Sprintf("artifacts[%d]", i), "must not be empty")
+		}
+	}
+	return errs
+}
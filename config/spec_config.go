@@ -16,7 +16,7 @@ type SpecConfig struct {
 }
 
 func (c *SpecConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	return cmdutils.UnmarshalYAMLInterface(unmarshal, func(typeName string) (concrete interface{}, err error) {
+	err := cmdutils.UnmarshalYAMLInterface(unmarshal, func(typeName string) (concrete interface{}, err error) {
 		t := models.SpecType(typeName)
 		fn, ok := SpecInitializers[t]
 		if ok {
@@ -26,4 +26,5 @@ func (c *SpecConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		}
 		return nil, fmt.Errorf("unsupported SpecType: %s", typeName)
 	})
+	return withLine(unmarshal, err)
 }
@@ -16,7 +16,7 @@ extra: fields
 `)
 
 		err := yaml.Unmarshal(data, c)
-		assert.EqualError(t, err, "unsupported SpecType: invalid-type")
+		assert.EqualError(t, err, "yaml: unmarshal errors:\n  line 2: unsupported SpecType: invalid-type")
 		assert.Nil(t, c.Data)
 	})
 
@@ -62,6 +62,9 @@ func (*emptySpec) String() string {
 func (*emptySpec) Type() models.SpecType {
 	return models.SpecType("empty")
 }
+func (*emptySpec) Validate() models.ValidationErrors {
+	return nil
+}
 
 type testSpec struct {
 	ClusterAddress string `yaml:"cluster_address"`
@@ -75,3 +78,10 @@ func (*testSpec) String() string {
 func (*testSpec) Type() models.SpecType {
 	return models.SpecType("test")
 }
+func (s *testSpec) Validate() models.ValidationErrors {
+	var errs models.ValidationErrors
+	if s.Nodes <= 0 {
+		errs.Add("nodes", "must be larger than 0")
+	}
+	return errs
+}
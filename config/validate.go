@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"github.com/yuuki0xff/clustertest/models"
+	"github.com/yuuki0xff/yaml"
+	"sort"
+)
+
+// Problem is a problem found in the config file.
+type Problem struct {
+	// Path to the file that has the problem.  It is empty if the problem was found by ValidateBytes().
+	File string
+	// Line number in the file.  It is zero if unknown.
+	Line int
+	// Path to the field (e.g. "specs[0].vms.web.nodes").  It is empty if unknown.
+	Field   string
+	Message string
+}
+
+func (p *Problem) String() string {
+	if p.Field == "" {
+		return p.Message
+	}
+	return fmt.Sprintf("%s: %s", p.Field, p.Message)
+}
+
+// specsDocument is a config document to decode specs by ValidateBytes().
+type specsDocument struct {
+	Specs []*tolerantSpecConfig
+}
+
+// tolerantSpecConfig is the SpecConfig that ignores errors.  The errors are reported by decoding the Config.
+type tolerantSpecConfig struct {
+	*SpecConfig
+}
+
+func (c *tolerantSpecConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	c.SpecConfig = &SpecConfig{}
+	c.SpecConfig.UnmarshalYAML(unmarshal)
+	return nil
+}
+
+// Validate checks the config and all specs and scripts in it, and returns all problems.
+// Unlike init(), it does not stop at the first problem.
+func (c *Config) Validate() models.ValidationErrors {
+	errs := c.validateFields()
+	for i, s := range c.Specs_ {
+		field := fmt.Sprintf("specs[%d]", i)
+		if s == nil {
+			errs.Add(field, "must not be empty")
+			continue
+		}
+		if s.Data == nil {
+			// The unsupported type was already reported by the decoder.
+			continue
+		}
+		errs.Extend(field, s.Data.Validate())
+	}
+	return errs
+}
+
+// ValidateFile reads the config file by ReadFile() and returns all problems in it.
+// If the config includes other files, the problems are reported with the files and the lines that the fields came
+// from.  The problems are sorted by file and line number.
+func ValidateFile(path string, overrides Vars) []*Problem {
+	b, _, o, err := readFile(path, overrides)
+	if err != nil {
+		return []*Problem{{File: path, Message: err.Error()}}
+	}
+	problems := ValidateBytes(b)
+	if o == nil {
+		for _, p := range problems {
+			p.File = path
+		}
+		return problems
+	}
+
+	// The line numbers point to the merged config.  Find the fields in the merged files.
+	idx := newLineIndex(b)
+	for _, p := range problems {
+		field := p.Field
+		if field == "" {
+			field = idx.PathAt(p.Line)
+		}
+		p.File, p.Line = o.Lookup(field)
+		if p.File == "" {
+			p.File = path
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
+
+// ValidateBytes loads the config and returns all problems with line numbers, sorted by line number.
+// It returns nil if the config is valid.
+func ValidateBytes(b []byte) []*Problem {
+	var problems []*Problem
+	// Lines that have errors reported by the decoder.  The fields on these lines have zero values, so the validation
+	// problems on them are redundant.
+	decodeErrLines := map[int]bool{}
+
+	conf := &Config{}
+	err := yaml.Unmarshal(b, conf)
+	switch err := err.(type) {
+	case nil:
+	case *yaml.TypeError:
+		// Other fields are decoded.  Continue to validate them.
+		for _, msg := range err.Errors {
+			line, msg := splitLine(msg)
+			problems = append(problems, &Problem{Line: line, Message: msg})
+			decodeErrLines[line] = true
+		}
+	default:
+		// Syntax error.
+		line, msg := splitLine(err.Error())
+		return []*Problem{{Line: line, Message: msg}}
+	}
+
+	// The yaml package drops the sequence items that failed to decode.  Decode specs again without dropping them
+	// to keep the indexes of specs and to validate other fields of them.
+	doc := &specsDocument{}
+	yaml.Unmarshal(b, doc)
+	conf.Specs_ = nil
+	for _, s := range doc.Specs {
+		if s == nil {
+			conf.Specs_ = append(conf.Specs_, nil)
+			continue
+		}
+		conf.Specs_ = append(conf.Specs_, s.SpecConfig)
+	}
+
+	idx := newLineIndex(b)
+	for _, e := range conf.Validate() {
+		line := idx.Lookup(e.Field)
+		if line != 0 && decodeErrLines[line] {
+			continue
+		}
+		problems = append(problems, &Problem{
+			Line:    line,
+			Field:   e.Field,
+			Message: e.Message,
+		})
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateBytes(t *testing.T) {
+	t.Run("should_return_nil_when_valid_config", func(t *testing.T) {
+		problems := ValidateBytes([]byte(`
+version: 1
+name: test_config
+specs:
+- type: fake_spec
+  fake_field1: foo
+`))
+		assert.Nil(t, problems)
+	})
+
+	t.Run("should_report_all_problems_with_line_numbers", func(t *testing.T) {
+		problems := ValidateBytes([]byte(`version: 1
+name: test_config
+hold_on_failure: soon
+specs:
+- type: unknown_spec
+- type: fake_spec
+  scripts:
+    before:
+      type: unknown_script
+    main:
+      type: fake_script
+      fake_field2: b
+- type: fake_spec
+  fake_field1: foo
+`))
+		assert.Equal(t, []*Problem{
+			{Line: 3, Field: "hold_on_failure", Message: `invalid Config.HoldOnFailure: time: invalid duration "soon"`},
+			{Line: 5, Message: "unsupported SpecType: unknown_spec"},
+			{Line: 6, Field: "specs[1].fake_field1", Message: "must not be empty"},
+			{Line: 9, Message: "unsupported type: unknown_script"},
+			{Line: 10, Field: "specs[1].scripts.main.fake_field1", Message: "must not be empty"},
+		}, problems)
+	})
+
+	t.Run("should_report_syntax_error", func(t *testing.T) {
+		problems := ValidateBytes([]byte("version: 1\nname: [\n"))
+		if assert.Len(t, problems, 1) {
+			assert.Equal(t, 2, problems[0].Line)
+		}
+	})
+}
+
+func TestLineIndex_Lookup(t *testing.T) {
+	idx := newLineIndex([]byte(`# comment
+name: test
+specs:
+  - type: fake
+    vms:
+      web:
+        nodes: 0
+        scripts:
+          main:
+            commands:
+            - |
+              echo "key: value"
+            - "true"
+  - type: other
+    description: >-
+      nodes: 1
+    "quoted key": x
+`))
+	assert.Equal(t, 2, idx.Lookup("name"))
+	assert.Equal(t, 4, idx.Lookup("specs[0]"))
+	assert.Equal(t, 7, idx.Lookup("specs[0].vms.web.nodes"))
+	assert.Equal(t, 11, idx.Lookup("specs[0].vms.web.scripts.main.commands[0]"))
+	assert.Equal(t, 13, idx.Lookup("specs[0].vms.web.scripts.main.commands[1]"))
+	assert.Equal(t, 14, idx.Lookup("specs[1].type"))
+	assert.Equal(t, 17, idx.Lookup("specs[1].quoted key"))
+	// Falls back to the nearest ancestor.
+	assert.Equal(t, 6, idx.Lookup("specs[0].vms.web.processors"))
+	assert.Equal(t, 0, idx.Lookup("unknown"))
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/yuuki0xff/yaml"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Vars are variables to render the config.
+// The config refers them by the template syntax (e.g. "{{ .Vars.nodes }}").
+type Vars map[string]interface{}
+
+// templateData is the data passed to the config template.
+type templateData struct {
+	Vars Vars
+}
+
+// Render expands the templates in the config with the variables.
+// The variables are defined in the top-level "vars" section of the config, and the overrides replace their values.
+// It returns the rendered config and the resolved variables.
+//
+// The config without the "vars" section is returned as is, so the existing configs that contain "{{" are not broken.
+// In the config with the "vars" section, the literal "{{" is written as "\{{" (e.g. "docker ps --format '\{{.Names}}'").
+// The "vars" section must not contain templates.  It is removed from the rendered config, so rendering the result
+// again does nothing.
+//
+// The config is rendered only once by the clustertest command.  The daemon loads the rendered config as is.
+func Render(b []byte, overrides Vars) ([]byte, Vars, error) {
+	lines := strings.Split(string(b), "\n")
+	start, end, ok := varsSection(b)
+	if !ok {
+		if len(overrides) > 0 {
+			return nil, nil, errors.Errorf("undefined variable: %s", sortedVarNames(overrides)[0])
+		}
+		return b, nil, nil
+	}
+
+	section := &struct {
+		Vars Vars
+	}{}
+	err := yaml.Unmarshal([]byte(strings.Join(lines[start:end], "\n")), section)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid vars section")
+	}
+	vars := Vars{}
+	for k, v := range section.Vars {
+		vars[k] = normalizeValue(v)
+	}
+	for _, k := range sortedVarNames(overrides) {
+		if _, ok := vars[k]; !ok {
+			return nil, nil, errors.Errorf("undefined variable: %s", k)
+		}
+		vars[k] = normalizeValue(overrides[k])
+	}
+
+	// Replace the "vars" section with empty lines to keep line numbers of other fields.
+	for i := start; i < end; i++ {
+		lines[i] = ""
+	}
+	out, err := renderTemplate(strings.Join(lines, "\n"), vars)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, vars, nil
+}
+
+// renderTemplate renders the text as a template with the variables.  The escaped "\{{" is rendered as the literal "{{".
+func renderTemplate(text string, vars Vars) ([]byte, error) {
+	text = strings.Replace(text, `\{{`, `{{"{{"}}`, -1)
+	tmpl, err := template.New("config").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse template")
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, &templateData{Vars: vars})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to render template")
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseVar parses the "key=value".  The value is parsed as a YAML scalar (e.g. "5" is a number).
+func ParseVar(s string) (string, interface{}, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return "", nil, errors.Errorf("variable must be key=value: %s", s)
+	}
+	var value interface{}
+	err := yaml.Unmarshal([]byte(kv[1]), &value)
+	switch value.(type) {
+	case bool, int, int64, uint64, float64, string:
+		if err == nil {
+			return kv[0], value, nil
+		}
+	}
+	// Use the value as a string if it is not a scalar (e.g. "", "a: b" or "[a]").
+	return kv[0], kv[1], nil
+}
+
+// LoadVarsFile loads the YAML mapping of variables.
+func LoadVarsFile(path string) (Vars, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var vars Vars
+	err = yaml.Unmarshal(b, &vars)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid vars file: %s", path)
+	}
+	return vars, nil
+}
+
+// varsSection returns the range of lines [start, end) of the top-level "vars" section.
+// The section ends at the next top-level field.  The key can be quoted, and the value can be in any style (e.g.
+// "vars: {nodes: 3}").  The templates in other fields do not affect the detection.
+func varsSection(b []byte) (start, end int, ok bool) {
+	idx := newLineIndex(b)
+	line, ok := idx["vars"]
+	if !ok {
+		return 0, 0, false
+	}
+	end = len(strings.Split(string(b), "\n")) + 1
+	for path, l := range idx {
+		if l > line && l < end && parentPath(path) == "" && !strings.HasPrefix(path, "[") {
+			end = l
+		}
+	}
+	// Convert the line numbers into indexes.
+	return line - 1, end - 1, true
+}
+
+// normalizeValue converts the maps decoded by the yaml package into map[string]interface{}, so the value can be
+// encoded as JSON.
+func normalizeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, value := range v {
+			m[fmt.Sprint(k)] = normalizeValue(value)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeValue(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func sortedVarNames(vars Vars) []string {
+	var names []string
+	for k := range vars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	data := []byte(`version: 1
+name: test-{{ .Vars.suite }}
+vars:
+  suite: raft
+  nodes: 3
+  # comment
+  commands: [make, make test]
+specs:
+- type: fake_spec
+  fake_field1: "{{ .Vars.nodes }}"
+  scripts:
+    main:
+      type: fake_script
+      fake_field1: {{ range .Vars.commands }}{{ . }};{{ end }}
+`)
+
+	t.Run("should_render_with_vars", func(t *testing.T) {
+		b, vars, err := Render(data, Vars{"nodes": 5})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, Vars{
+			"suite":    "raft",
+			"nodes":    5,
+			"commands": []interface{}{"make", "make test"},
+		}, vars)
+		assert.Equal(t, `version: 1
+name: test-raft
+
+
+
+
+
+specs:
+- type: fake_spec
+  fake_field1: "5"
+  scripts:
+    main:
+      type: fake_script
+      fake_field1: make;make test;
+`, string(b))
+
+		// Rendering the result again does nothing.
+		b2, vars, err := Render(b, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, vars)
+		assert.Equal(t, b, b2)
+	})
+
+	t.Run("should_load_rendered_config", func(t *testing.T) {
+		b, _, err := Render(data, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		conf, err := LoadFromBytes(b)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "test-raft", conf.Name)
+		assert.Equal(t, "3", conf.Specs()[0].(*fakeSpec).FakeField1)
+	})
+
+	t.Run("should_not_load_config_without_rendering", func(t *testing.T) {
+		_, err := LoadFromBytes([]byte(`version: 1
+name: test-{{ .Vars.suite }}
+vars:
+  suite: raft
+specs:
+- type: fake_spec
+  fake_field1: foo
+`))
+		assert.EqualError(t, err, "the config is not rendered (submit the task by the clustertest command)")
+	})
+
+	t.Run("should_render_escaped_braces_as_literal", func(t *testing.T) {
+		b, _, err := Render([]byte(`vars:
+  format: json
+command: docker ps --format '\{{.Names}}' -o {{ .Vars.format }}
+`), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "\n\ncommand: docker ps --format '{{.Names}}' -o json\n", string(b))
+	})
+
+	t.Run("should_find_vars_section_in_any_style", func(t *testing.T) {
+		for data, expected := range map[string]string{
+			"name: test-{{ .Vars.suite }}\nvars: {suite: raft}\n":                       "name: test-raft\n\n",
+			"name: test-{{ .Vars.suite }}\n\"vars\":\n  suite: raft\n# comment\n":       "name: test-raft\n\n\n\n",
+			"---\n  vars: # comment\n    suite: raft\n  name: test-{{ .Vars.suite }}\n": "---\n\n\n  name: test-raft\n",
+			"specs:\n- vars: {}\n  name: '{{ .Vars.suite }}'\nvars:\n  suite: raft\n":   "specs:\n- vars: {}\n  name: 'raft'\n\n\n",
+		} {
+			b, vars, err := Render([]byte(data), nil)
+			if !assert.NoError(t, err, data) {
+				continue
+			}
+			assert.Equal(t, Vars{"suite": "raft"}, vars, data)
+			assert.Equal(t, expected, string(b), data)
+		}
+	})
+
+	t.Run("should_not_render_config_without_vars", func(t *testing.T) {
+		b := []byte("name: test\ncommand: docker ps --format '{{.Names}}'\n")
+		out, vars, err := Render(b, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, vars)
+		assert.Equal(t, b, out)
+	})
+
+	t.Run("should_fail_when_variable_is_undefined", func(t *testing.T) {
+		_, _, err := Render(data, Vars{"node": 5})
+		assert.EqualError(t, err, "undefined variable: node")
+		_, _, err = Render([]byte("name: test\n"), Vars{"node": 5})
+		assert.EqualError(t, err, "undefined variable: node")
+		_, _, err = Render([]byte("vars:\n  a: 1\nname: '{{ .Vars.b }}'\n"), nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestParseVar(t *testing.T) {
+	t.Run("should_parse_value_as_scalar", func(t *testing.T) {
+		for s, expected := range map[string]interface{}{
+			"nodes=5":         5,
+			"debug=true":      true,
+			"cmd=make test":   "make test",
+			"expr=a=b":        "a=b",
+			"empty=":          "",
+			"map=a: b":        "a: b",
+			"list=[1, 2]":     "[1, 2]",
+			"quoted='5'":      "5",
+			"version=19.04":   19.04,
+			"template=ubuntu": "ubuntu",
+		} {
+			_, value, err := ParseVar(s)
+			assert.NoError(t, err, s)
+			assert.Equal(t, expected, value, s)
+		}
+	})
+
+	t.Run("should_fail_without_equal", func(t *testing.T) {
+		_, _, err := ParseVar("nodes")
+		assert.EqualError(t, err, "variable must be key=value: nodes")
+	})
+}
@@ -0,0 +1,174 @@
+package databases
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"github.com/yuuki0xff/clustertest/models"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// artifactStore stores the artifacts of tasks.
+type artifactStore interface {
+	save(sid, name string, r io.Reader) error
+	list(sid string) ([]models.Artifact, error)
+	open(sid, name string) (io.ReadCloser, error)
+	// remove removes all artifacts of the task.
+	remove(sid string) error
+}
+
+// memArtifactStore keeps the artifacts in memory.
+type memArtifactStore struct {
+	m     sync.Mutex
+	files map[string]map[string][]byte
+}
+
+// fileArtifactStore saves the artifacts as files in the Dir/<task-id>/ directory.
+type fileArtifactStore struct {
+	Dir string
+}
+
+func newMemArtifactStore() *memArtifactStore {
+	return &memArtifactStore{
+		files: map[string]map[string][]byte{},
+	}
+}
+func (s *memArtifactStore) save(sid, name string, r io.Reader) error {
+	name, err := cleanArtifactName(name)
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.files[sid] == nil {
+		s.files[sid] = map[string][]byte{}
+	}
+	s.files[sid][name] = b
+	return nil
+}
+func (s *memArtifactStore) list(sid string) ([]models.Artifact, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	var artifacts []models.Artifact
+	for name, b := range s.files[sid] {
+		artifacts = append(artifacts, models.Artifact{
+			Name: name,
+			Size: int64(len(b)),
+		})
+	}
+	sortArtifacts(artifacts)
+	return artifacts, nil
+}
+func (s *memArtifactStore) open(sid, name string) (io.ReadCloser, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	b, ok := s.files[sid][name]
+	if !ok {
+		return nil, errors.Errorf("not found artifact: %s", name)
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+func (s *memArtifactStore) remove(sid string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	delete(s.files, sid)
+	return nil
+}
+
+func (s *fileArtifactStore) save(sid, name string, r io.Reader) error {
+	name, err := cleanArtifactName(name)
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(s.taskDir(sid), filepath.FromSlash(name))
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+func (s *fileArtifactStore) list(sid string) ([]models.Artifact, error) {
+	dir := s.taskDir(sid)
+	var artifacts []models.Artifact
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				// The task has no artifact.
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		artifacts = append(artifacts, models.Artifact{
+			Name: filepath.ToSlash(rel),
+			Size: info.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortArtifacts(artifacts)
+	return artifacts, nil
+}
+func (s *fileArtifactStore) open(sid, name string) (io.ReadCloser, error) {
+	name, err := cleanArtifactName(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(s.taskDir(sid), filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return nil, errors.Errorf("not found artifact: %s", name)
+	}
+	return f, err
+}
+func (s *fileArtifactStore) remove(sid string) error {
+	return os.RemoveAll(s.taskDir(sid))
+}
+func (s *fileArtifactStore) taskDir(sid string) string {
+	// Prevent the path traversal.
+	name := strings.ReplaceAll(sid, string(filepath.Separator), "_")
+	return filepath.Join(s.Dir, name)
+}
+
+// cleanArtifactName normalizes the name and rejects the name that points outside of the task directory.
+func cleanArtifactName(name string) (string, error) {
+	cleaned := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if cleaned == "" {
+		return "", errors.Errorf("invalid artifact name: %q", name)
+	}
+	return cleaned, nil
+}
+func sortArtifacts(artifacts []models.Artifact) {
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Name < artifacts[j].Name
+	})
+}
@@ -0,0 +1,83 @@
+package databases
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/clustertest/models"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTaskDB_Artifacts(t *testing.T) {
+	withDBs := func(t *testing.T, fn func(t *testing.T, db models.TaskDB, q models.TaskQueue)) {
+		t.Run("memory", func(t *testing.T) {
+			db := NewMemTaskDB()
+			fn(t, db, db)
+		})
+		t.Run("file", func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "clustertest-artifacts-")
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer os.RemoveAll(dir)
+			db, err := OpenFileTaskDB(dir)
+			if !assert.NoError(t, err) {
+				return
+			}
+			fn(t, db, db)
+		})
+	}
+
+	t.Run("should_save_and_open_artifacts", func(t *testing.T) {
+		withDBs(t, func(t *testing.T, db models.TaskDB, q models.TaskQueue) {
+			id, err := db.Create(&MemTask{})
+			if !assert.NoError(t, err) {
+				return
+			}
+			err = q.Consume(func(ctx context.Context, _ models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+				assert.NoError(t, h.SaveArtifact("web/192.168.0.10/var/log/syslog", strings.NewReader("log")))
+				// The path traversal must be prevented.
+				assert.NoError(t, h.SaveArtifact("../../etc/passwd", strings.NewReader("passwd")))
+				return &FileTaskResult{}, nil
+			})
+			assert.NoError(t, err)
+
+			artifacts, err := db.Artifacts(id)
+			assert.NoError(t, err)
+			assert.Equal(t, []models.Artifact{
+				{Name: "etc/passwd", Size: 6},
+				{Name: "web/192.168.0.10/var/log/syslog", Size: 3},
+			}, artifacts)
+
+			r, err := db.OpenArtifact(id, "web/192.168.0.10/var/log/syslog")
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer r.Close()
+			b, _ := ioutil.ReadAll(r)
+			assert.Equal(t, "log", string(b))
+		})
+	})
+
+	t.Run("should_remove_artifacts_of_deleted_task", func(t *testing.T) {
+		withDBs(t, func(t *testing.T, db models.TaskDB, q models.TaskQueue) {
+			id, err := db.Create(&MemTask{})
+			if !assert.NoError(t, err) {
+				return
+			}
+			err = q.Consume(func(ctx context.Context, _ models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+				assert.NoError(t, h.SaveArtifact("a.log", strings.NewReader("log")))
+				return &FileTaskResult{}, nil
+			})
+			assert.NoError(t, err)
+			assert.NoError(t, db.Delete(id))
+
+			_, err = db.Artifacts(id)
+			assert.Error(t, err)
+			_, err = db.OpenArtifact(id, "a.log")
+			assert.Error(t, err)
+		})
+	})
+}
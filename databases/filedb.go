@@ -0,0 +1,301 @@
+package databases
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/yuuki0xff/clustertest/models"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const fileTaskExt = ".json"
+const fileOutputExt = ".log"
+const artifactsDirName = "artifacts"
+const interruptedErrMsg = "interrupted by the restart of clustertestd"
+
+// FileTaskDB is a TaskDB that persists all tasks into files.
+// Each task is saved as a JSON file in the Dir directory, and its artifacts are saved in the Dir/artifacts directory.
+// The output of the task is appended to a separate file, so the JSON file is not rewritten by each write of the
+// output.  The waiting tasks and the finished tasks are restored
+// when the FileTaskDB is opened.  The tasks which were running when the daemon stopped are marked as interrupted.
+type FileTaskDB struct {
+	*MemTaskDB
+	Dir string
+}
+
+// fileTaskRecord is the format of the task files.
+type fileTaskRecord struct {
+	ID      string
+	State   string
+	Created time.Time
+	Spec    []byte
+	Options models.TaskOptions
+	History []models.StateTransition `json:",omitempty"`
+	Result  *FileTaskResult          `json:",omitempty"`
+}
+
+// FileTaskResult is a serializable TaskResult.
+type FileTaskResult struct {
+	ErrMsg         string
+	TeardownErrMsg string
+	Before         *FileScriptResult
+	Main           *FileScriptResult
+	After          *FileScriptResult
+}
+
+// FileScriptResult is a serializable ScriptResult.
+type FileScriptResult struct {
+	NameStr      string
+	Start        time.Time
+	End          time.Time
+	Hostname     string
+	Out          []byte
+	Exit         int
+	ChildResults []*FileScriptResult `json:",omitempty"`
+}
+
+// OpenFileTaskDB opens the database on the dir directory.
+// If the directory does not exist, it will be created.
+func OpenFileTaskDB(dir string) (*FileTaskDB, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the database directory")
+	}
+
+	db := &FileTaskDB{
+		MemTaskDB: NewMemTaskDB(),
+		Dir:       dir,
+	}
+	err = db.load()
+	if err != nil {
+		return nil, err
+	}
+	db.persist = db.save
+	db.persistOutput = db.appendOutput
+	db.artifacts = &fileArtifactStore{
+		Dir: filepath.Join(dir, artifactsDirName),
+	}
+	return db, nil
+}
+
+// load restores all tasks from the files.
+func (db *FileTaskDB) load() error {
+	files, err := filepath.Glob(filepath.Join(db.Dir, "*"+fileTaskExt))
+	if err != nil {
+		return err
+	}
+
+	db.m.Lock()
+	defer db.m.Unlock()
+	var interrupted []string
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		rec := &fileTaskRecord{}
+		err = json.Unmarshal(b, rec)
+		if err != nil {
+			return errors.Wrapf(err, "broken task file: %s", file)
+		}
+
+		e := &memTaskEntry{
+			state:   rec.State,
+			history: rec.History,
+			task:    &MemTask{Spec: rec.Spec, Opts: rec.Options},
+			created: rec.Created,
+		}
+		e.output, err = ioutil.ReadFile(db.outputPath(rec.ID))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if rec.Result != nil {
+			e.result = rec.Result
+		}
+		if len(e.history) == 0 {
+			e.history = []models.StateTransition{{State: e.state, Time: e.created}}
+		}
+		if models.IsActiveState(e.state) {
+			e.setState(models.InterruptedTaskState)
+			e.result = &FileTaskResult{ErrMsg: interruptedErrMsg}
+			interrupted = append(interrupted, rec.ID)
+		}
+		db.tasks[rec.ID] = e
+		db.indexName(rec.ID, e)
+
+		if n, err := strconv.Atoi(rec.ID); err == nil && db.nextID <= n {
+			db.nextID = n + 1
+		}
+	}
+
+	for _, sid := range interrupted {
+		err := db.writeRecord(sid, db.tasks[sid])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save writes current state of the task to the file.
+// If the task is not found, the file is removed.
+func (db *FileTaskDB) save(sid string) error {
+	e, ok := db.entry(sid)
+	if !ok {
+		for _, path := range []string{db.path(sid), db.outputPath(sid)} {
+			err := os.Remove(path)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	}
+	return db.writeRecord(sid, &e)
+}
+func (db *FileTaskDB) writeRecord(sid string, e *memTaskEntry) error {
+	rec := &fileTaskRecord{
+		ID:      sid,
+		State:   e.state,
+		Created: e.created,
+		History: e.history,
+		Spec:    e.task.SpecData(),
+		Options: e.task.Options(),
+		Result:  NewFileTaskResult(e.result),
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	// Write to the temporary file and rename it to replace the file atomically.
+	tmp, err := ioutil.TempFile(db.Dir, "."+sid+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), db.path(sid))
+}
+
+// appendOutput appends the data to the output file of the task.
+func (db *FileTaskDB) appendOutput(sid string, p []byte) error {
+	f, err := os.OpenFile(db.outputPath(sid), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(p)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+func (db *FileTaskDB) path(sid string) string {
+	return filepath.Join(db.Dir, db.fileName(sid)+fileTaskExt)
+}
+func (db *FileTaskDB) outputPath(sid string) string {
+	return filepath.Join(db.Dir, db.fileName(sid)+fileOutputExt)
+}
+func (db *FileTaskDB) fileName(sid string) string {
+	// Prevent the path traversal.
+	return strings.ReplaceAll(sid, string(filepath.Separator), "_")
+}
+
+func NewFileTaskResult(tr models.TaskResult) *FileTaskResult {
+	if tr == nil {
+		return nil
+	}
+	if r, ok := tr.(*FileTaskResult); ok {
+		return r
+	}
+
+	r := &FileTaskResult{
+		Before: NewFileScriptResult(tr.BeforeResult()),
+		Main:   NewFileScriptResult(tr.ScriptResult()),
+		After:  NewFileScriptResult(tr.AfterResult()),
+	}
+	if err := tr.Error(); err != nil {
+		r.ErrMsg = err.Error()
+	}
+	if err := tr.TeardownError(); err != nil {
+		r.TeardownErrMsg = err.Error()
+	}
+	return r
+}
+func (r *FileTaskResult) String() string {
+	return "<FileTaskResult>"
+}
+func (r *FileTaskResult) Error() error {
+	if r.ErrMsg != "" {
+		return errors.New(r.ErrMsg)
+	}
+	return nil
+}
+func (r *FileTaskResult) TeardownError() error {
+	if r.TeardownErrMsg != "" {
+		return errors.New(r.TeardownErrMsg)
+	}
+	return nil
+}
+func (r *FileTaskResult) BeforeResult() models.ScriptResult {
+	if r.Before != nil {
+		return r.Before
+	}
+	return nil
+}
+func (r *FileTaskResult) ScriptResult() models.ScriptResult {
+	if r.Main != nil {
+		return r.Main
+	}
+	return nil
+}
+func (r *FileTaskResult) AfterResult() models.ScriptResult {
+	if r.After != nil {
+		return r.After
+	}
+	return nil
+}
+
+func NewFileScriptResult(r models.ScriptResult) *FileScriptResult {
+	if r == nil {
+		return nil
+	}
+	sr := &FileScriptResult{
+		NameStr:  r.Name(),
+		Start:    r.StartTime(),
+		End:      r.EndTime(),
+		Hostname: r.Host(),
+		Out:      r.Output(),
+		Exit:     r.ExitCode(),
+	}
+	for _, c := range r.Children() {
+		sr.ChildResults = append(sr.ChildResults, NewFileScriptResult(c))
+	}
+	return sr
+}
+func (r *FileScriptResult) String() string       { return "<FileScriptResult>" }
+func (r *FileScriptResult) Name() string         { return r.NameStr }
+func (r *FileScriptResult) StartTime() time.Time { return r.Start }
+func (r *FileScriptResult) EndTime() time.Time   { return r.End }
+func (r *FileScriptResult) Host() string         { return r.Hostname }
+func (r *FileScriptResult) Output() []byte       { return r.Out }
+func (r *FileScriptResult) ExitCode() int        { return r.Exit }
+func (r *FileScriptResult) Children() []models.ScriptResult {
+	var rs []models.ScriptResult
+	for _, c := range r.ChildResults {
+		rs = append(rs, c)
+	}
+	return rs
+}
@@ -0,0 +1,263 @@
+package databases
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/clustertest/models"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileTaskDB(t *testing.T) {
+	withDir := func(t *testing.T, fn func(dir string)) {
+		dir, err := ioutil.TempDir("", "clustertest-filedb-")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer os.RemoveAll(dir)
+		fn(dir)
+	}
+
+	t.Run("should_restore_waiting_tasks", func(t *testing.T) {
+		withDir(t, func(dir string) {
+			db, err := OpenFileTaskDB(dir)
+			if !assert.NoError(t, err) {
+				return
+			}
+			id, err := db.Create(&MemTask{Spec: []byte("spec")})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			db, err = OpenFileTaskDB(dir)
+			if !assert.NoError(t, err) {
+				return
+			}
+			d, err := db.Inspect(id)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, models.WaitingTaskState, d.State())
+
+			// The ID must not be reused.
+			id2, err := db.Create(&MemTask{Spec: []byte("spec2")})
+			assert.NoError(t, err)
+			assert.NotEqual(t, id.String(), id2.String())
+
+			d2, err := db.Inspect(id2)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, models.WaitingTaskState, d2.State())
+		})
+	})
+
+	t.Run("should_restore_finished_tasks", func(t *testing.T) {
+		withDir(t, func(dir string) {
+			db, err := OpenFileTaskDB(dir)
+			if !assert.NoError(t, err) {
+				return
+			}
+			id, err := db.Create(&MemTask{Spec: []byte("spec")})
+			if !assert.NoError(t, err) {
+				return
+			}
+			start := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+			err = db.Consume(func(ctx context.Context, id models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+				h.SetPhase(models.MainTaskState)
+				return &FileTaskResult{
+					ErrMsg: "failed",
+					Main: &FileScriptResult{
+						Start:    start,
+						End:      start.Add(time.Second),
+						Hostname: "localhost",
+						Out:      []byte("output"),
+						Exit:     1,
+						ChildResults: []*FileScriptResult{
+							{NameStr: "echo ok", Hostname: "localhost", Out: []byte("ok"), Exit: 0},
+							{NameStr: "false", Hostname: "localhost", Exit: 1},
+						},
+					},
+				}, nil
+			})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			db, err = OpenFileTaskDB(dir)
+			if !assert.NoError(t, err) {
+				return
+			}
+			d, err := db.Inspect(id)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, models.FailedTaskState, d.State())
+			r := d.Result()
+			if !assert.NotNil(t, r) {
+				return
+			}
+			assert.EqualError(t, r.Error(), "failed")
+			assert.Nil(t, r.BeforeResult())
+			assert.Equal(t, []byte("output"), r.ScriptResult().Output())
+			assert.Equal(t, 1, r.ScriptResult().ExitCode())
+			assert.True(t, start.Equal(r.ScriptResult().StartTime()))
+			children := r.ScriptResult().Children()
+			if assert.Len(t, children, 2) {
+				assert.Equal(t, "false", children[1].Name())
+				assert.Equal(t, 1, children[1].ExitCode())
+			}
+		})
+	})
+
+	t.Run("should_restore_output", func(t *testing.T) {
+		withDir(t, func(dir string) {
+			db, err := OpenFileTaskDB(dir)
+			if !assert.NoError(t, err) {
+				return
+			}
+			id, err := db.Create(&MemTask{Spec: []byte("spec")})
+			if !assert.NoError(t, err) {
+				return
+			}
+			err = db.Consume(func(ctx context.Context, _ models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+				h.Output().Write([]byte("line1\n"))
+				h.Output().Write([]byte("line2\n"))
+				return nil, errors.New("failed")
+			})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			db, err = OpenFileTaskDB(dir)
+			if !assert.NoError(t, err) {
+				return
+			}
+			out, err := db.Logs(id, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, "line1\nline2\n", string(out))
+			d, err := db.Inspect(id)
+			if assert.NoError(t, err) {
+				assert.Equal(t, models.ErroredTaskState, d.State())
+				assert.EqualError(t, d.Result().Error(), "failed")
+			}
+
+			// The output is removed with the task.
+			assert.NoError(t, db.Delete(id))
+			_, err = os.Stat(db.outputPath(id.String()))
+			assert.True(t, os.IsNotExist(err))
+		})
+	})
+
+	t.Run("should_mark_running_tasks_as_interrupted", func(t *testing.T) {
+		withDir(t, func(dir string) {
+			db, err := OpenFileTaskDB(dir)
+			if !assert.NoError(t, err) {
+				return
+			}
+			id, err := db.Create(&MemTask{Spec: []byte("spec")})
+			if !assert.NoError(t, err) {
+				return
+			}
+			err = db.Consume(func(ctx context.Context, _ models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+				// Simulate the restart of daemon while running the task.
+				db2, err := OpenFileTaskDB(dir)
+				if !assert.NoError(t, err) {
+					return nil, nil
+				}
+				d, err := db2.Inspect(id)
+				if !assert.NoError(t, err) {
+					return nil, nil
+				}
+				assert.Equal(t, models.InterruptedTaskState, d.State())
+				assert.Error(t, d.Result().Error())
+				return &FileTaskResult{}, nil
+			})
+			assert.NoError(t, err)
+		})
+	})
+
+	t.Run("should_persist_latest_state_of_concurrent_changes", func(t *testing.T) {
+		withDir(t, func(dir string) {
+			db, err := OpenFileTaskDB(dir)
+			if !assert.NoError(t, err) {
+				return
+			}
+			var ids []models.TaskID
+			for i := 0; i < 20; i++ {
+				id, err := db.Create(&MemTask{Spec: []byte("spec")})
+				if !assert.NoError(t, err) {
+					return
+				}
+				ids = append(ids, id)
+			}
+
+			var wg sync.WaitGroup
+			for range ids {
+				err := db.Consume(func(ctx context.Context, id models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+					var phases sync.WaitGroup
+					for _, state := range []string{models.ReservingTaskState, models.CreatingTaskState, models.MainTaskState} {
+						phases.Add(1)
+						go func(state string) {
+							defer phases.Done()
+							h.SetPhase(state)
+						}(state)
+					}
+					phases.Wait()
+					// The cancellation races with the update to the terminal state.
+					var started sync.WaitGroup
+					for i := 0; i < 5; i++ {
+						wg.Add(1)
+						started.Add(1)
+						go func() {
+							defer wg.Done()
+							started.Done()
+							db.Cancel(id)
+						}()
+					}
+					started.Wait()
+					return &FileTaskResult{}, nil
+				})
+				assert.NoError(t, err)
+			}
+			wg.Wait()
+
+			db, err = OpenFileTaskDB(dir)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, id := range ids {
+				d, err := db.Inspect(id)
+				if assert.NoError(t, err) {
+					assert.Contains(t, []string{models.SucceededTaskState, models.CanceledTaskState}, d.State(), id.String())
+				}
+			}
+		})
+	})
+
+	t.Run("should_remove_deleted_tasks", func(t *testing.T) {
+		withDir(t, func(dir string) {
+			db, err := OpenFileTaskDB(dir)
+			if !assert.NoError(t, err) {
+				return
+			}
+			id, err := db.Create(&MemTask{Spec: []byte("spec")})
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.NoError(t, db.Delete(id))
+
+			db, err = OpenFileTaskDB(dir)
+			if !assert.NoError(t, err) {
+				return
+			}
+			ds, err := db.List()
+			assert.NoError(t, err)
+			assert.Len(t, ds, 0)
+		})
+	})
+}
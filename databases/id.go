@@ -1,6 +1,9 @@
 package databases
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+)
 
 type IntTaskID struct {
 	ID int
@@ -17,3 +20,13 @@ type StringTaskID struct {
 func (s *StringTaskID) String() string {
 	return s.ID
 }
+
+// lessTaskID compares IDs as numbers.  If they are not numbers, compares them as strings.
+func lessTaskID(a, b string) bool {
+	x, err1 := strconv.Atoi(a)
+	y, err2 := strconv.Atoi(b)
+	if err1 != nil || err2 != nil {
+		return a < b
+	}
+	return x < y
+}
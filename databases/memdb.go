@@ -4,25 +4,68 @@ import (
 	"context"
 	"github.com/pkg/errors"
 	"github.com/yuuki0xff/clustertest/models"
+	"io"
+	"log"
 	"sync"
 	"time"
 )
 
 type MemTaskDB struct {
-	m        sync.Mutex
-	nextID   int
-	waiting  map[string]models.Task
-	running  map[string]struct{}
-	finished map[string]models.TaskResult
+	m      sync.Mutex
+	nextID int
+	tasks  map[string]*memTaskEntry
+	// names is the index of tasks by name.
+	names map[string][]string
+	// persist is called after the task is changed.
+	// If it is nil, changes are not persisted.
+	persist func(sid string) error
+	// persistLocks serializes the persist calls of each task.  The persist takes the snapshot of the task while holding
+	// the lock, so the last written snapshot is always the latest state.
+	persistLocks map[string]*sync.Mutex
+	// persistOutput is called with the data appended to the output of the task.
+	// It is called while holding the lock to keep the order of writes.  If it is nil, the output is not persisted.
+	persistOutput func(sid string, p []byte) error
+	artifacts     artifactStore
+	// updated is closed and replaced with a new channel when any task is changed or the output is written.
+	updated chan struct{}
 }
+type memTaskEntry struct {
+	state string
+	// history is the state transitions.  Use setState() to change the state.
+	history []models.StateTransition
+	task    models.Task
+	result  models.TaskResult
+	created time.Time
+	hold    *models.HoldInfo
+	// output is the streamed output of the task.
+	output []byte
+	// cancel interrupts the running task.
+	cancel context.CancelFunc
+	// canceled is true if the running task has been canceled.
+	canceled bool
+	// release is closed when the held task is released.
+	release chan struct{}
+}
+
+// memTaskHandle is a TaskHandle for MemTaskDB.
+type memTaskHandle struct {
+	db  *MemTaskDB
+	sid string
+}
+
+// memTaskOutput appends the written data to the output of the task.
+type memTaskOutput memTaskHandle
 type MemTask struct {
 	Spec []byte
+	Opts models.TaskOptions
 }
 type MemTaskDetail struct {
 	ID models.TaskID
 	DB *MemTaskDB
 }
 type MemTaskResult struct {
+	// err is the error returned by the consumer.
+	err    error
 	before models.ScriptResult
 	main   models.ScriptResult
 	after  models.ScriptResult
@@ -30,125 +73,271 @@ type MemTaskResult struct {
 
 func NewMemTaskDB() *MemTaskDB {
 	return &MemTaskDB{
-		waiting:  map[string]models.Task{},
-		running:  map[string]struct{}{},
-		finished: map[string]models.TaskResult{},
+		tasks:        map[string]*memTaskEntry{},
+		names:        map[string][]string{},
+		persistLocks: map[string]*sync.Mutex{},
+		artifacts:    newMemArtifactStore(),
+		updated:      make(chan struct{}),
 	}
 }
 func (db *MemTaskDB) Create(task models.Task) (models.TaskID, error) {
 	db.m.Lock()
-	defer db.m.Unlock()
-
 	id := &IntTaskID{
 		ID: db.nextID,
 	}
 	db.nextID++
 
-	db.waiting[id.String()] = task
+	e := &memTaskEntry{
+		task:    task,
+		created: time.Now(),
+	}
+	e.setStateAt(models.WaitingTaskState, e.created)
+	db.tasks[id.String()] = e
+	db.indexName(id.String(), e)
+	db.m.Unlock()
+
+	err := db.changed(id.String())
+	if err != nil {
+		return nil, err
+	}
 	return id, nil
 }
 func (db *MemTaskDB) Inspect(id models.TaskID) (models.TaskDetail, error) {
+	if _, ok := db.entry(id.String()); !ok {
+		return nil, &models.TaskNotFoundError{ID: id.String()}
+	}
 	return &MemTaskDetail{
 		ID: id,
 		DB: db,
 	}, nil
 }
-func (db *MemTaskDB) Wait(id models.TaskID, ctx context.Context) error {
-	td, err := db.Inspect(id)
-	if err != nil {
-		return err
+func (db *MemTaskDB) Resolve(ref string) (models.TaskID, error) {
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	// Find the latest task with the name.
+	var sid string
+	var latest *memTaskEntry
+	for _, id := range db.names[ref] {
+		e := db.tasks[id]
+		if latest == nil || latest.created.Before(e.created) || (latest.created.Equal(e.created) && lessTaskID(sid, id)) {
+			sid = id
+			latest = e
+		}
 	}
 
-	ticker := time.NewTicker(time.Second)
+	if _, ok := db.tasks[ref]; ok {
+		if latest != nil && sid != ref {
+			return nil, &models.AmbiguousTaskError{Ref: ref, IDs: []string{ref, sid}}
+		}
+		return &StringTaskID{ID: ref}, nil
+	}
+	if latest == nil {
+		return nil, &models.TaskNotFoundError{ID: ref}
+	}
+	return &StringTaskID{ID: sid}, nil
+}
+func (db *MemTaskDB) Wait(id models.TaskID, ctx context.Context) error {
+	return db.waitUntil(id.String(), ctx, func(e *memTaskEntry) bool {
+		return models.IsTerminalState(e.state)
+	})
+}
+func (db *MemTaskDB) WaitLogs(id models.TaskID, offset int, ctx context.Context) error {
+	return db.waitUntil(id.String(), ctx, func(e *memTaskEntry) bool {
+		return offset < len(e.output) || models.IsTerminalState(e.state)
+	})
+}
+
+// waitUntil blocks until the cond returns true.  The cond is called with the lock held whenever the task is changed.
+func (db *MemTaskDB) waitUntil(sid string, ctx context.Context, cond func(e *memTaskEntry) bool) error {
 	for {
+		db.m.Lock()
+		e, ok := db.tasks[sid]
+		done := ok && cond(e)
+		updated := db.updated
+		db.m.Unlock()
+
+		if !ok {
+			return &models.TaskNotFoundError{ID: sid}
+		}
+		if done {
+			return nil
+		}
 		select {
-		case <-ticker.C:
-			if td.State() == "finished" {
-				return nil
-			}
+		case <-updated:
 		case <-ctx.Done():
-			return errors.Errorf("context canceled")
+			return ctx.Err()
 		}
 	}
 }
 func (db *MemTaskDB) Cancel(id models.TaskID) error {
-	// todo
-	panic("not impl")
+	sid := id.String()
+	err := func() error {
+		db.m.Lock()
+		defer db.m.Unlock()
+
+		e, ok := db.tasks[sid]
+		if !ok {
+			return &models.TaskNotFoundError{ID: sid}
+		}
+		switch e.state {
+		case models.WaitingTaskState:
+			// Drop it from the queue.
+			e.setState(models.CanceledTaskState)
+			return nil
+		}
+		if !models.IsActiveState(e.state) {
+			return &models.InvalidStateError{ID: sid, Op: "cancel", State: e.state}
+		}
+		// Interrupt the running task.
+		// The state will be changed to canceled after the consumer returned.
+		e.canceled = true
+		e.cancel()
+		return nil
+	}()
+	if err != nil {
+		return err
+	}
+	return db.changed(sid)
 }
-func (db *MemTaskDB) Delete(id models.TaskID) error {
+func (db *MemTaskDB) Release(id models.TaskID) error {
 	db.m.Lock()
 	defer db.m.Unlock()
 
 	sid := id.String()
+	e, ok := db.tasks[sid]
+	if !ok {
+		return &models.TaskNotFoundError{ID: sid}
+	}
+	if e.state != models.HoldingTaskState {
+		return &models.InvalidStateError{ID: sid, Op: "release", State: e.state}
+	}
+	if e.release != nil {
+		close(e.release)
+		e.release = nil
+	}
+	return nil
+}
+func (db *MemTaskDB) Delete(id models.TaskID) error {
+	sid := id.String()
+	err := func() error {
+		db.m.Lock()
+		defer db.m.Unlock()
 
-	if _, ok := db.waiting[sid]; ok {
-		// Task is waiting.
-		delete(db.waiting, sid)
+		e, ok := db.tasks[sid]
+		if !ok {
+			return &models.TaskNotFoundError{ID: sid}
+		}
+		if models.IsActiveState(e.state) {
+			// Cannot delete it because it is running.
+			return &models.AlreadyRunningError{ID: sid, Op: "delete", State: e.state}
+		}
+		delete(db.tasks, sid)
+		db.unindexName(sid, e)
 		return nil
+	}()
+	if err != nil {
+		return err
 	}
-	if _, ok := db.running[sid]; ok {
-		// Cannot stop delete it because it is running.
-		return errors.Errorf("failed to delete task: task(%s) is running", sid)
+	err = db.artifacts.remove(sid)
+	if err != nil {
+		return errors.Wrap(err, "failed to remove artifacts")
 	}
-	if _, ok := db.finished[sid]; ok {
-		// Task is finished.
-		delete(db.finished, sid)
-		return nil
+	return db.changed(sid)
+}
+func (db *MemTaskDB) Logs(id models.TaskID, offset int) ([]byte, error) {
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	sid := id.String()
+	e, ok := db.tasks[sid]
+	if !ok {
+		return nil, &models.TaskNotFoundError{ID: sid}
+	}
+	if offset < 0 || len(e.output) < offset {
+		return nil, errors.Errorf("invalid offset: %d", offset)
+	}
+	out := make([]byte, len(e.output)-offset)
+	copy(out, e.output[offset:])
+	return out, nil
+}
+func (db *MemTaskDB) Artifacts(id models.TaskID) ([]models.Artifact, error) {
+	sid := id.String()
+	if _, ok := db.entry(sid); !ok {
+		return nil, &models.TaskNotFoundError{ID: sid}
 	}
-	return errors.Errorf("not found task: %s", sid)
+	return db.artifacts.list(sid)
+}
+func (db *MemTaskDB) OpenArtifact(id models.TaskID, name string) (io.ReadCloser, error) {
+	sid := id.String()
+	if _, ok := db.entry(sid); !ok {
+		return nil, &models.TaskNotFoundError{ID: sid}
+	}
+	return db.artifacts.open(sid, name)
 }
 func (db *MemTaskDB) Consume(fn models.TaskConsumer) error {
 	var sid string
-	var task models.Task
-	var ok bool
+	var e *memTaskEntry
 	// Get a task from waiting queue and move task to running.
 	db.m.Lock()
-	for sid, task = range db.waiting {
-		ok = true
-		break
-	}
-	if ok {
-		delete(db.waiting, sid)
-		db.running[sid] = struct{}{}
+	for id, entry := range db.tasks {
+		if entry.state != models.WaitingTaskState {
+			continue
+		}
+		if e == nil || runBefore(id, entry, sid, e) {
+			sid = id
+			e = entry
+		}
 	}
-	db.m.Unlock()
-
-	if !ok {
+	if e == nil {
+		db.m.Unlock()
 		return models.QueueEmpty
 	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e.setState(models.RunningTaskState)
+	e.cancel = cancel
+	db.m.Unlock()
+	db.changedOrLog(sid)
 
 	// Consume a task.
 	id := &StringTaskID{ID: sid}
-	result, err := fn(id, task)
+	result, err := fn(ctx, id, e.task, &memTaskHandle{db: db, sid: sid})
 	if err != nil {
-		// TODO
-		panic("not impl")
+		result = &MemTaskResult{err: err}
 	}
 
-	// Move task to finished.
+	// Move task to the terminal state.
 	db.m.Lock()
-	delete(db.running, sid)
-	db.finished[sid] = result
+	switch {
+	case e.canceled:
+		e.setState(models.CanceledTaskState)
+	case err != nil:
+		e.setState(models.ErroredTaskState)
+	case result == nil || result.Error() == nil:
+		e.setState(models.SucceededTaskState)
+	case e.ranScripts():
+		e.setState(models.FailedTaskState)
+	default:
+		e.setState(models.ErroredTaskState)
+	}
+	e.result = result
+	e.cancel = nil
 	db.m.Unlock()
+	db.changedOrLog(sid)
 	return nil
 }
+func (db *MemTaskDB) Changed() <-chan struct{} {
+	db.m.Lock()
+	defer db.m.Unlock()
+	return db.updated
+}
 func (db *MemTaskDB) List() ([]models.TaskDetail, error) {
 	db.m.Lock()
 	defer db.m.Unlock()
 
-	var ids []string
-	for id := range db.waiting {
-		ids = append(ids, id)
-	}
-	for id := range db.running {
-		ids = append(ids, id)
-	}
-	for id := range db.finished {
-		ids = append(ids, id)
-	}
-
 	var ds []models.TaskDetail
-	for _, id := range ids {
+	for id := range db.tasks {
 		ds = append(ds, &MemTaskDetail{
 			ID: &StringTaskID{id},
 			DB: db,
@@ -157,12 +346,190 @@ func (db *MemTaskDB) List() ([]models.TaskDetail, error) {
 	return ds, nil
 }
 
+// runBefore returns true if the task a should be executed before the task b.
+// The tasks are ordered by priority, submission time and ID.
+func runBefore(aid string, a *memTaskEntry, bid string, b *memTaskEntry) bool {
+	ap := a.task.Options().Priority
+	bp := b.task.Options().Priority
+	if ap != bp {
+		return ap > bp
+	}
+	if !a.created.Equal(b.created) {
+		return a.created.Before(b.created)
+	}
+	return lessTaskID(aid, bid)
+}
+
+// entry returns a copy of the task entry.
+func (db *MemTaskDB) entry(sid string) (memTaskEntry, bool) {
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	e, ok := db.tasks[sid]
+	if !ok {
+		return memTaskEntry{}, false
+	}
+	return *e, true
+}
+
+// changed notifies that the task was changed.
+// It wakes up all waiters and persists the task.
+func (db *MemTaskDB) changed(sid string) error {
+	db.m.Lock()
+	close(db.updated)
+	db.updated = make(chan struct{})
+	if db.persist == nil {
+		db.m.Unlock()
+		return nil
+	}
+	l, ok := db.persistLocks[sid]
+	if !ok {
+		l = &sync.Mutex{}
+		db.persistLocks[sid] = l
+	}
+	db.m.Unlock()
+
+	// Concurrent changes of the same task may finish their writes out of order.
+	l.Lock()
+	defer l.Unlock()
+	err := db.persist(sid)
+
+	db.m.Lock()
+	if _, ok := db.tasks[sid]; !ok && db.persistLocks[sid] == l {
+		// The task was deleted.  Removing the files again is harmless even if other writers use a new lock.
+		delete(db.persistLocks, sid)
+	}
+	db.m.Unlock()
+	return err
+}
+
+// changedOrLog is same as changed(), but it logs the error instead of returning it.
+func (db *MemTaskDB) changedOrLog(sid string) {
+	if err := db.changed(sid); err != nil {
+		log.Printf("failed to save the task(%s): %s", sid, err)
+	}
+}
+
+func (h *memTaskHandle) Hold(ctx context.Context, info models.HoldInfo) {
+	release := make(chan struct{})
+	h.db.m.Lock()
+	e := h.db.tasks[h.sid]
+	prev := e.state
+	e.setState(models.HoldingTaskState)
+	e.hold = &info
+	e.release = release
+	h.db.m.Unlock()
+	h.db.changedOrLog(h.sid)
+
+	timer := time.NewTimer(time.Until(info.Until))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-release:
+	case <-timer.C:
+	}
+
+	h.db.m.Lock()
+	e.setState(prev)
+	e.hold = nil
+	e.release = nil
+	h.db.m.Unlock()
+	h.db.changedOrLog(h.sid)
+}
+func (h *memTaskHandle) SetPhase(state string) {
+	if !models.IsPhaseState(state) {
+		err := errors.Errorf("invalid phase: %s", state)
+		panic(err)
+	}
+	h.db.m.Lock()
+	h.db.tasks[h.sid].setState(state)
+	h.db.m.Unlock()
+	h.db.changedOrLog(h.sid)
+}
+func (h *memTaskHandle) Output() io.Writer {
+	return (*memTaskOutput)(h)
+}
+
+func (h *memTaskHandle) SaveArtifact(name string, r io.Reader) error {
+	return h.db.artifacts.save(h.sid, name, r)
+}
+
+func (o *memTaskOutput) Write(p []byte) (int, error) {
+	o.db.m.Lock()
+	defer o.db.m.Unlock()
+
+	e := o.db.tasks[o.sid]
+	e.output = append(e.output, p...)
+	// Wake up the waiters of the output.  The task itself is not changed, so it is not persisted.
+	close(o.db.updated)
+	o.db.updated = make(chan struct{})
+	if o.db.persistOutput != nil {
+		if err := o.db.persistOutput(o.sid, p); err != nil {
+			// Do not interrupt the script.  The output is still available until the daemon restarts.
+			log.Printf("failed to save the output of the task(%s): %s", o.sid, err)
+		}
+	}
+	return len(p), nil
+}
+
+// indexName adds the task to the index of names.  Caller must hold the lock.
+func (db *MemTaskDB) indexName(sid string, e *memTaskEntry) {
+	name := e.task.Options().Name
+	if name == "" {
+		return
+	}
+	db.names[name] = append(db.names[name], sid)
+}
+
+// unindexName removes the task from the index of names.  Caller must hold the lock.
+func (db *MemTaskDB) unindexName(sid string, e *memTaskEntry) {
+	name := e.task.Options().Name
+	ids := db.names[name]
+	for i, id := range ids {
+		if id == sid {
+			ids = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(db.names, name)
+	} else {
+		db.names[name] = ids
+	}
+}
+
+// setState changes the state and records the transition.
+func (e *memTaskEntry) setState(state string) {
+	e.setStateAt(state, time.Now())
+}
+func (e *memTaskEntry) setStateAt(state string, t time.Time) {
+	e.state = state
+	e.history = append(e.history, models.StateTransition{
+		State: state,
+		Time:  t,
+	})
+}
+
+// ranScripts returns true if the task reached the phase to execute scripts.
+func (e *memTaskEntry) ranScripts() bool {
+	for _, t := range e.history {
+		switch t.State {
+		case models.BeforeTaskState, models.MainTaskState, models.AfterTaskState:
+			return true
+		}
+	}
+	return false
+}
+
 func (t *MemTask) String() string {
 	return "<MemTask>"
 }
 func (t *MemTask) SpecData() []byte {
 	return t.Spec
 }
+func (t *MemTask) Options() models.TaskOptions {
+	return t.Opts
+}
 
 func (d *MemTaskDetail) String() string {
 	return "<MemTaskDetail>"
@@ -171,35 +538,43 @@ func (d *MemTaskDetail) TaskID() models.TaskID {
 	return d.ID
 }
 func (d *MemTaskDetail) State() string {
-	d.DB.m.Lock()
-	defer d.DB.m.Unlock()
-
-	sid := d.ID.String()
-	db := d.DB
-	if _, ok := db.waiting[sid]; ok {
-		return "waiting"
-	}
-	if _, ok := db.running[sid]; ok {
-		return "running"
-	}
-	if _, ok := db.finished[sid]; ok {
-		return "finished"
+	e, ok := d.DB.entry(d.ID.String())
+	if !ok {
+		return models.UnknownTaskState
 	}
-
-	err := errors.Errorf("not found task: %s", sid)
-	panic(err)
+	return e.state
+}
+func (d *MemTaskDetail) History() []models.StateTransition {
+	e, _ := d.DB.entry(d.ID.String())
+	return append([]models.StateTransition(nil), e.history...)
 }
 func (d *MemTaskDetail) Result() models.TaskResult {
-	d.DB.m.Lock()
-	defer d.DB.m.Unlock()
-
-	return d.DB.finished[d.ID.String()]
+	e, _ := d.DB.entry(d.ID.String())
+	return e.result
+}
+func (d *MemTaskDetail) CreatedTime() time.Time {
+	e, _ := d.DB.entry(d.ID.String())
+	return e.created
+}
+func (d *MemTaskDetail) Options() models.TaskOptions {
+	e, _ := d.DB.entry(d.ID.String())
+	if e.task == nil {
+		return models.TaskOptions{}
+	}
+	return e.task.Options()
+}
+func (d *MemTaskDetail) HoldInfo() *models.HoldInfo {
+	e, _ := d.DB.entry(d.ID.String())
+	return e.hold
 }
 
 func (r *MemTaskResult) String() string {
 	return "<MemTaskResult>"
 }
 func (r *MemTaskResult) Error() error {
+	if r.err != nil {
+		return r.err
+	}
 	if r.before != nil && r.before.ExitCode() != 0 {
 		return errors.Errorf("before script failed with exit code %d", r.before.ExitCode())
 	}
@@ -211,6 +586,9 @@ func (r *MemTaskResult) Error() error {
 	}
 	return nil
 }
+func (r *MemTaskResult) TeardownError() error {
+	return nil
+}
 func (r *MemTaskResult) BeforeResult() models.ScriptResult {
 	return r.before
 }
@@ -0,0 +1,352 @@
+package databases
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/clustertest/models"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestMemTaskDB_Cancel(t *testing.T) {
+	t.Run("should_drop_waiting_task", func(t *testing.T) {
+		db := NewMemTaskDB()
+		id, err := db.Create(&MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, db.Cancel(id))
+
+		d, _ := db.Inspect(id)
+		assert.Equal(t, models.CanceledTaskState, d.State())
+		err = db.Consume(func(ctx context.Context, id models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+			t.Error("canceled task is consumed")
+			return nil, nil
+		})
+		assert.Equal(t, models.QueueEmpty, err)
+	})
+
+	t.Run("should_interrupt_running_task", func(t *testing.T) {
+		db := NewMemTaskDB()
+		id, err := db.Create(&MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		err = db.Consume(func(ctx context.Context, _ models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+			assert.NoError(t, db.Cancel(id))
+			<-ctx.Done()
+			return &FileTaskResult{ErrMsg: "canceled"}, nil
+		})
+		assert.NoError(t, err)
+
+		d, _ := db.Inspect(id)
+		assert.Equal(t, models.CanceledTaskState, d.State())
+		assert.EqualError(t, d.Result().Error(), "canceled")
+	})
+
+	t.Run("should_fail_when_task_is_finished", func(t *testing.T) {
+		db := NewMemTaskDB()
+		id, err := db.Create(&MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		err = db.Consume(func(ctx context.Context, id models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+			return &FileTaskResult{}, nil
+		})
+		assert.NoError(t, err)
+		assert.IsType(t, &models.InvalidStateError{}, db.Cancel(id))
+	})
+}
+func TestMemTaskDB_Wait(t *testing.T) {
+	t.Run("should_return_when_task_finished", func(t *testing.T) {
+		db := NewMemTaskDB()
+		id, err := db.Create(&MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		go db.Consume(func(ctx context.Context, id models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+			time.Sleep(100 * time.Millisecond)
+			return &FileTaskResult{}, nil
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		start := time.Now()
+		assert.NoError(t, db.Wait(id, ctx))
+		// It should not wait for the polling interval.
+		assert.True(t, time.Since(start) < 500*time.Millisecond)
+		d, _ := db.Inspect(id)
+		assert.Equal(t, models.SucceededTaskState, d.State())
+	})
+
+	t.Run("should_fail_when_timeout", func(t *testing.T) {
+		db := NewMemTaskDB()
+		id, err := db.Create(&MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, context.DeadlineExceeded, db.Wait(id, ctx))
+	})
+
+	t.Run("should_fail_when_task_not_found", func(t *testing.T) {
+		db := NewMemTaskDB()
+		assert.Error(t, db.Wait(&StringTaskID{ID: "0"}, context.Background()))
+	})
+}
+func TestMemTaskDB_Consume(t *testing.T) {
+	// consumeAll consumes all tasks and returns IDs in order of execution.
+	consumeAll := func(db *MemTaskDB) []string {
+		var ids []string
+		for {
+			err := db.Consume(func(ctx context.Context, id models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+				ids = append(ids, id.String())
+				return &FileTaskResult{}, nil
+			})
+			if err == models.QueueEmpty {
+				return ids
+			}
+			assert.NoError(t, err)
+		}
+	}
+
+	t.Run("should_consume_in_order_of_submission", func(t *testing.T) {
+		db := NewMemTaskDB()
+		for i := 0; i < 20; i++ {
+			db.Create(&MemTask{})
+		}
+		assert.Equal(t, []string{
+			"0", "1", "2", "3", "4", "5", "6", "7", "8", "9",
+			"10", "11", "12", "13", "14", "15", "16", "17", "18", "19",
+		}, consumeAll(db))
+	})
+
+	t.Run("should_consume_high_priority_task_first", func(t *testing.T) {
+		db := NewMemTaskDB()
+		for _, p := range []int{0, 1, -1, 1, 0} {
+			db.Create(&MemTask{Opts: models.TaskOptions{Priority: p}})
+		}
+		assert.Equal(t, []string{"1", "3", "0", "4", "2"}, consumeAll(db))
+	})
+}
+func TestMemTaskDB_Release(t *testing.T) {
+	t.Run("should_resume_held_task", func(t *testing.T) {
+		db := NewMemTaskDB()
+		id, err := db.Create(&MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		err = db.Consume(func(ctx context.Context, _ models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+			go func() {
+				for {
+					d, _ := db.Inspect(id)
+					if d.State() == models.HoldingTaskState {
+						assert.NotNil(t, d.HoldInfo())
+						assert.NoError(t, db.Release(id))
+						return
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}()
+			h.SetPhase(models.MainTaskState)
+			h.Hold(ctx, models.HoldInfo{Phase: "main", Until: time.Now().Add(time.Hour)})
+			return &FileTaskResult{ErrMsg: "failed"}, nil
+		})
+		assert.NoError(t, err)
+
+		d, _ := db.Inspect(id)
+		assert.Equal(t, models.FailedTaskState, d.State())
+	})
+
+	t.Run("should_fail_when_task_is_not_held", func(t *testing.T) {
+		db := NewMemTaskDB()
+		id, err := db.Create(&MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Error(t, db.Release(id))
+	})
+}
+func TestMemTaskDB_History(t *testing.T) {
+	states := func(d models.TaskDetail) []string {
+		var ss []string
+		for _, st := range d.History() {
+			ss = append(ss, st.State)
+		}
+		return ss
+	}
+
+	t.Run("should_record_phase_transitions", func(t *testing.T) {
+		db := NewMemTaskDB()
+		id, err := db.Create(&MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		err = db.Consume(func(ctx context.Context, _ models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+			h.SetPhase(models.ReservingTaskState)
+			h.SetPhase(models.MainTaskState)
+			return &FileTaskResult{}, nil
+		})
+		assert.NoError(t, err)
+
+		d, _ := db.Inspect(id)
+		assert.Equal(t, []string{
+			models.WaitingTaskState,
+			models.RunningTaskState,
+			models.ReservingTaskState,
+			models.MainTaskState,
+			models.SucceededTaskState,
+		}, states(d))
+		h := d.History()
+		for i := 1; i < len(h); i++ {
+			assert.False(t, h[i].Time.Before(h[i-1].Time))
+		}
+	})
+
+	t.Run("should_be_errored_when_failed_before_scripts", func(t *testing.T) {
+		db := NewMemTaskDB()
+		id, err := db.Create(&MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		err = db.Consume(func(ctx context.Context, _ models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+			h.SetPhase(models.ReservingTaskState)
+			return &FileTaskResult{ErrMsg: "no resources"}, nil
+		})
+		assert.NoError(t, err)
+
+		d, _ := db.Inspect(id)
+		assert.Equal(t, models.ErroredTaskState, d.State())
+	})
+}
+func TestMemTaskDB_Resolve(t *testing.T) {
+	t.Run("should_resolve_latest_task_by_name", func(t *testing.T) {
+		db := NewMemTaskDB()
+		_, err := db.Create(&MemTask{Opts: models.TaskOptions{Name: "foo"}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		id, err := db.Create(&MemTask{Opts: models.TaskOptions{Name: "foo"}})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		rid, err := db.Resolve("foo")
+		if assert.NoError(t, err) {
+			assert.Equal(t, id.String(), rid.String())
+		}
+		rid, err = db.Resolve("0")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "0", rid.String())
+		}
+	})
+
+	t.Run("should_resolve_older_task_after_latest_is_deleted", func(t *testing.T) {
+		db := NewMemTaskDB()
+		old, err := db.Create(&MemTask{Opts: models.TaskOptions{Name: "foo"}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		id, err := db.Create(&MemTask{Opts: models.TaskOptions{Name: "foo"}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, db.Cancel(id))
+		assert.NoError(t, db.Delete(id))
+
+		rid, err := db.Resolve("foo")
+		if assert.NoError(t, err) {
+			assert.Equal(t, old.String(), rid.String())
+		}
+	})
+
+	t.Run("should_fail_when_name_matches_id_of_another_task", func(t *testing.T) {
+		db := NewMemTaskDB()
+		_, err := db.Create(&MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = db.Create(&MemTask{Opts: models.TaskOptions{Name: "0"}})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		_, err = db.Resolve("0")
+		assert.IsType(t, &models.AmbiguousTaskError{}, err)
+	})
+
+	t.Run("should_fail_when_not_found", func(t *testing.T) {
+		db := NewMemTaskDB()
+		_, err := db.Resolve("foo")
+		assert.IsType(t, &models.TaskNotFoundError{}, err)
+	})
+}
+func TestMemTaskDB_Logs(t *testing.T) {
+	t.Run("should_return_output_after_offset", func(t *testing.T) {
+		db := NewMemTaskDB()
+		id, err := db.Create(&MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		err = db.Consume(func(ctx context.Context, _ models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+			io.WriteString(h.Output(), "foo\n")
+			out, err := db.Logs(id, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, "foo\n", string(out))
+
+			io.WriteString(h.Output(), "bar\n")
+			out, err = db.Logs(id, 4)
+			assert.NoError(t, err)
+			assert.Equal(t, "bar\n", string(out))
+			return &FileTaskResult{}, nil
+		})
+		assert.NoError(t, err)
+
+		out, err := db.Logs(id, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "foo\nbar\n", string(out))
+	})
+
+	t.Run("should_fail_when_offset_is_out_of_range", func(t *testing.T) {
+		db := NewMemTaskDB()
+		id, err := db.Create(&MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = db.Logs(id, 1)
+		assert.Error(t, err)
+	})
+}
+
+func TestMemTaskDB_WaitLogs(t *testing.T) {
+	t.Run("should_wake_up_when_output_is_written", func(t *testing.T) {
+		db := NewMemTaskDB()
+		id, err := db.Create(&MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		err = db.Consume(func(ctx context.Context, _ models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+			ec := make(chan error, 1)
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				ec <- db.WaitLogs(id, 0, ctx)
+			}()
+			time.Sleep(100 * time.Millisecond)
+			io.WriteString(h.Output(), "foo\n")
+			assert.NoError(t, <-ec)
+
+			// No output after the offset.
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			assert.Equal(t, context.DeadlineExceeded, db.WaitLogs(id, 4, ctx))
+			return &FileTaskResult{}, nil
+		})
+		assert.NoError(t, err)
+
+		// The task is finished.
+		assert.NoError(t, db.WaitLogs(id, 4, context.Background()))
+	})
+}
@@ -1,10 +1,13 @@
 package callback
 
-import "github.com/yuuki0xff/clustertest/models"
+import (
+	"context"
+	"github.com/yuuki0xff/clustertest/models"
+)
 
 const supportedType = models.ScriptType("callback")
 
-type Callback func(script models.Script) models.ScriptResult
+type Callback func(ctx context.Context, script models.Script) models.ScriptResult
 
 type Executor struct {
 	Fn Callback
@@ -16,6 +19,6 @@ func (e *Executor) String() string {
 func (e *Executor) Type() models.ScriptType {
 	return supportedType
 }
-func (e *Executor) Execute(script models.Script) models.ScriptResult {
-	return e.Fn(script)
+func (e *Executor) Execute(ctx context.Context, script models.Script) models.ScriptResult {
+	return e.Fn(ctx, script)
 }
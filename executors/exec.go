@@ -1,38 +1,41 @@
 package executors
 
 import (
+	"context"
 	"github.com/republicprotocol/co-go"
 	"github.com/yuuki0xff/clustertest/models"
 	"sync"
 )
 
-func ExecuteBefore(p models.Provisioner, sets []*models.ScriptSet) models.ScriptResult {
+func ExecuteBefore(ctx context.Context, p models.Provisioner, sets []*models.ScriptSet) models.ScriptResult {
 	var scripts []models.Script
 	for _, set := range sets {
 		scripts = append(scripts, set.Before)
 	}
-	return executeAll(p, scripts)
+	return executeAll(ctx, p, scripts)
 }
 
-func ExecuteMain(p models.Provisioner, sets []*models.ScriptSet) models.ScriptResult {
+func ExecuteMain(ctx context.Context, p models.Provisioner, sets []*models.ScriptSet) models.ScriptResult {
 	var scripts []models.Script
 	for _, set := range sets {
 		scripts = append(scripts, set.Main)
 	}
-	return executeAll(p, scripts)
+	return executeAll(ctx, p, scripts)
 }
 
-func ExecuteAfter(p models.Provisioner, sets []*models.ScriptSet) models.ScriptResult {
+func ExecuteAfter(ctx context.Context, p models.Provisioner, sets []*models.ScriptSet) models.ScriptResult {
 	var scripts []models.Script
 	for _, set := range sets {
 		scripts = append(scripts, set.After)
 	}
-	return executeAll(p, scripts)
+	return executeAll(ctx, p, scripts)
 }
 
-func executeAll(p models.Provisioner, scripts []models.Script) models.ScriptResult {
+func executeAll(ctx context.Context, p models.Provisioner, scripts []models.Script) models.ScriptResult {
 	m := sync.Mutex{}
-	mr := &MergedResult{}
+	mr := &MergedResult{
+		NameStr: string(p.Spec().Type()),
+	}
 
 	co.ParForAll(scripts, func(i int) {
 		s := scripts[i]
@@ -40,7 +43,7 @@ func executeAll(p models.Provisioner, scripts []models.Script) models.ScriptResu
 			return
 		}
 		e := p.ScriptExecutor(s.Type())
-		result := e.Execute(s)
+		result := e.Execute(ctx, s)
 
 		m.Lock()
 		mr.Append(result)
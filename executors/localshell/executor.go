@@ -2,20 +2,30 @@ package localshell
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/yuuki0xff/clustertest/executors"
 	"github.com/yuuki0xff/clustertest/models"
 	"github.com/yuuki0xff/clustertest/scripts/localshell"
+	"io"
+	"os"
 	"os/exec"
+	"syscall"
 	"time"
 )
 
 const supportedType = models.ScriptType("local-shell")
 
-type Executor struct{}
+type Executor struct {
+	// (Optional) Host is the name of the host shown in the results.  If it is empty, "localhost" is used.
+	Host string
+	// (Optional) Env is the additional environment variables in the form "key=value".
+	Env []string
+}
 
 // Result represents an result.
 type Result struct {
+	HostStr string
 	Command string
 	Start   time.Time
 	End     time.Time
@@ -29,19 +39,20 @@ func (e *Executor) String() string {
 func (e *Executor) Type() models.ScriptType {
 	return supportedType
 }
-func (e *Executor) Execute(script models.Script) models.ScriptResult {
+func (e *Executor) Execute(ctx context.Context, script models.Script) models.ScriptResult {
 	if e.Type() != script.Type() {
 		panic("not supported type")
 	}
 	s := script.(*localshell.Script)
-	return executeMany(s.Commands)
+	return e.executeMany(ctx, s.Commands)
 }
-func executeMany(cmds []string) models.ScriptResult {
+func (e *Executor) executeMany(ctx context.Context, cmds []string) models.ScriptResult {
 	mr := &executors.MergedResult{
+		NameStr:          e.host(),
 		WithoutSeparator: true,
 	}
 	for _, cmd := range cmds {
-		result := execute(cmd)
+		result := e.execute(ctx, cmd)
 		mr.Append(result)
 		if result.ExitCode() != 0 {
 			// Failed.  Stop jobs immediately.
@@ -50,13 +61,19 @@ func executeMany(cmds []string) models.ScriptResult {
 	}
 	return mr
 }
-func execute(cmd string) *Result {
+func (e *Executor) execute(ctx context.Context, cmd string) *Result {
 	c := exec.Command("/bin/sh", "-c", cmd)
+	if len(e.Env) > 0 {
+		c.Env = append(os.Environ(), e.Env...)
+	}
 	r := &Result{
+		HostStr: e.host(),
 		Command: cmd,
 		Start:   time.Now(),
 	}
-	out, err := c.CombinedOutput()
+	stream := executors.NewOutputStream(ctx, r.Host(), cmd)
+	defer stream.Close()
+	out, err := combinedOutput(ctx, c, stream)
 	r.End = time.Now()
 	if _, ok := err.(*exec.ExitError); err == nil || ok {
 		r.Out = out
@@ -66,16 +83,63 @@ func execute(cmd string) *Result {
 	// Unexpected error occurred.
 	r.Out = []byte(fmt.Sprintf("ERROR: %s", err.Error()))
 	r.Code = 1
+	stream.Write(r.Out)
 	return r
 }
+func (e *Executor) host() string {
+	if e.Host != "" {
+		return e.Host
+	}
+	return "localhost"
+}
+
+// combinedOutput runs the command and returns its combined standard output and standard error.
+// The output is also written to the stream as it arrives.
+// When the ctx is canceled, it kills all processes in the process group of the command.
+func combinedOutput(ctx context.Context, c *exec.Cmd, stream io.Writer) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	// Use the same writer for stdout and stderr to avoid concurrent writes.
+	w := io.MultiWriter(&buf, stream)
+	c.Stdout = w
+	c.Stderr = w
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+	err := c.Wait()
+	return buf.Bytes(), err
+}
 
 func (r *Result) String() string {
 	return fmt.Sprintf("<LocalSehllResult %s>", r.Command)
 }
+func (r *Result) Name() string {
+	return r.Command
+}
+func (r *Result) Children() []models.ScriptResult {
+	return nil
+}
 func (r *Result) StartTime() time.Time {
 	return r.Start
 }
 func (r *Result) Host() string {
+	if r.HostStr != "" {
+		return r.HostStr
+	}
 	return "localhost"
 }
 func (r *Result) EndTime() time.Time {
@@ -1,16 +1,20 @@
 package localshell
 
 import (
+	"bytes"
+	"context"
 	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/clustertest/models"
 	"github.com/yuuki0xff/clustertest/scripts/localshell"
 	"testing"
+	"time"
 )
 
 func TestExecutor_Execute(t *testing.T) {
 	t.Run("should_fail_when_passed_the_unsupported_script", func(t *testing.T) {
 		assert.Panics(t, func() {
 			e := Executor{}
-			e.Execute(nil)
+			e.Execute(context.Background(), nil)
 		})
 	})
 
@@ -21,7 +25,7 @@ func TestExecutor_Execute(t *testing.T) {
 				"echo foo",
 			},
 		}
-		r := e.Execute(s)
+		r := e.Execute(context.Background(), s)
 		if !assert.NotNil(t, r) {
 			return
 		}
@@ -39,7 +43,7 @@ foo
 				"echo bar",
 			},
 		}
-		r := e.Execute(s)
+		r := e.Execute(context.Background(), s)
 		if !assert.NotNil(t, r) {
 			return
 		}
@@ -60,7 +64,7 @@ bar
 				"echo bar",
 			},
 		}
-		r := e.Execute(s)
+		r := e.Execute(context.Background(), s)
 		if !assert.NotNil(t, r) {
 			return
 		}
@@ -68,6 +72,68 @@ bar
 		assert.Equal(t, []byte(`localhost$ echo foo
 foo
 localhost$ false
+`), r.Output())
+	})
+
+	t.Run("should_stream_output", func(t *testing.T) {
+		e := Executor{}
+		s := &localshell.Script{
+			Commands: []string{
+				"echo foo; printf bar",
+			},
+		}
+		var buf bytes.Buffer
+		ctx := models.WithOutputWriter(context.Background(), &buf)
+		r := e.Execute(ctx, s)
+		if !assert.NotNil(t, r) {
+			return
+		}
+		assert.Equal(t, 0, r.ExitCode())
+		assert.Equal(t, `[localhost] $ echo foo; printf bar
+[localhost] foo
+[localhost] bar
+`, buf.String())
+	})
+
+	t.Run("should_pass_env_and_host", func(t *testing.T) {
+		e := Executor{
+			Host: "web-0",
+			Env:  []string{"CLUSTERTEST_TEST=foo"},
+		}
+		s := &localshell.Script{
+			Commands: []string{
+				"echo $CLUSTERTEST_TEST",
+			},
+		}
+		r := e.Execute(context.Background(), s)
+		if !assert.NotNil(t, r) {
+			return
+		}
+		assert.Equal(t, 0, r.ExitCode())
+		assert.Equal(t, "web-0", r.Name())
+		assert.Equal(t, []byte(`web-0$ echo $CLUSTERTEST_TEST
+foo
+`), r.Output())
+	})
+
+	t.Run("should_kill_process_when_canceled", func(t *testing.T) {
+		e := Executor{}
+		s := &localshell.Script{
+			Commands: []string{
+				"sleep 10",
+				"echo foo",
+			},
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		r := e.Execute(ctx, s)
+		if !assert.NotNil(t, r) {
+			return
+		}
+		assert.NotEqual(t, 0, r.ExitCode())
+		assert.True(t, time.Since(start) < 5*time.Second)
+		assert.Equal(t, []byte(`localhost$ sleep 10
 `), r.Output())
 	})
 }
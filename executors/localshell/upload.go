@@ -0,0 +1,44 @@
+package localshell
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Upload writes the content read from the r to the dest on the local host.
+// The parent directories of the dest are created if they do not exist.
+func (e *Executor) Upload(ctx context.Context, dest string, mode os.FileMode, r io.Reader) error {
+	err := os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, &ctxReader{ctx: ctx, r: r})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload %s", dest)
+	}
+	// The mode of the existing file is not changed by OpenFile.
+	return os.Chmod(dest, mode.Perm())
+}
+
+// ctxReader stops reading when the ctx is canceled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,35 @@
+package localshell
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecutor_Upload(t *testing.T) {
+	t.Run("should_create_file_with_mode", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "clustertest-upload-")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		e := &Executor{}
+		dest := filepath.Join(dir, "bin", "test.sh")
+		err = e.Upload(context.Background(), dest, 0755, strings.NewReader("#!/bin/sh\n"))
+		if !assert.NoError(t, err) {
+			return
+		}
+		b, err := ioutil.ReadFile(dest)
+		assert.NoError(t, err)
+		assert.Equal(t, "#!/bin/sh\n", string(b))
+		info, err := os.Stat(dest)
+		if assert.NoError(t, err) {
+			assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+		}
+	})
+}
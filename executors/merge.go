@@ -9,6 +9,8 @@ import (
 const DefaultSeparator = "================================\n"
 
 type MergedResult struct {
+	// NameStr is the value returned by Name().
+	NameStr          string
 	WithoutSeparator bool
 	Separator        string
 	results          []models.ScriptResult
@@ -23,6 +25,12 @@ func (mr *MergedResult) Merge(results []models.ScriptResult) {
 func (mr *MergedResult) String() string {
 	return "<MergedResult>"
 }
+func (mr *MergedResult) Name() string {
+	return mr.NameStr
+}
+func (mr *MergedResult) Children() []models.ScriptResult {
+	return mr.results
+}
 func (mr *MergedResult) StartTime() time.Time {
 	var ts []time.Time
 	for _, r := range mr.results {
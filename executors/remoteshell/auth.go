@@ -0,0 +1,93 @@
+package remoteshell
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// defaultKeyFiles is a list of private keys used when no key is specified.
+var defaultKeyFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+var agentOnce sync.Once
+var agentClient agent.Agent
+
+// AuthMethods returns authentication methods.
+// If the keyFile is empty, it uses the ssh-agent and the default private keys (~/.ssh/id_*) like the ssh command.
+// If the password is not empty, the password authentication is also used.
+func AuthMethods(keyFile, password string) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	if keyFile != "" {
+		signer, err := loadPrivateKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	} else {
+		methods = DefaultAuthMethods()
+	}
+	if password != "" {
+		methods = append(methods, ssh.Password(password))
+	}
+	return methods, nil
+}
+
+// DefaultAuthMethods returns the ssh-agent and the default private keys.
+// The unavailable methods are ignored.
+func DefaultAuthMethods() []ssh.AuthMethod {
+	var methods []ssh.AuthMethod
+	if a := sshAgent(); a != nil {
+		methods = append(methods, ssh.PublicKeysCallback(a.Signers))
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return methods
+	}
+	var signers []ssh.Signer
+	for _, name := range defaultKeyFiles {
+		signer, err := loadPrivateKey(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			// The key does not exist or is encrypted.
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	return methods
+}
+
+// sshAgent returns the client of the ssh-agent specified by SSH_AUTH_SOCK.
+// If the agent is not available, it returns nil.
+func sshAgent() agent.Agent {
+	agentOnce.Do(func() {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return
+		}
+		agentClient = agent.NewClient(conn)
+	})
+	return agentClient
+}
+func loadPrivateKey(file string) (ssh.Signer, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the private key")
+	}
+	signer, err := ssh.ParsePrivateKey(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the private key: %s", file)
+	}
+	return signer, nil
+}
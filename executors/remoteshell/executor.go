@@ -4,29 +4,52 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/yuuki0xff/clustertest/executors"
 	"github.com/yuuki0xff/clustertest/models"
 	"github.com/yuuki0xff/clustertest/scripts/remoteshell"
-	"os/exec"
-	"strings"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"strconv"
+	"sync"
 	"time"
 )
 
 const supportedType = models.ScriptType("remote-shell")
 const WaitTimeout = 30 * time.Second
 const StartTimeout = 1 * time.Minute
+const DefaultPort = 22
 
+// Executor executes commands on the remote host over SSH.
 type Executor struct {
 	User string
 	Host string
+	// Port of the SSH server.  If it is zero, the DefaultPort is used.
+	Port int
+	// Auth is a list of authentication methods.  If it is empty, DefaultAuthMethods() is used.
+	Auth []ssh.AuthMethod
+	// HostKeys verifies the host key of the server.  If it is nil, any host key is accepted.
+	HostKeys *HostKeyStore
+	// Pool reuses the connection.  If it is nil, a new connection is created on each Execute() call.
+	Pool *ConnPool
 }
 type Result struct {
 	E       *Executor
 	Command string
 	Start   time.Time
 	End     time.Time
-	Out     []byte
-	Code    int
+	// Out is the combined output of the stdout and stderr.
+	Out    []byte
+	Stdout []byte
+	Stderr []byte
+	Code   int
+}
+
+// syncWriter serializes writes from the stdout and stderr of the session.
+type syncWriter struct {
+	m sync.Mutex
+	w io.Writer
 }
 
 func (e *Executor) String() string {
@@ -35,44 +58,32 @@ func (e *Executor) String() string {
 func (e *Executor) Type() models.ScriptType {
 	return supportedType
 }
-func (e *Executor) Execute(script models.Script) models.ScriptResult {
+func (e *Executor) Execute(ctx context.Context, script models.Script) models.ScriptResult {
 	if e.Type() != script.Type() {
 		err := fmt.Errorf("not supported type: %s does not support %s", e.Type(), script.Type())
 		panic(err)
 	}
 
 	// Wait for target host is available.
-	mr := &executors.MergedResult{}
-	ctx, _ := context.WithTimeout(context.Background(), StartTimeout)
-	ticker := time.NewTicker(time.Second)
-	for {
-		r := e.executeOne("echo OK CONNECTED")
-		if r.ExitCode() == 0 {
-			if strings.Contains(string(r.Output()), "\nOK CONNECTED\n") {
-				// Command succeeded.
-				break
-			}
-			// Received ExitCode(0). But message is not contain in response.
-		}
-		mr.Append(r)
-
-		select {
-		case <-ticker.C:
-		case <-ctx.Done():
-			return mr
-		}
+	client, err := e.connect(ctx)
+	if err != nil {
+		return e.errorResult(err)
+	}
+	if e.Pool == nil {
+		defer client.Close()
 	}
 
 	// Execute commands
 	s := script.(*remoteshell.Script)
-	return e.executeMany(s.Commands)
+	return e.executeMany(ctx, client, s.Commands)
 }
-func (e *Executor) executeMany(cmds []string) models.ScriptResult {
+func (e *Executor) executeMany(ctx context.Context, client *ssh.Client, cmds []string) models.ScriptResult {
 	mr := &executors.MergedResult{
+		NameStr:          e.sshDestinationHost(),
 		WithoutSeparator: true,
 	}
 	for _, cmd := range cmds {
-		result := e.executeOne(cmd)
+		result := e.executeOne(ctx, client, cmd)
 		mr.Append(result)
 		if result.ExitCode() != 0 {
 			// Failed.  Stop jobs immediately.
@@ -81,49 +92,173 @@ func (e *Executor) executeMany(cmds []string) models.ScriptResult {
 	}
 	return mr
 }
-func (e *Executor) executeOne(cmd string) *Result {
-	sshCmd := e.sshCommand(cmd)
-	c := exec.Command(sshCmd[0], sshCmd[1:]...)
+func (e *Executor) executeOne(ctx context.Context, client *ssh.Client, cmd string) *Result {
 	r := &Result{
 		E:       e,
 		Command: cmd,
 		Start:   time.Now(),
 	}
-	out, err := c.CombinedOutput()
+	stream := executors.NewOutputStream(ctx, r.Host(), cmd)
+	defer stream.Close()
+
+	var stdout, stderr, combined bytes.Buffer
+	w := &syncWriter{w: io.MultiWriter(&combined, stream)}
+	err := func() error {
+		session, err := client.NewSession()
+		if err != nil {
+			return errors.Wrap(err, "failed to open session")
+		}
+		defer session.Close()
+		session.Stdout = io.MultiWriter(&stdout, w)
+		session.Stderr = io.MultiWriter(&stderr, w)
+
+		if err := session.Start(cmd); err != nil {
+			return err
+		}
+		done := make(chan error, 1)
+		go func() {
+			done <- session.Wait()
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			// Some servers do not support the signal.  Closing the session stops the command on these servers.
+			session.Signal(ssh.SIGKILL)
+			session.Close()
+			<-done
+			return ctx.Err()
+		}
+	}()
 	r.End = time.Now()
-	if _, ok := err.(*exec.ExitError); err == nil || ok {
-		r.Out = out
-		r.Code = c.ProcessState.ExitCode()
-		return r
-	}
-	// Unexpected error occurred.
-	r.Out = []byte(fmt.Sprintf("ERROR: %s", err.Error()))
-	r.Code = 1
+
+	switch err := err.(type) {
+	case nil:
+		r.Code = 0
+	case *ssh.ExitError:
+		r.Code = err.ExitStatus()
+	default:
+		// Unexpected error occurred.
+		fmt.Fprintf(w, "ERROR: %s", err.Error())
+		r.Code = 1
+	}
+	r.Out = combined.Bytes()
+	r.Stdout = stdout.Bytes()
+	r.Stderr = stderr.Bytes()
 	return r
 }
-func (e *Executor) sshCommand(remoteCmd string) []string {
-	dest := e.sshDestinationHost()
 
-	sshCmd := []string{"ssh"}
-	// Add options to disable known_hosts.
-	sshCmd = append(sshCmd, "-o", "StrictHostKeyChecking=no")
-	sshCmd = append(sshCmd, "-o", "UserKnownHostsFile=/dev/null")
-	// Add options to detect disconnection by the keep-alive feature.
-	sshCmd = append(sshCmd, "-o", "ServerAliveInterval=3")
-	sshCmd = append(sshCmd, "-o", "ServerAliveCountMax=10")
-	sshCmd = append(sshCmd, "--", dest, remoteCmd)
-	return sshCmd
+// connect returns a connection to the host.  It retries until the StartTimeout elapsed.
+// If the Pool is not nil, the connection in the pool is reused.
+func (e *Executor) connect(ctx context.Context) (*ssh.Client, error) {
+	if e.Pool != nil {
+		return e.Pool.Get(ctx, e.address(), e.dial)
+	}
+	return e.dial(ctx)
 }
-func (e *Executor) sshDestinationHost() string {
-	u := "root"
+func (e *Executor) dial(ctx context.Context) (*ssh.Client, error) {
+	startCtx, cancel := context.WithTimeout(ctx, StartTimeout)
+	defer cancel()
+
+	var hostKeyErr error
+	config := &ssh.ClientConfig{
+		User: e.user(),
+		Auth: e.Auth,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if e.HostKeys == nil {
+				return nil
+			}
+			hostKeyErr = e.HostKeys.Verify(e.Host, key)
+			return hostKeyErr
+		},
+		Timeout: WaitTimeout,
+	}
+	if len(config.Auth) == 0 {
+		config.Auth = DefaultAuthMethods()
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		client, err := dialContext(startCtx, e.address(), config)
+		if err == nil {
+			return client, nil
+		}
+		if hostKeyErr != nil {
+			// Retrying does not solve it.
+			return nil, hostKeyErr
+		}
+
+		select {
+		case <-ticker.C:
+		case <-startCtx.Done():
+			return nil, errors.Wrapf(err, "failed to connect to %s", e.sshDestinationHost())
+		}
+	}
+}
+func dialContext(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	d := net.Dialer{Timeout: config.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// Abort the handshake when the ctx is canceled.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+func (e *Executor) errorResult(err error) models.ScriptResult {
+	now := time.Now()
+	mr := &executors.MergedResult{
+		NameStr: e.sshDestinationHost(),
+	}
+	mr.Append(&Result{
+		E:     e,
+		Start: now,
+		End:   now,
+		Out:   []byte(fmt.Sprintf("ERROR: %s", err.Error())),
+		Code:  1,
+	})
+	return mr
+}
+func (e *Executor) address() string {
+	port := e.Port
+	if port == 0 {
+		port = DefaultPort
+	}
+	return net.JoinHostPort(e.Host, strconv.Itoa(port))
+}
+func (e *Executor) user() string {
 	if e.User != "" {
-		u = e.User
+		return e.User
 	}
-	return fmt.Sprintf("%s@%s", u, e.Host)
+	return "root"
+}
+func (e *Executor) sshDestinationHost() string {
+	return fmt.Sprintf("%s@%s", e.user(), e.Host)
 }
 func (r *Result) String() string {
 	return fmt.Sprintf("<RemoteSehllResult %s>", r.Command)
 }
+func (r *Result) Name() string {
+	return r.Command
+}
+func (r *Result) Children() []models.ScriptResult {
+	return nil
+}
 func (r *Result) StartTime() time.Time {
 	return r.Start
 }
@@ -135,7 +270,9 @@ func (r *Result) EndTime() time.Time {
 }
 func (r *Result) Output() []byte {
 	buf := bytes.Buffer{}
-	fmt.Fprintf(&buf, "%s$ %s\n", r.Host(), r.Command)
+	if r.Command != "" {
+		fmt.Fprintf(&buf, "%s$ %s\n", r.Host(), r.Command)
+	}
 	buf.Write(r.Out)
 	if len(r.Out) > 0 && !bytes.HasSuffix(r.Out, []byte("\n")) {
 		buf.WriteString("\n")
@@ -145,3 +282,9 @@ func (r *Result) Output() []byte {
 func (r *Result) ExitCode() int {
 	return r.Code
 }
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.w.Write(p)
+}
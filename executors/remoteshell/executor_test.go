@@ -0,0 +1,337 @@
+package remoteshell
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/clustertest/scripts/remoteshell"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testServer is an in-process SSH server that executes commands by /bin/sh.
+type testServer struct {
+	listener net.Listener
+	hostKey  ssh.Signer
+	// accepted is the number of accepted connections.
+	accepted int32
+	// stalled is non-zero if the server does not reply to the global requests.  It simulates the half-open connection.
+	stalled int32
+}
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+func newTestServer(t *testing.T, clientKey ssh.PublicKey) *testServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{
+		listener: l,
+		hostKey:  newTestSigner(t),
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, errors.New("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(s.hostKey)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&s.accepted, 1)
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+func (s *testServer) Close() {
+	s.listener.Close()
+}
+func (s *testServer) executor(signer ssh.Signer) *Executor {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return &Executor{
+		User: "test",
+		Host: host,
+		Port: p,
+		Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)},
+	}
+}
+func (s *testServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go func() {
+		for req := range reqs {
+			if atomic.LoadInt32(&s.stalled) != 0 {
+				continue
+			}
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}()
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		ch, reqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go s.session(ch, reqs)
+	}
+}
+func (s *testServer) session(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+	var m sync.Mutex
+	var cmd *exec.Cmd
+	done := make(chan struct{})
+	for {
+		select {
+		case req, ok := <-reqs:
+			if !ok {
+				return
+			}
+			switch req.Type {
+			case "exec":
+				var payload struct{ Command string }
+				ssh.Unmarshal(req.Payload, &payload)
+				m.Lock()
+				cmd = exec.Command("/bin/sh", "-c", payload.Command)
+				cmd.Stdin = ch
+				cmd.Stdout = ch
+				cmd.Stderr = ch.Stderr()
+				cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+				err := cmd.Start()
+				m.Unlock()
+				req.Reply(err == nil, nil)
+				if err != nil {
+					return
+				}
+				go func() {
+					code := 0
+					if err := cmd.Wait(); err != nil {
+						code = cmd.ProcessState.ExitCode()
+					}
+					ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(code)}))
+					close(done)
+				}()
+			case "signal":
+				m.Lock()
+				if cmd != nil {
+					syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+				}
+				m.Unlock()
+			default:
+				req.Reply(false, nil)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func TestExecutor_Execute(t *testing.T) {
+	clientKey := newTestSigner(t)
+
+	t.Run("should_success_with_a_command", func(t *testing.T) {
+		s := newTestServer(t, clientKey.PublicKey())
+		defer s.Close()
+		e := s.executor(clientKey)
+
+		r := e.Execute(context.Background(), &remoteshell.Script{
+			Commands: []string{"echo foo"},
+		})
+		assert.Equal(t, 0, r.ExitCode())
+		assert.Equal(t, "test@127.0.0.1$ echo foo\nfoo\n", string(r.Output()))
+	})
+
+	t.Run("should_separate_stdout_and_stderr", func(t *testing.T) {
+		s := newTestServer(t, clientKey.PublicKey())
+		defer s.Close()
+		e := s.executor(clientKey)
+
+		r := e.Execute(context.Background(), &remoteshell.Script{
+			Commands: []string{"echo out; echo err >&2"},
+		})
+		assert.Equal(t, 0, r.ExitCode())
+		if !assert.Len(t, r.Children(), 1) {
+			return
+		}
+		cr := r.Children()[0].(*Result)
+		assert.Equal(t, "out\n", string(cr.Stdout))
+		assert.Equal(t, "err\n", string(cr.Stderr))
+	})
+
+	t.Run("should_stop_when_command_failed", func(t *testing.T) {
+		s := newTestServer(t, clientKey.PublicKey())
+		defer s.Close()
+		e := s.executor(clientKey)
+
+		r := e.Execute(context.Background(), &remoteshell.Script{
+			Commands: []string{"echo foo", "exit 3", "echo bar"},
+		})
+		assert.Equal(t, 3, r.ExitCode())
+		assert.Len(t, r.Children(), 2)
+	})
+
+	t.Run("should_reuse_connection", func(t *testing.T) {
+		s := newTestServer(t, clientKey.PublicKey())
+		defer s.Close()
+		e := s.executor(clientKey)
+		e.Pool = NewConnPool()
+		defer e.Pool.Close()
+
+		script := &remoteshell.Script{
+			Commands: []string{"true", "true"},
+		}
+		assert.Equal(t, 0, e.Execute(context.Background(), script).ExitCode())
+		assert.Equal(t, 0, e.Execute(context.Background(), script).ExitCode())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&s.accepted))
+	})
+
+	t.Run("should_redial_when_connection_is_stalled", func(t *testing.T) {
+		defer func(d time.Duration) { keepaliveTimeout = d }(keepaliveTimeout)
+		keepaliveTimeout = 200 * time.Millisecond
+
+		s := newTestServer(t, clientKey.PublicKey())
+		defer s.Close()
+		e := s.executor(clientKey)
+		e.Pool = NewConnPool()
+		defer e.Pool.Close()
+
+		script := &remoteshell.Script{
+			Commands: []string{"true"},
+		}
+		assert.Equal(t, 0, e.Execute(context.Background(), script).ExitCode())
+		atomic.StoreInt32(&s.stalled, 1)
+		start := time.Now()
+		assert.Equal(t, 0, e.Execute(context.Background(), script).ExitCode())
+		assert.True(t, time.Since(start) < 5*time.Second)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&s.accepted))
+	})
+
+	t.Run("should_abort_liveness_probe_when_canceled", func(t *testing.T) {
+		s := newTestServer(t, clientKey.PublicKey())
+		defer s.Close()
+		e := s.executor(clientKey)
+		e.Pool = NewConnPool()
+		defer e.Pool.Close()
+
+		script := &remoteshell.Script{
+			Commands: []string{"true"},
+		}
+		assert.Equal(t, 0, e.Execute(context.Background(), script).ExitCode())
+		atomic.StoreInt32(&s.stalled, 1)
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		assert.NotEqual(t, 0, e.Execute(ctx, script).ExitCode())
+		assert.True(t, time.Since(start) < keepaliveTimeout)
+	})
+
+	t.Run("should_reject_changed_host_key", func(t *testing.T) {
+		s := newTestServer(t, clientKey.PublicKey())
+		defer s.Close()
+		e := s.executor(clientKey)
+		e.HostKeys = NewHostKeyStore()
+		e.HostKeys.Pin(e.Host, newTestSigner(t).PublicKey())
+
+		r := e.Execute(context.Background(), &remoteshell.Script{
+			Commands: []string{"echo foo"},
+		})
+		assert.Equal(t, 1, r.ExitCode())
+		assert.Contains(t, string(r.Output()), "host key mismatch")
+	})
+
+	t.Run("should_accept_pinned_host_key", func(t *testing.T) {
+		s := newTestServer(t, clientKey.PublicKey())
+		defer s.Close()
+		e := s.executor(clientKey)
+		e.HostKeys = NewHostKeyStore()
+		e.HostKeys.Pin(e.Host, s.hostKey.PublicKey())
+
+		r := e.Execute(context.Background(), &remoteshell.Script{
+			Commands: []string{"true"},
+		})
+		assert.Equal(t, 0, r.ExitCode())
+	})
+
+	t.Run("should_reject_unknown_host_key_without_tofu", func(t *testing.T) {
+		s := newTestServer(t, clientKey.PublicKey())
+		defer s.Close()
+		e := s.executor(clientKey)
+		e.HostKeys = NewHostKeyStore()
+
+		r := e.Execute(context.Background(), &remoteshell.Script{
+			Commands: []string{"true"},
+		})
+		assert.Equal(t, 1, r.ExitCode())
+		assert.Contains(t, string(r.Output()), "host key is not pinned")
+		assert.Nil(t, e.HostKeys.Get(e.Host))
+	})
+
+	t.Run("should_pin_host_key_on_first_connection", func(t *testing.T) {
+		s := newTestServer(t, clientKey.PublicKey())
+		defer s.Close()
+		e := s.executor(clientKey)
+		e.HostKeys = NewHostKeyStore()
+		e.HostKeys.TOFU = true
+
+		r := e.Execute(context.Background(), &remoteshell.Script{
+			Commands: []string{"true"},
+		})
+		assert.Equal(t, 0, r.ExitCode())
+		pinned := e.HostKeys.Get(e.Host)
+		if assert.NotNil(t, pinned) {
+			assert.Equal(t, s.hostKey.PublicKey().Marshal(), pinned.Marshal())
+		}
+	})
+
+	t.Run("should_kill_process_when_canceled", func(t *testing.T) {
+		s := newTestServer(t, clientKey.PublicKey())
+		defer s.Close()
+		e := s.executor(clientKey)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			cancel()
+		}()
+		start := time.Now()
+		r := e.Execute(ctx, &remoteshell.Script{
+			Commands: []string{"sleep 10"},
+		})
+		assert.NotEqual(t, 0, r.ExitCode())
+		assert.True(t, time.Since(start) < 5*time.Second)
+	})
+}
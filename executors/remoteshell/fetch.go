@@ -0,0 +1,132 @@
+package remoteshell
+
+import (
+	"archive/tar"
+	"context"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Fetch copies the files matched with the patterns from the remote host.
+// The globs in the patterns (e.g. "/var/log/*.log") are expanded by the remote shell.  Other characters are quoted,
+// so the patterns cannot contain other shell expressions (e.g. variables or commands).
+// The fn is called for each regular file with the path on the remote host.  The leading "/" of the path is removed.
+// The patterns which do not match any files are ignored.
+func (e *Executor) Fetch(ctx context.Context, patterns []string, fn func(name string, r io.Reader) error) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+	client, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if e.Pool == nil {
+		defer client.Close()
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return errors.Wrap(err, "failed to open session")
+	}
+	defer session.Close()
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	// Use the tar command to transfer files because it is available on almost all hosts.
+	quoted := make([]string, len(patterns))
+	for i, p := range patterns {
+		quoted[i] = globQuote(p)
+	}
+	cmd := "tar -cf - -- " + strings.Join(quoted, " ") + " 2>/dev/null"
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+
+	tr := tar.NewReader(stdout)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read the archive")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(strings.TrimPrefix(hdr.Name, "/"), tr); err != nil {
+			return err
+		}
+	}
+	// Discard the padding of the archive.
+	io.Copy(ioutil.Discard, stdout)
+
+	err = session.Wait()
+	if _, ok := err.(*ssh.ExitError); ok {
+		// The tar command returns non-zero code if some patterns do not match any files.
+		return nil
+	}
+	return err
+}
+
+// globQuote quotes the pattern for the POSIX shell except for the globs ("*", "?" and the bracket expressions).
+// The special characters in the bracket expressions are escaped by backslashes.
+func globQuote(pattern string) string {
+	var b strings.Builder
+	quoting := false
+	inBracket := false
+	for i, c := range pattern {
+		var isGlob bool
+		switch {
+		case inBracket:
+			isGlob = true
+			if c == ']' {
+				inBracket = false
+			}
+		case c == '[' && strings.ContainsRune(pattern[i+1:], ']'):
+			isGlob = true
+			inBracket = true
+		case c == '*' || c == '?':
+			isGlob = true
+		}
+		if isGlob == quoting {
+			// Open or close the quotation.
+			b.WriteByte('\'')
+			quoting = !quoting
+		}
+		switch {
+		case quoting && c == '\'':
+			b.WriteString(`'\''`)
+		case !quoting && !isBracketSafe(c):
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	if quoting {
+		b.WriteByte('\'')
+	}
+	if b.Len() == 0 {
+		return "''"
+	}
+	return b.String()
+}
+
+// isBracketSafe returns true if the c can be written in the bracket expressions without escaping.
+func isBracketSafe(c rune) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune("*?[]!^-.", c)
+}
@@ -0,0 +1,81 @@
+package remoteshell
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecutor_Fetch(t *testing.T) {
+	clientKey := newTestSigner(t)
+
+	t.Run("should_fetch_files_matched_with_patterns", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "clustertest-fetch-")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer os.RemoveAll(dir)
+		ioutil.WriteFile(filepath.Join(dir, "a.log"), []byte("foo"), 0644)
+		ioutil.WriteFile(filepath.Join(dir, "b.log"), []byte("bar"), 0644)
+		ioutil.WriteFile(filepath.Join(dir, "c.txt"), []byte("baz"), 0644)
+
+		s := newTestServer(t, clientKey.PublicKey())
+		defer s.Close()
+		e := s.executor(clientKey)
+
+		files := map[string]string{}
+		err = e.Fetch(context.Background(), []string{dir + "/*.log", dir + "/not-found"}, func(name string, r io.Reader) error {
+			b, err := ioutil.ReadAll(r)
+			files[name] = string(b)
+			return err
+		})
+		assert.NoError(t, err)
+		prefix := strings.TrimPrefix(dir, "/")
+		assert.Equal(t, map[string]string{
+			prefix + "/a.log": "foo",
+			prefix + "/b.log": "bar",
+		}, files)
+	})
+
+	t.Run("should_quote_patterns", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "clustertest-fetch-")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer os.RemoveAll(dir)
+		ioutil.WriteFile(filepath.Join(dir, "it's a.log"), []byte("foo"), 0644)
+
+		s := newTestServer(t, clientKey.PublicKey())
+		defer s.Close()
+		e := s.executor(clientKey)
+
+		files := map[string]string{}
+		patterns := []string{dir + "/it's *.log", dir + "/$(touch injected)", dir + "/;touch injected"}
+		err = e.Fetch(context.Background(), patterns, func(name string, r io.Reader) error {
+			b, err := ioutil.ReadAll(r)
+			files[name] = string(b)
+			return err
+		})
+		assert.NoError(t, err)
+		prefix := strings.TrimPrefix(dir, "/")
+		assert.Equal(t, map[string]string{
+			prefix + "/it's a.log": "foo",
+		}, files)
+		_, err = os.Stat("injected")
+		assert.True(t, os.IsNotExist(err), "the pattern is executed as a command")
+	})
+}
+
+func TestGlobQuote(t *testing.T) {
+	assert.Equal(t, `'/var/log/'*'.log'`, globQuote("/var/log/*.log"))
+	assert.Equal(t, `'/tmp/it'\''s'`, globQuote("/tmp/it's"))
+	assert.Equal(t, `'a'[0-9]'b'?`, globQuote("a[0-9]b?"))
+	assert.Equal(t, `'a['`, globQuote("a["))
+	assert.Equal(t, `[\$\(x\)]`, globQuote("[$(x)]"))
+	assert.Equal(t, `''`, globQuote(""))
+}
@@ -0,0 +1,65 @@
+package remoteshell
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"sync"
+)
+
+// HostKeyStore pins the host keys of hosts.
+// The connections are rejected if the host presents a different key from the pinned key.  The keys are pinned by
+// Pin() (e.g. the key injected to the VM by the provisioner) or by the trust on first use (TOFU).
+// It is safe for concurrent use.
+type HostKeyStore struct {
+	// TOFU is true if the key presented on the first connection to the host is trusted without verification.
+	// It detects the host key changes while running a task, but it cannot detect an attacker on the first connection.
+	// If it is false, the connections to the hosts without pinned keys are rejected.
+	TOFU bool
+	m    sync.Mutex
+	keys map[string]ssh.PublicKey
+}
+
+// NewHostKeyStore returns an empty HostKeyStore.
+func NewHostKeyStore() *HostKeyStore {
+	return &HostKeyStore{
+		keys: map[string]ssh.PublicKey{},
+	}
+}
+
+// Pin registers the host key of the host.
+func (s *HostKeyStore) Pin(host string, key ssh.PublicKey) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.keys[host] = key
+}
+
+// Get returns the pinned host key.  If the key is not pinned, it returns nil.
+func (s *HostKeyStore) Get(host string) ssh.PublicKey {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.keys[host]
+}
+
+// Verify checks the key presented by the host.
+// If the host key is not pinned yet, the key is pinned only if the TOFU is true.
+func (s *HostKeyStore) Verify(host string, key ssh.PublicKey) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	pinned, ok := s.keys[host]
+	if !ok {
+		if !s.TOFU {
+			return errors.Errorf("host key is not pinned: %s presented %s %s", host, key.Type(), ssh.FingerprintSHA256(key))
+		}
+		s.keys[host] = key
+		return nil
+	}
+	if pinned.Type() != key.Type() || !bytes.Equal(pinned.Marshal(), key.Marshal()) {
+		return errors.Errorf(
+			"host key mismatch: %s presented %s %s, but %s %s is pinned",
+			host, key.Type(), ssh.FingerprintSHA256(key), pinned.Type(), ssh.FingerprintSHA256(pinned),
+		)
+	}
+	return nil
+}
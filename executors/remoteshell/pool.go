@@ -0,0 +1,108 @@
+package remoteshell
+
+import (
+	"context"
+	"golang.org/x/crypto/ssh"
+	"sync"
+	"time"
+)
+
+// keepaliveTimeout is the timeout of the liveness probe of the pooled connection.
+// The half-open connection (e.g. the host is rebooted) does not reply to the probe.
+var keepaliveTimeout = 5 * time.Second
+
+// ConnPool keeps SSH connections to reuse them across commands and scripts.
+// It is safe for concurrent use.
+type ConnPool struct {
+	m     sync.Mutex
+	conns map[string]*poolEntry
+}
+type poolEntry struct {
+	// m prevents to dial the same address concurrently.
+	m      sync.Mutex
+	client *ssh.Client
+}
+
+// NewConnPool returns an empty ConnPool.
+func NewConnPool() *ConnPool {
+	return &ConnPool{
+		conns: map[string]*poolEntry{},
+	}
+}
+
+// Get returns a connection to the addr.
+// If the pool does not have an active connection, it creates new connection by the dial.
+func (p *ConnPool) Get(ctx context.Context, addr string, dial func(ctx context.Context) (*ssh.Client, error)) (*ssh.Client, error) {
+	p.m.Lock()
+	e, ok := p.conns[addr]
+	if !ok {
+		e = &poolEntry{}
+		p.conns[addr] = e
+	}
+	p.m.Unlock()
+
+	e.m.Lock()
+	defer e.m.Unlock()
+	if e.client != nil {
+		// Check whether the connection is alive.  The host may be rebooted by the previous script.
+		alive, err := probe(ctx, e.client)
+		if err != nil {
+			return nil, err
+		}
+		if alive {
+			return e.client, nil
+		}
+		e.client.Close()
+		e.client = nil
+	}
+
+	client, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e.client = client
+	return client, nil
+}
+
+// probe sends the keepalive request and returns true if the connection replied in the keepaliveTimeout.
+// It returns an error only if the ctx is done.
+func probe(ctx context.Context, client *ssh.Client) (bool, error) {
+	// Buffered to finish the goroutine even if no one receives the result.
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		done <- err
+	}()
+
+	timer := time.NewTimer(keepaliveTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err == nil, nil
+	case <-timer.C:
+		// The request is aborted when the caller closes the client.
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// Close closes all connections.
+func (p *ConnPool) Close() error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	var firstErr error
+	for addr, e := range p.conns {
+		e.m.Lock()
+		if e.client != nil {
+			if err := e.client.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			e.client = nil
+		}
+		e.m.Unlock()
+		delete(p.conns, addr)
+	}
+	return firstErr
+}
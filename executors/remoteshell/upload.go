@@ -0,0 +1,57 @@
+package remoteshell
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// Upload writes the content read from the r to the dest on the remote host.
+// The parent directories of the dest are created if they do not exist.
+func (e *Executor) Upload(ctx context.Context, dest string, mode os.FileMode, r io.Reader) error {
+	client, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if e.Pool == nil {
+		defer client.Close()
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return errors.Wrap(err, "failed to open session")
+	}
+	defer session.Close()
+	var stderr strings.Builder
+	session.Stdin = r
+	session.Stderr = &stderr
+
+	q := shellQuote(dest)
+	cmd := fmt.Sprintf(`mkdir -p "$(dirname %s)" && cat > %s && chmod %o %s`, q, q, mode.Perm(), q)
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		session.Close()
+		<-done
+		return ctx.Err()
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload %s: %s", dest, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// shellQuote quotes the s for the POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,58 @@
+package executors
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/yuuki0xff/clustertest/models"
+	"io"
+)
+
+// OutputStream streams the output of a command to the writer associated with the ctx.
+// Scripts on many hosts may be executed in parallel, so it writes line by line with the host name as a prefix.
+type OutputStream struct {
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+// NewOutputStream writes the command line and returns a OutputStream.
+// Caller must call Close() after the command finished.
+func NewOutputStream(ctx context.Context, host, cmd string) *OutputStream {
+	s := &OutputStream{
+		w:      models.OutputWriter(ctx),
+		prefix: fmt.Sprintf("[%s] ", host),
+	}
+	s.writeLine([]byte(fmt.Sprintf("$ %s\n", cmd)))
+	return s
+}
+
+// Write writes complete lines to the underlying writer and buffers the rest.
+// It never fails even if the underlying writer returns an error.
+func (s *OutputStream) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			break
+		}
+		s.writeLine(s.buf[:i+1])
+		s.buf = s.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close flushes the incomplete line.
+func (s *OutputStream) Close() error {
+	if len(s.buf) > 0 {
+		s.writeLine(append(s.buf, '\n'))
+		s.buf = nil
+	}
+	return nil
+}
+func (s *OutputStream) writeLine(line []byte) {
+	b := make([]byte, 0, len(s.prefix)+len(line))
+	b = append(b, s.prefix...)
+	b = append(b, line...)
+	s.w.Write(b)
+}
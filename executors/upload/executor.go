@@ -0,0 +1,175 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/yuuki0xff/clustertest/executors"
+	"github.com/yuuki0xff/clustertest/models"
+	"github.com/yuuki0xff/clustertest/scripts/upload"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+const supportedType = models.ScriptType("upload")
+const defaultMode = os.FileMode(0644)
+
+// Executor uploads files to the host.
+type Executor struct {
+	// Remote writes the files to the host (e.g. *remoteshell.Executor).
+	Remote Uploader
+	// Data is passed to the templates.  The Data.Host is shown in the results.
+	Data *TemplateData
+}
+
+// Uploader writes the content read from the r to the dest on the host.
+type Uploader interface {
+	Upload(ctx context.Context, dest string, mode os.FileMode, r io.Reader) error
+}
+
+// TemplateData is the data passed to the templates.
+type TemplateData struct {
+	// Host is the address of the destination host.
+	Host string
+	// Group is the name of the VM group.
+	Group string
+	// Hosts is the addresses of all hosts grouped by name of the VM group.
+	Hosts map[string][]string
+}
+
+// Result represents the result of a file.
+type Result struct {
+	E     *Executor
+	File  *upload.File
+	Start time.Time
+	End   time.Time
+	Out   []byte
+	Code  int
+}
+
+func (e *Executor) String() string {
+	return "<UploadExecutor>"
+}
+func (e *Executor) Type() models.ScriptType {
+	return supportedType
+}
+func (e *Executor) Execute(ctx context.Context, script models.Script) models.ScriptResult {
+	if e.Type() != script.Type() {
+		err := fmt.Errorf("not supported type: %s does not support %s", e.Type(), script.Type())
+		panic(err)
+	}
+
+	s := script.(*upload.Script)
+	mr := &executors.MergedResult{
+		NameStr:          e.Data.Host,
+		WithoutSeparator: true,
+	}
+	for _, f := range s.Files {
+		result := e.uploadOne(ctx, f)
+		mr.Append(result)
+		if result.ExitCode() != 0 {
+			// Failed.  Stop jobs immediately.
+			return mr
+		}
+	}
+	return mr
+}
+func (e *Executor) uploadOne(ctx context.Context, f *upload.File) *Result {
+	r := &Result{
+		E:     e,
+		File:  f,
+		Start: time.Now(),
+	}
+	stream := executors.NewOutputStream(ctx, r.Host(), r.Name())
+	defer stream.Close()
+
+	err := func() error {
+		mode, err := parseMode(f.Mode)
+		if err != nil {
+			return err
+		}
+		r, err := e.open(ctx, f)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		return e.Remote.Upload(ctx, f.Dest, mode, r)
+	}()
+	r.End = time.Now()
+	if err != nil {
+		r.Out = []byte(fmt.Sprintf("ERROR: %s", err.Error()))
+		r.Code = 1
+		stream.Write(r.Out)
+	}
+	return r
+}
+
+// open returns the content of the source file attached to the task.  If the file is a template, it returns the
+// rendered content.  Caller must close it.
+// The files on the daemon host are not read, so the configs cannot read arbitrary files on the daemon host.
+func (e *Executor) open(ctx context.Context, f *upload.File) (io.ReadCloser, error) {
+	b, ok := models.LocalFile(ctx, f.Src)
+	if !ok {
+		return nil, errors.Errorf("the file is not attached to the task (submit the task by the clustertest command): %s", f.Src)
+	}
+	if !f.Template {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+
+	tmpl, err := template.New(f.Src).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse template")
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, e.Data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to render template")
+	}
+	return ioutil.NopCloser(&buf), nil
+}
+func parseMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return defaultMode, nil
+	}
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, errors.Errorf("invalid mode: %s", s)
+	}
+	return os.FileMode(m), nil
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf("<UploadResult %s>", r.File.Dest)
+}
+func (r *Result) Name() string {
+	return fmt.Sprintf("upload %s %s", r.File.Src, r.File.Dest)
+}
+func (r *Result) Children() []models.ScriptResult {
+	return nil
+}
+func (r *Result) StartTime() time.Time {
+	return r.Start
+}
+func (r *Result) Host() string {
+	return r.E.Data.Host
+}
+func (r *Result) EndTime() time.Time {
+	return r.End
+}
+func (r *Result) Output() []byte {
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "%s$ %s\n", r.Host(), r.Name())
+	buf.Write(r.Out)
+	if len(r.Out) > 0 && !bytes.HasSuffix(r.Out, []byte("\n")) {
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+func (r *Result) ExitCode() int {
+	return r.Code
+}
@@ -0,0 +1,84 @@
+package upload
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/clustertest/models"
+	"github.com/yuuki0xff/clustertest/scripts/upload"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExecutor_open(t *testing.T) {
+	src := "templates/hosts.tmpl"
+	ctx := models.WithLocalFiles(context.Background(), map[string][]byte{
+		src: []byte(`{{ .Group }} {{ .Host }}{{ range .Hosts.db }} {{ . }}{{ end }}`),
+	})
+
+	e := &Executor{
+		Data: &TemplateData{
+			Host:  "192.168.0.10",
+			Group: "web",
+			Hosts: map[string][]string{
+				"web": {"192.168.0.10"},
+				"db":  {"192.168.0.20", "192.168.0.21"},
+			},
+		},
+	}
+
+	t.Run("should_render_template", func(t *testing.T) {
+		b, err := readAll(e.open(ctx, &upload.File{Src: src, Template: true}))
+		assert.NoError(t, err)
+		assert.Equal(t, "web 192.168.0.10 192.168.0.20 192.168.0.21", string(b))
+	})
+
+	t.Run("should_not_render_when_template_is_disabled", func(t *testing.T) {
+		b, err := readAll(e.open(ctx, &upload.File{Src: src}))
+		assert.NoError(t, err)
+		assert.Equal(t, `{{ .Group }} {{ .Host }}{{ range .Hosts.db }} {{ . }}{{ end }}`, string(b))
+	})
+
+	t.Run("should_fail_when_file_is_not_attached", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "clustertest-upload-")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "hosts")
+		ioutil.WriteFile(path, []byte("daemon"), 0644)
+
+		// The files on the daemon host are not read.
+		_, err = e.open(ctx, &upload.File{Src: path})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "the file is not attached to the task")
+		}
+	})
+}
+
+func readAll(r io.ReadCloser, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func TestParseMode(t *testing.T) {
+	t.Run("should_parse_octal", func(t *testing.T) {
+		m, err := parseMode("0755")
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0755), m)
+	})
+	t.Run("should_return_default_mode", func(t *testing.T) {
+		m, err := parseMode("")
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0644), m)
+	})
+	t.Run("should_fail_with_invalid_mode", func(t *testing.T) {
+		_, err := parseMode("rwx")
+		assert.Error(t, err)
+	})
+}
@@ -15,5 +15,6 @@ require (
 	github.com/stretchr/testify v1.4.0
 	github.com/ybbus/jsonrpc v2.1.2+incompatible
 	github.com/yuuki0xff/yaml v2.1.0+incompatible
+	golang.org/x/crypto v0.0.0-20200220183623-bac4c82f6975
 	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e
 )
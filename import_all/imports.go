@@ -1,9 +1,12 @@
 package import_all
 
 import (
+	_ "github.com/yuuki0xff/clustertest/provisioners/fake"
 	_ "github.com/yuuki0xff/clustertest/provisioners/proxmoxve"
+	_ "github.com/yuuki0xff/clustertest/provisioners/statichosts"
 	_ "github.com/yuuki0xff/clustertest/scripts/localshell"
 	_ "github.com/yuuki0xff/clustertest/scripts/remoteshell"
+	_ "github.com/yuuki0xff/clustertest/scripts/upload"
 )
 
 // Import all standard provisioners and scripts.
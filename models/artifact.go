@@ -0,0 +1,20 @@
+package models
+
+import (
+	"context"
+	"io"
+)
+
+// Artifact is a file collected from the hosts.
+type Artifact struct {
+	// Name is a slash-separated relative path (e.g. "web/192.168.0.10/var/log/syslog").
+	Name string
+	// Size of the file in bytes.
+	Size int64
+}
+
+// ArtifactCollector is implemented by the Provisioner which can fetch files from the hosts.
+type ArtifactCollector interface {
+	// CollectArtifacts fetches the files specified in the script config and passes them to the fn.
+	CollectArtifacts(ctx context.Context, fn func(name string, r io.Reader) error) error
+}
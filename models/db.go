@@ -3,14 +3,32 @@ package models
 import (
 	"context"
 	"errors"
+	"io"
 )
 
+// TaskDB stores tasks.
+// The methods return TaskNotFoundError if the task is not found, InvalidStateError or AlreadyRunningError if the
+// operation is not allowed in the current state.
 type TaskDB interface {
 	Create(task Task) (TaskID, error)
 	Inspect(id TaskID) (TaskDetail, error)
+	// Resolve returns the ID of the task specified by the ID or the name.
+	// If some tasks have the same name, the latest one is returned.
+	Resolve(ref string) (TaskID, error)
 	Wait(id TaskID, ctx context.Context) error
 	Cancel(id TaskID) error
+	// Release releases the held infrastructure of the task.
+	Release(id TaskID) error
 	Delete(id TaskID) error
+	// Logs returns the output of the task after the offset.
+	// The output is available while the task is running.
+	Logs(id TaskID, offset int) ([]byte, error)
+	// WaitLogs waits until the output after the offset is available or the task is finished.
+	WaitLogs(id TaskID, offset int, ctx context.Context) error
+	// Artifacts returns the list of files collected from the hosts.
+	Artifacts(id TaskID) ([]Artifact, error)
+	// OpenArtifact opens the artifact.  Caller must close it.
+	OpenArtifact(id TaskID, name string) (io.ReadCloser, error)
 	List() ([]TaskDetail, error)
 }
 
@@ -18,7 +36,27 @@ type TaskQueue interface {
 	// Consume a task.
 	// If queue is empty, it will return QueueEmpty.
 	Consume(fn TaskConsumer) error
+	// Changed returns a channel that is closed when any task is changed.
+	// It allows consumers to wait for new tasks without polling.
+	Changed() <-chan struct{}
+}
+
+// TaskConsumer executes the task and returns the result.
+// The ctx will be canceled when the task is canceled by user.
+type TaskConsumer func(ctx context.Context, id TaskID, task Task, h TaskHandle) (TaskResult, error)
+
+// TaskHandle allows the TaskConsumer to update the running task.
+type TaskHandle interface {
+	// Hold changes the task state to holding and blocks until the task is released, the deadline of the hold
+	// expires or the ctx is canceled.
+	Hold(ctx context.Context, info HoldInfo)
+	// SetPhase changes the task state to the phase (e.g. ReservingTaskState).
+	SetPhase(state string)
+	// Output returns a writer to stream the output of the task.
+	// It is safe for concurrent use.
+	Output() io.Writer
+	// SaveArtifact stores a file collected from the hosts.
+	SaveArtifact(name string, r io.Reader) error
 }
-type TaskConsumer func(id TaskID, task Task) (TaskResult, error)
 
 var QueueEmpty = errors.New("queue empty")
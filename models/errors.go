@@ -0,0 +1,45 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TaskNotFoundError means the task does not exist.
+type TaskNotFoundError struct {
+	ID string
+}
+
+// InvalidStateError means the operation is not allowed in the current state of the task.
+type InvalidStateError struct {
+	ID string
+	// Op is the name of the operation (e.g. "cancel").
+	Op    string
+	State string
+}
+
+// AlreadyRunningError means the operation is not allowed because the task is running.
+type AlreadyRunningError struct {
+	ID    string
+	Op    string
+	State string
+}
+
+// AmbiguousTaskError means the reference matches the ID of a task and the name of another task.
+type AmbiguousTaskError struct {
+	Ref string
+	IDs []string
+}
+
+func (e *TaskNotFoundError) Error() string {
+	return fmt.Sprintf("not found task: %s", e.ID)
+}
+func (e *AmbiguousTaskError) Error() string {
+	return fmt.Sprintf("ambiguous task: %s matches tasks %s", e.Ref, strings.Join(e.IDs, ", "))
+}
+func (e *InvalidStateError) Error() string {
+	return fmt.Sprintf("failed to %s task: task(%s) is %s", e.Op, e.ID, e.State)
+}
+func (e *AlreadyRunningError) Error() string {
+	return fmt.Sprintf("failed to %s task: task(%s) is already running (%s)", e.Op, e.ID, e.State)
+}
@@ -1,12 +1,16 @@
 package models
 
+import "context"
+
 // Provisioner build/manage/destroy infrastructures.
 //
 // The infrastructure specification called to Spec.
 // Spec is specified when creating a Provisioner instance.
+// Reserve and Create should return as soon as possible when the ctx is canceled.  Delete is called even after the ctx
+// is canceled, so it does not take the ctx.
 type Provisioner interface {
-	Reserve() error
-	Create() error
+	Reserve(ctx context.Context) error
+	Create(ctx context.Context) error
 	Delete() error
 	Spec() Spec
 	Config() InfraConfig
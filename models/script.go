@@ -1,7 +1,10 @@
 package models
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
 	"time"
 )
@@ -31,13 +34,22 @@ type Script interface {
 	SetAttr(key, value interface{})
 	// GetAttr gets a value from attributes.
 	GetAttr(key interface{}) interface{}
+	// Validate checks the fields and returns all problems.  It returns nil if the script is valid.
+	Validate() ValidationErrors
 	// Type specific methods
 	// ...
 }
 
 // ScriptResult represents an execution result of script.
+// The results are organized as a tree.  For example, the result of the main script has results of each provisioner,
+// each VM group, each VM and each command as descendants.
 type ScriptResult interface {
 	fmt.Stringer
+	// Name returns a short description of this result (e.g. name of VM group, host name or command line).
+	Name() string
+	// Children returns the results of the sub-tasks.
+	// If the result is a leaf, it returns nil.
+	Children() []ScriptResult
 	StartTime() time.Time
 	EndTime() time.Time
 	// Host returns host ID where the script was executed.
@@ -59,5 +71,45 @@ type ScriptExecutor interface {
 	// Execute method executes the script and returns result.
 	// If unsupported type of script passed, it will be panic.
 	// Caller must check script type before calling this method.
-	Execute(script Script) ScriptResult
+	// When the ctx is canceled, the executor should kill running processes and return immediately.
+	// The executor should write the output to the writer returned by OutputWriter(ctx) as it arrives.
+	Execute(ctx context.Context, script Script) ScriptResult
+}
+
+// LocalFileReferrer is implemented by the scripts that read files on the host running the clustertest command.
+// The command reads the files and attaches them to the task on submission.
+type LocalFileReferrer interface {
+	// LocalFiles returns the paths of the files as written in the config.
+	LocalFiles() []string
+}
+
+type outputWriterKey struct{}
+type localFilesKey struct{}
+
+// WithOutputWriter returns a copy of the ctx with the writer to stream the output of scripts.
+func WithOutputWriter(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, outputWriterKey{}, w)
+}
+
+// OutputWriter returns the writer associated with the ctx.
+// If the ctx does not have it, it returns ioutil.Discard.
+func OutputWriter(ctx context.Context) io.Writer {
+	if w, ok := ctx.Value(outputWriterKey{}).(io.Writer); ok {
+		return w
+	}
+	return ioutil.Discard
+}
+
+// WithLocalFiles returns a copy of the ctx with the contents of the local files attached to the task.
+// The keys of the files are the paths written in the config.
+func WithLocalFiles(ctx context.Context, files map[string][]byte) context.Context {
+	return context.WithValue(ctx, localFilesKey{}, files)
+}
+
+// LocalFile returns the content of the local file attached to the task.
+// It returns false if the file is not attached.
+func LocalFile(ctx context.Context, path string) ([]byte, bool) {
+	files, _ := ctx.Value(localFilesKey{}).(map[string][]byte)
+	b, ok := files[path]
+	return b, ok
 }
@@ -11,10 +11,15 @@ type SpecType string
 type Spec interface {
 	fmt.Stringer
 	Type() SpecType
+	// Validate checks the fields and returns all problems.  It returns nil if the spec is valid.
+	// The paths in the problems are relative to the spec (e.g. "vms.web.nodes").
+	Validate() ValidationErrors
 }
 
 // InfraConfig represents current infrastructure configuration.
 type InfraConfig interface {
 	fmt.Stringer
 	Spec() Spec
+	// Hosts returns SSH destinations (e.g. "root@192.168.0.10") of hosts grouped by name of host group.
+	Hosts() map[string][]string
 }
@@ -2,11 +2,65 @@ package models
 
 import (
 	"fmt"
+	"time"
 )
 
+const WaitingTaskState = "waiting"
+
+// RunningTaskState means the task is started, but the consumer does not report the phase yet.
+const RunningTaskState = "running"
+
+// Phases of the running task.  They are reported by the consumer via TaskHandle.SetPhase().
+const ReservingTaskState = "reserving"
+const CreatingTaskState = "creating"
+const BeforeTaskState = "before"
+const MainTaskState = "main"
+const AfterTaskState = "after"
+const DeletingTaskState = "deleting"
+
+// HoldingTaskState means the task is failed and the infrastructure is held for debugging.
+const HoldingTaskState = "holding"
+
+// SucceededTaskState means all scripts are succeeded.
+const SucceededTaskState = "succeeded"
+
+// FailedTaskState means a script is failed.
+const FailedTaskState = "failed"
+
+// ErroredTaskState means the task could not run scripts (e.g. invalid spec or failed to create VMs).
+const ErroredTaskState = "errored"
+const CanceledTaskState = "canceled"
+
+// InterruptedTaskState means the task was running when the daemon stopped.
+// The task will never be resumed.
+const InterruptedTaskState = "interrupted"
+
+// UnknownTaskState means the task is not found (e.g. already deleted).
+const UnknownTaskState = "unknown"
+
 type Task interface {
 	fmt.Stringer
 	SpecData() []byte
+	Options() TaskOptions
+}
+
+// TaskOptions represents optional parameters of a task specified on submission.
+type TaskOptions struct {
+	// HoldOnFailure is a duration to keep the infrastructure after a script failed.
+	// If it is zero, the value in the config file is used.
+	HoldOnFailure time.Duration
+	// Priority of the task.  The task with higher priority is executed first.
+	// The tasks with the same priority are executed in order of submission.
+	Priority int
+	// Name is used to refer the task instead of the ID.
+	// If it is empty, the name of the config is used.
+	Name string
+	// Labels are arbitrary key-value pairs to select tasks (e.g. branch=main).
+	Labels map[string]string
+	// Submitter is the user who submitted the task (e.g. "alice@host").
+	Submitter string
+	// Vars are the variables used to render the config on submission.  It is recorded to reproduce the task.
+	Vars map[string]interface{}
 }
 type TaskID interface {
 	fmt.Stringer
@@ -16,11 +70,65 @@ type TaskDetail interface {
 	TaskID() TaskID
 	State() string
 	Result() TaskResult
+	// CreatedTime returns the time when the task was created.
+	CreatedTime() time.Time
+	// History returns the state transitions in chronological order.
+	// The last one is the current state.
+	History() []StateTransition
+	// Options returns the options specified on submission.
+	Options() TaskOptions
+	// HoldInfo returns information of the held infrastructure.
+	// If the task is not in the holding state, it returns nil.
+	HoldInfo() *HoldInfo
+}
+
+// StateTransition represents that the task entered the State at the Time.
+type StateTransition struct {
+	State string
+	Time  time.Time
+}
+
+// HoldInfo represents the infrastructure held for debugging.
+type HoldInfo struct {
+	// Phase is the name of the failed phase.
+	Phase string
+	// Until is the deadline of the hold.  The infrastructure will be deleted after the deadline.
+	Until time.Time
+	// Hosts are addresses of the held hosts grouped by name of host group.
+	Hosts map[string][]string
 }
 type TaskResult interface {
 	fmt.Stringer
 	Error() error
+	// TeardownError returns an error that occurred while deleting resources.
+	// The teardown runs regardless of the result of the task, so it may be set even if Error() returns nil.
+	TeardownError() error
 	BeforeResult() ScriptResult
 	ScriptResult() ScriptResult
 	AfterResult() ScriptResult
 }
+
+// IsTerminalState returns true if the task in specified state never be changed.
+func IsTerminalState(state string) bool {
+	switch state {
+	case SucceededTaskState, FailedTaskState, ErroredTaskState, CanceledTaskState, InterruptedTaskState:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsActiveState returns true if the task in specified state is consumed by a worker.
+func IsActiveState(state string) bool {
+	return state == RunningTaskState || state == HoldingTaskState || IsPhaseState(state)
+}
+
+// IsPhaseState returns true if the state is a phase of the running task.
+func IsPhaseState(state string) bool {
+	switch state {
+	case ReservingTaskState, CreatingTaskState, BeforeTaskState, MainTaskState, AfterTaskState, DeletingTaskState:
+		return true
+	default:
+		return false
+	}
+}
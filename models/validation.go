@@ -0,0 +1,63 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError is a problem of a field in the config.
+type ValidationError struct {
+	// Field is the path to the field in the YAML document (e.g. "vms.web.nodes").
+	// It is empty if the problem is not related to a specific field.
+	Field   string
+	Message string
+}
+
+// ValidationErrors is a list of problems found by validation.
+type ValidationErrors []*ValidationError
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+func (errs ValidationErrors) Error() string {
+	var ss []string
+	for _, e := range errs {
+		ss = append(ss, e.Error())
+	}
+	return strings.Join(ss, "\n")
+}
+
+// Add appends a problem of the field.
+func (errs *ValidationErrors) Add(field, format string, args ...interface{}) {
+	*errs = append(*errs, &ValidationError{
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Extend appends problems of the nested field.  The field is prepended to the path of each problem.
+func (errs *ValidationErrors) Extend(field string, others ValidationErrors) {
+	for _, e := range others {
+		*errs = append(*errs, &ValidationError{
+			Field:   JoinFieldPath(field, e.Field),
+			Message: e.Message,
+		})
+	}
+}
+
+// JoinFieldPath joins the paths to a field.  The child can start with an index (e.g. "[0].name").
+func JoinFieldPath(parent, child string) string {
+	switch {
+	case parent == "":
+		return child
+	case child == "":
+		return parent
+	case strings.HasPrefix(child, "["):
+		return parent + child
+	default:
+		return parent + "." + child
+	}
+}
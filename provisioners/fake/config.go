@@ -0,0 +1,87 @@
+package fake
+
+import (
+	"github.com/yuuki0xff/clustertest/config"
+	"github.com/yuuki0xff/clustertest/models"
+	"sort"
+	"time"
+)
+
+func init() {
+	config.SpecInitializers[models.SpecType("fake")] = func() models.Spec { return &FakeSpec{} }
+}
+
+type FakeSpec struct {
+	// Identifier of the spec.
+	Name string
+	// (Optional) Time to take for each operation (e.g. "3s").
+	Delays *struct {
+		Reserve string
+		Create  string
+		Delete  string
+	}
+	// (Optional) If true, the operation fails.
+	Failures *struct {
+		Reserve bool
+		Create  bool
+		Delete  bool
+	}
+	VMs map[string]*FakeVM
+}
+type FakeVM struct {
+	// Number of VMs.
+	Nodes int
+	// Define tasks to execute on VMs.
+	// The "local-shell" and "remote-shell" scripts are executed on the daemon host with the following environment variables:
+	//   CLUSTERTEST_HOST:  Name of the VM (e.g. "web-0").
+	//   CLUSTERTEST_GROUP: Name of the VM group (e.g. "web").
+	//   CLUSTERTEST_INDEX: Index of the VM in the group (e.g. "0").
+	Scripts *config.ScriptConfigSet
+}
+
+func (s *FakeSpec) String() string {
+	return "<FakeSpec>"
+}
+func (s *FakeSpec) Type() models.SpecType {
+	return specType
+}
+func (s *FakeSpec) Validate() models.ValidationErrors {
+	var errs models.ValidationErrors
+	if d := s.Delays; d != nil {
+		delays := []struct{ field, delay string }{
+			{"delays.reserve", d.Reserve},
+			{"delays.create", d.Create},
+			{"delays.delete", d.Delete},
+		}
+		for _, d := range delays {
+			if d.delay == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(d.delay); err != nil {
+				errs.Add(d.field, "%s", err)
+			}
+		}
+	}
+
+	if len(s.VMs) == 0 {
+		errs.Add("vms", "must not be empty")
+	}
+	var names []string
+	for name := range s.VMs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		vm := s.VMs[name]
+		field := "vms." + name
+		if vm == nil {
+			errs.Add(field, "must not be empty")
+			continue
+		}
+		if vm.Nodes <= 0 {
+			errs.Add(field+".nodes", "must be larger than 0")
+		}
+		errs.Extend(field+".scripts", vm.Scripts.Validate())
+	}
+	return errs
+}
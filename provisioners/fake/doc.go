@@ -0,0 +1,5 @@
+// Fake Provisioner
+//
+// It simulates VMs without any infrastructure.  Scripts are executed on the daemon host.
+// It is useful for testing task pipelines and configs.
+package fake
@@ -0,0 +1,32 @@
+package fake
+
+import (
+	"github.com/yuuki0xff/clustertest/models"
+)
+
+type FakeInfraConfig struct {
+	FakeSpec *FakeSpec
+	VMs      map[string][]FakeVMConfig
+}
+type FakeVMConfig struct {
+	// Name of the VM.
+	Name  string
+	Group string
+	Index int
+}
+
+func (c *FakeInfraConfig) String() string {
+	return "<FakeInfraConfig>"
+}
+func (c *FakeInfraConfig) Spec() models.Spec {
+	return c.FakeSpec
+}
+func (c *FakeInfraConfig) Hosts() map[string][]string {
+	hosts := map[string][]string{}
+	for name, vms := range c.VMs {
+		for _, vm := range vms {
+			hosts[name] = append(hosts[name], vm.Name)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,199 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/republicprotocol/co-go"
+	"github.com/yuuki0xff/clustertest/executors"
+	"github.com/yuuki0xff/clustertest/executors/callback"
+	"github.com/yuuki0xff/clustertest/executors/localshell"
+	"github.com/yuuki0xff/clustertest/executors/upload"
+	"github.com/yuuki0xff/clustertest/models"
+	"github.com/yuuki0xff/clustertest/provisioners"
+	localscript "github.com/yuuki0xff/clustertest/scripts/localshell"
+	remotescript "github.com/yuuki0xff/clustertest/scripts/remoteshell"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const specType = models.SpecType("fake")
+const vmConfigsAttrName = "provisioners/fake/vm-configs"
+const vmGroupNameAttrName = "provisioners/fake/vm-group-name"
+
+func init() {
+	provisioners.Provisioners[specType] = func(prefix string, spec models.Spec) models.Provisioner {
+		return &FakeProvisioner{
+			prefix: prefix,
+			spec:   spec.(*FakeSpec),
+		}
+	}
+}
+
+type FakeProvisioner struct {
+	prefix string
+	spec   *FakeSpec
+	config *FakeInfraConfig
+}
+
+// Reserve allocates the fake VMs defined by FakeSpec.
+func (p *FakeProvisioner) Reserve(ctx context.Context) error {
+	err := p.simulate(ctx, "reserve")
+	if err != nil {
+		return err
+	}
+
+	conf := &FakeInfraConfig{
+		FakeSpec: p.spec,
+		VMs:      map[string][]FakeVMConfig{},
+	}
+	for name, vm := range p.spec.VMs {
+		for i := 0; i < vm.Nodes; i++ {
+			conf.VMs[name] = append(conf.VMs[name], FakeVMConfig{
+				Name:  fmt.Sprintf("%s-%d", name, i),
+				Group: name,
+				Index: i,
+			})
+		}
+	}
+	p.config = conf
+	return nil
+}
+
+// Create does nothing except for the simulated delay and failure.
+func (p *FakeProvisioner) Create(ctx context.Context) error {
+	return p.simulate(ctx, "create")
+}
+
+// Delete discards the fake VMs.
+// If resources are not reserved, Delete does nothing.
+func (p *FakeProvisioner) Delete() error {
+	if p.config == nil {
+		// Still not reserved.
+		return nil
+	}
+	err := p.simulate(context.Background(), "delete")
+	if err != nil {
+		return err
+	}
+	p.config = nil
+	return nil
+}
+func (p *FakeProvisioner) Spec() models.Spec {
+	return p.spec
+}
+func (p *FakeProvisioner) Config() models.InfraConfig {
+	if p.config == nil {
+		return nil
+	}
+	return p.config
+}
+func (p *FakeProvisioner) ScriptSets() []*models.ScriptSet {
+	var sets []*models.ScriptSet
+	for name, vm := range p.spec.VMs {
+		if vm.Scripts == nil {
+			continue
+		}
+		attrs := map[interface{}]interface{}{
+			vmConfigsAttrName:   p.config.VMs[name],
+			vmGroupNameAttrName: name,
+		}
+		s := &models.ScriptSet{
+			Before: vm.Scripts.Before.SetAttrs(attrs).Get(),
+			Main:   vm.Scripts.Main.SetAttrs(attrs).Get(),
+			After:  vm.Scripts.After.SetAttrs(attrs).Get(),
+		}
+		sets = append(sets, s)
+	}
+	return sets
+}
+func (p *FakeProvisioner) ScriptExecutor(scriptType models.ScriptType) models.ScriptExecutor {
+	// All scripts are executed on the daemon host.
+	var newExecutor func(vm FakeVMConfig, script models.Script) (models.ScriptExecutor, models.Script)
+	localExecutor := func(vm FakeVMConfig) *localshell.Executor {
+		return &localshell.Executor{
+			Host: vm.Name,
+			Env: []string{
+				"CLUSTERTEST_HOST=" + vm.Name,
+				"CLUSTERTEST_GROUP=" + vm.Group,
+				"CLUSTERTEST_INDEX=" + strconv.Itoa(vm.Index),
+			},
+		}
+	}
+	switch scriptType {
+	case models.ScriptType("local-shell"):
+		newExecutor = func(vm FakeVMConfig, script models.Script) (models.ScriptExecutor, models.Script) {
+			return localExecutor(vm), script
+		}
+	case models.ScriptType("remote-shell"):
+		newExecutor = func(vm FakeVMConfig, script models.Script) (models.ScriptExecutor, models.Script) {
+			return localExecutor(vm), &localscript.Script{
+				Commands: script.(*remotescript.Script).Commands,
+			}
+		}
+	case models.ScriptType("upload"):
+		// The files are copied on the daemon host.
+		newExecutor = func(vm FakeVMConfig, script models.Script) (models.ScriptExecutor, models.Script) {
+			return &upload.Executor{
+				Remote: localExecutor(vm),
+				Data: &upload.TemplateData{
+					Host:  vm.Name,
+					Group: vm.Group,
+					Hosts: p.config.Hosts(),
+				},
+			}, script
+		}
+	default:
+		err := errors.Errorf("unsupported ScriptType: %s", scriptType)
+		panic(err)
+	}
+
+	return &callback.Executor{
+		Fn: func(ctx context.Context, script models.Script) models.ScriptResult {
+			mr := &executors.MergedResult{
+				NameStr: script.GetAttr(vmGroupNameAttrName).(string),
+			}
+			lock := sync.Mutex{}
+			vmConfigs := script.GetAttr(vmConfigsAttrName).([]FakeVMConfig)
+
+			co.ParForAll(vmConfigs, func(i int) {
+				e, s := newExecutor(vmConfigs[i], script)
+				result := e.Execute(ctx, s)
+
+				lock.Lock()
+				mr.Append(result)
+				lock.Unlock()
+			})
+			return mr
+		},
+	}
+}
+
+// simulate sleeps for the configured delay (or until the ctx is canceled) and returns the injected failure of the operation.
+func (p *FakeProvisioner) simulate(ctx context.Context, op string) error {
+	var delay string
+	var fail bool
+	if d := p.spec.Delays; d != nil {
+		delay = map[string]string{"reserve": d.Reserve, "create": d.Create, "delete": d.Delete}[op]
+	}
+	if f := p.spec.Failures; f != nil {
+		fail = map[string]bool{"reserve": f.Reserve, "create": f.Create, "delete": f.Delete}[op]
+	}
+
+	if delay != "" {
+		d, err := time.ParseDuration(delay)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s delay", op)
+		}
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if fail {
+		return errors.Errorf("injected failure: %s", op)
+	}
+	return nil
+}
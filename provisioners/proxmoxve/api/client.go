@@ -19,6 +19,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -32,6 +33,7 @@ const RunningVMStatus = VMStatus("running")
 const MaxConn = 4
 const MaxRetry = 30
 const RetryInterval = 3 * time.Second
+const ticketPath = "/api2/json/access/ticket"
 
 var reqLogger = log.New(ioutil.Discard, "", 0)
 
@@ -46,15 +48,23 @@ func init() {
 }
 
 type PveClientOption struct {
-	Address     string
-	User        string
-	Password    string
+	Address  string
+	User     string
+	Password string
+	// TokenID is the ID of the API token (e.g. "user@pve!clustertest").
+	// If it is specified, the API token is used instead of the User and Password.
+	TokenID     string
+	TokenSecret string
 	Fingerprint string
 }
 
 // See https://pve.proxmox.com/pve-docs/api-viewer/
 type PveClient struct {
 	PveClientOption
+	// m protects the token.
+	m sync.Mutex
+	// renew serializes the renewal of the ticket.
+	renew       sync.Mutex
 	token       *apiToken
 	_httpClient *http.Client
 }
@@ -113,6 +123,9 @@ type Config struct {
 	// Cloud-init: static IP address configuration
 	// format: gw=<ipv4>,ip=<ipv4>/<CIDR>
 	IPAddress string `url:"ipconfig0" json:"ipconfig0"`
+	// Cloud-init: custom files to replace the generated ones
+	// format: user=<storage>:snippets/<file>
+	CICustom string `url:"cicustom,omitempty" json:"cicustom"`
 }
 
 func NewPveClient(option PveClientOption) *PveClient {
@@ -122,7 +135,12 @@ func NewPveClient(option PveClientOption) *PveClient {
 }
 
 // Ticket creates an authentication ticket.
+// If the API token is specified, it does nothing because the ticket is not needed.
+// The ticket is renewed automatically when it is expired.
 func (c *PveClient) Ticket() error {
+	if c.TokenID != "" {
+		return nil
+	}
 	return cmdutils.HandlePanic(func() error {
 		query := struct {
 			Username string `url:"username"`
@@ -131,15 +149,34 @@ func (c *PveClient) Ticket() error {
 		token := &apiToken{}
 		data := struct{ Data *apiToken }{token}
 
-		err := c.reqJSON("POST", "/api2/json/access/ticket", query, nil, &data)
+		err := c.reqJSON("POST", ticketPath, query, nil, &data)
 		if err != nil {
 			return err
 		}
+		c.m.Lock()
 		c.token = token
+		c.m.Unlock()
 		return nil
 	})
 }
 
+// renewTicket creates a new ticket if the old ticket is still used.
+// It does nothing if another request already renewed the ticket.
+func (c *PveClient) renewTicket(old *apiToken) error {
+	c.renew.Lock()
+	defer c.renew.Unlock()
+	if c.currentToken() != old {
+		return nil
+	}
+	reqLogger.Println("renewing ticket ...")
+	return c.Ticket()
+}
+func (c *PveClient) currentToken() *apiToken {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.token
+}
+
 // IDFromName finds an VM with the given name and returns an ID.
 func (c *PveClient) IDFromName(name string) (NodeVMID, error) {
 	vms, err := c.ListAllVMs()
@@ -470,12 +507,14 @@ func (c *PveClient) StopVM(id NodeVMID) *Task {
 // NOTE: This method does not close the connection. Usually you should use other helper methods like reqJSON() and reqString().
 func (c *PveClient) req(method, path string, query interface{}, post interface{}) (r *grequests.Response, err error) {
 	t := time.NewTicker(RetryInterval)
+	renewed := false
 	for i := 0; i < MaxRetry; i++ {
+		token := c.currentToken()
 		func() {
 			sem.Acquire(context.Background(), 1)
 			defer sem.Release(1)
 
-			url, option := c.ro(path, query, post)
+			url, option := c.ro(path, query, post, token)
 			reqLogger.Println(method, url, query, post)
 			r, err = grequests.DoRegularRequest(method, url, option)
 			if err != nil {
@@ -498,6 +537,14 @@ func (c *PveClient) req(method, path string, query interface{}, post interface{}
 				r.Close()
 				r = nil
 			}
+			if e, ok := err.(*StatusError); ok && e.StatusCode == 401 && token != nil && path != ticketPath && !renewed {
+				// The ticket is expired.  Renew it and retry immediately.
+				renewed = true
+				if err = c.renewTicket(token); err != nil {
+					return
+				}
+				continue
+			}
 			if e, ok := err.(*StatusError); ok && (e.StatusCode == 403 || 500 <= e.StatusCode && e.StatusCode < 600) {
 				// Wait for few seconds.
 				reqLogger.Println("retrying ...")
@@ -540,14 +587,14 @@ func (c *PveClient) reqTask(method, path string, query, post interface{}) (TaskI
 
 // ro built the RequestOptions.
 // If you don't need the query string, set query to nil.
-func (c *PveClient) ro(path string, query interface{}, post interface{}) (string, *grequests.RequestOptions) {
+func (c *PveClient) ro(path string, query interface{}, post interface{}, token *apiToken) (string, *grequests.RequestOptions) {
 	url := c.buildUrl(path)
 	ro := &grequests.RequestOptions{
 		QueryStruct: query,
 		Data:        interface2mapString(post),
 		UserAgent:   "clustertest-proxmox-ve-provisioner",
-		Cookies:     c.cookies(),
-		Headers:     c.headers(),
+		Cookies:     c.cookies(token),
+		Headers:     c.headers(token),
 		HTTPClient:  c.httpClient(),
 	}
 	return url, ro
@@ -557,20 +604,25 @@ func (c *PveClient) buildUrl(path string) string {
 	urlR := strings.TrimLeft(path, "/")
 	return urlL + "/" + urlR
 }
-func (c *PveClient) cookies() []*http.Cookie {
-	if c.token == nil {
+func (c *PveClient) cookies(token *apiToken) []*http.Cookie {
+	if token == nil {
 		return nil
 	}
 	return []*http.Cookie{
-		{Name: "PVEAuthCookie", Value: c.token.Ticket},
+		{Name: "PVEAuthCookie", Value: token.Ticket},
 	}
 }
-func (c *PveClient) headers() map[string]string {
-	if c.token == nil {
+func (c *PveClient) headers(token *apiToken) map[string]string {
+	if c.TokenID != "" {
+		return map[string]string{
+			"Authorization": fmt.Sprintf("PVEAPIToken=%s=%s", c.TokenID, c.TokenSecret),
+		}
+	}
+	if token == nil {
 		return nil
 	}
 	return map[string]string{
-		"CSRFPreventionToken": c.token.CSRFPreventionToken,
+		"CSRFPreventionToken": token.CSRFPreventionToken,
 	}
 }
 func (c *PveClient) httpClient() *http.Client {
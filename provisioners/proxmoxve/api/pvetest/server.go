@@ -0,0 +1,654 @@
+package pvetest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	. "github.com/yuuki0xff/clustertest/provisioners/proxmoxve/api"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultUser = "root@pam"
+const DefaultPassword = "password"
+const apiPrefix = "/api2/json/"
+const firstVMID = 100
+
+// Server is an in-process Proxmox VE API server for testing.
+// It implements the subset of the API that PveClient uses.
+//
+// The clone, start, stop and delete operations are executed as asynchronous tasks.
+// Their results are applied to the VMs when the tasks are finished.
+// Unlike the real server, it responds 404 for unknown VMs to avoid retries by the client.
+type Server struct {
+	*httptest.Server
+	User     string
+	Password string
+	// Tokens is the secrets of API tokens by token ID (e.g. "root@pam!test").
+	Tokens map[string]string
+	// TicketLifetime is the time until tickets expire.  If it is zero, tickets never expire.
+	TicketLifetime time.Duration
+	// TaskDuration is the time to complete each task.
+	TaskDuration time.Duration
+	// FailTask injects a failure to the task.  It is called when the task is finished.
+	// The typ is the type of the task (qmclone, qmstart, qmstop or qmdestroy).
+	// If it returns an error, the task fails with the error message.
+	FailTask func(typ string, id VMID) error
+
+	m       sync.Mutex
+	nodes   []*Node
+	vms     map[VMID]*VM
+	tasks   map[TaskID]*task
+	tickets map[string]*ticket
+	nextPID int
+}
+type ticket struct {
+	CSRF string
+	// Expire is the expiration time.  If it is zero, the ticket never expires.
+	Expire time.Time
+}
+type Node struct {
+	ID NodeID
+	// Number of CPUs.
+	MaxCPU int
+	// Memory size in bytes.
+	MaxMem int
+	Status NodeStatus
+}
+type VM struct {
+	ID          NodeVMID
+	Name        string
+	Description string
+	Pool        string
+	Template    bool
+	Status      VMStatus
+	// Lock is the name of running operation.  The locked VM cannot be modified.
+	Lock   string
+	Config Config
+	// Options is the config options not included in the Config (e.g. "ide2").
+	Options map[string]string
+	// DiskSizes is the size of disks in gigabytes.
+	DiskSizes map[string]int
+}
+type task struct {
+	ID       TaskID
+	Type     string
+	VMID     VMID
+	Finish   time.Time
+	Finished bool
+	// Exit is "OK" or an error message.
+	Exit string
+	Log  []string
+	// apply is called when the task finished successfully.
+	apply func()
+	// rollback is called when the task failed.
+	rollback func()
+}
+
+// httpError is an error with the HTTP status code.
+type httpError struct {
+	code int
+	msg  string
+}
+
+// NewServer starts a server that has no node and VM.
+func NewServer() *Server {
+	s := &Server{
+		User:     DefaultUser,
+		Password: DefaultPassword,
+		vms:      map[VMID]*VM{},
+		tasks:    map[TaskID]*task{},
+		Tokens:   map[string]string{},
+		tickets:  map[string]*ticket{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// AddNode adds a node to the cluster.
+func (s *Server) AddNode(n Node) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if n.Status == "" {
+		n.Status = OnlineNodeStatus
+	}
+	s.nodes = append(s.nodes, &n)
+}
+
+// AddVM adds a VM (usually a template) to the node.
+func (s *Server) AddVM(vm VM) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if vm.Status == "" {
+		vm.Status = StoppedVMStatus
+	}
+	s.vms[vm.ID.VMID] = copyVM(&vm)
+}
+
+// VM returns a copy of the VM.
+func (s *Server) VM(id VMID) (VM, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.updateTasks()
+	vm, ok := s.vms[id]
+	if !ok {
+		return VM{}, false
+	}
+	return *copyVM(vm), true
+}
+
+// VMs returns a copy of all VMs sorted by VMID.
+func (s *Server) VMs() []VM {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.updateTasks()
+	var vms []VM
+	for _, vm := range s.vms {
+		vms = append(vms, *copyVM(vm))
+	}
+	sort.Slice(vms, func(i, j int) bool {
+		return vmidLess(vms[i].ID.VMID, vms[j].ID.VMID)
+	})
+	return vms
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, apiPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/"), "/")
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.updateTasks()
+
+	if r.Method == "POST" && match(path, "access", "ticket") {
+		s.ticket(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		http.Error(w, "authentication failure", http.StatusUnauthorized)
+		return
+	}
+
+	var data interface{}
+	var err error
+	switch {
+	case r.Method == "GET" && match(path, "cluster", "nextid"):
+		data = s.nextID()
+	case r.Method == "GET" && match(path, "nodes"):
+		data = s.listNodes()
+	case r.Method == "GET" && match(path, "nodes", "*", "qemu"):
+		data, err = s.listVMs(NodeID(path[1]))
+	case r.Method == "POST" && match(path, "nodes", "*", "qemu", "*", "clone"):
+		data, err = s.cloneVM(s.nodeVMID(path), r)
+	case r.Method == "GET" && match(path, "nodes", "*", "qemu", "*", "config"):
+		data, err = s.getConfig(s.nodeVMID(path))
+	case r.Method == "PUT" && match(path, "nodes", "*", "qemu", "*", "config"):
+		err = s.updateConfig(s.nodeVMID(path), r)
+	case r.Method == "PUT" && match(path, "nodes", "*", "qemu", "*", "resize"):
+		err = s.resize(s.nodeVMID(path), r)
+	case r.Method == "GET" && match(path, "nodes", "*", "qemu", "*", "status", "current"):
+		data, err = s.currentStatus(s.nodeVMID(path))
+	case r.Method == "POST" && match(path, "nodes", "*", "qemu", "*", "status", "start"):
+		data, err = s.setStatus(s.nodeVMID(path), "qmstart", RunningVMStatus)
+	case r.Method == "POST" && match(path, "nodes", "*", "qemu", "*", "status", "stop"):
+		data, err = s.setStatus(s.nodeVMID(path), "qmstop", StoppedVMStatus)
+	case r.Method == "DELETE" && match(path, "nodes", "*", "qemu", "*"):
+		data, err = s.deleteVM(s.nodeVMID(path))
+	case r.Method == "GET" && match(path, "nodes", "*", "tasks", "*", "status"):
+		data, err = s.taskStatus(TaskID(path[3]))
+	case r.Method == "GET" && match(path, "nodes", "*", "tasks", "*", "log"):
+		data, err = s.taskLog(TaskID(path[3]), r)
+	default:
+		http.Error(w, fmt.Sprintf("Method '%s /%s' not implemented", r.Method, strings.Join(path, "/")), http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		if e, ok := err.(*httpError); ok {
+			http.Error(w, e.msg, e.code)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeData(w, data)
+}
+func (s *Server) ticket(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("username") != s.User || r.FormValue("password") != s.Password {
+		http.Error(w, "authentication failure", http.StatusUnauthorized)
+		return
+	}
+	id := "PVE:" + s.User + ":" + randomHex()
+	t := &ticket{
+		CSRF: randomHex(),
+	}
+	if s.TicketLifetime > 0 {
+		t.Expire = time.Now().Add(s.TicketLifetime)
+	}
+	s.tickets[id] = t
+	writeData(w, map[string]string{
+		"ticket":              id,
+		"CSRFPreventionToken": t.CSRF,
+		"username":            s.User,
+	})
+}
+
+// ExpireTickets invalidates all issued tickets.
+func (s *Server) ExpireTickets() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.tickets = map[string]*ticket{}
+}
+func (s *Server) authorized(r *http.Request) bool {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		// Format: PVEAPIToken=<user>@<realm>!<token-name>=<secret>
+		kv := strings.SplitN(strings.TrimPrefix(auth, "PVEAPIToken="), "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(auth, "PVEAPIToken=") {
+			return false
+		}
+		secret, ok := s.Tokens[kv[0]]
+		return ok && secret == kv[1]
+	}
+
+	c, err := r.Cookie("PVEAuthCookie")
+	if err != nil {
+		return false
+	}
+	t, ok := s.tickets[c.Value]
+	if !ok {
+		return false
+	}
+	if !t.Expire.IsZero() && time.Now().After(t.Expire) {
+		delete(s.tickets, c.Value)
+		return false
+	}
+	if r.Method != "GET" && r.Header.Get("CSRFPreventionToken") != t.CSRF {
+		return false
+	}
+	return true
+}
+func (s *Server) nextID() VMID {
+	for id := firstVMID; ; id++ {
+		vmid := VMID(strconv.Itoa(id))
+		if _, ok := s.vms[vmid]; !ok {
+			return vmid
+		}
+	}
+}
+func (s *Server) listNodes() interface{} {
+	var nodes []map[string]interface{}
+	for _, n := range s.nodes {
+		nodes = append(nodes, map[string]interface{}{
+			"node":   n.ID,
+			"maxcpu": n.MaxCPU,
+			"maxmem": n.MaxMem,
+			"mem":    s.usedMem(n.ID),
+			"status": n.Status,
+		})
+	}
+	return nodes
+}
+func (s *Server) listVMs(node NodeID) (interface{}, error) {
+	if s.node(node) == nil {
+		return nil, notFound("node '%s' does not exist", node)
+	}
+	vms := []map[string]interface{}{}
+	for _, vm := range s.vms {
+		if vm.ID.NodeID != node {
+			continue
+		}
+		vms = append(vms, map[string]interface{}{
+			"vmid":     vm.ID.VMID,
+			"name":     vm.Name,
+			"cpus":     vm.cpus(),
+			"maxmem":   vm.Config.Memory * 1024 * 1024,
+			"status":   vm.Status,
+			"template": vm.Template,
+		})
+	}
+	return vms, nil
+}
+func (s *Server) cloneVM(id NodeVMID, r *http.Request) (interface{}, error) {
+	from, err := s.vm(id)
+	if err != nil {
+		return nil, err
+	}
+	newID := VMID(r.FormValue("newid"))
+	if newID == "" {
+		return nil, badRequest("newid: property is missing and it is not optional")
+	}
+	if _, ok := s.vms[newID]; ok {
+		return nil, errors.Errorf("unable to create VM %s: config file already exists", newID)
+	}
+	if target := r.FormValue("target"); target != "" && NodeID(target) != id.NodeID {
+		return nil, errors.Errorf("unable to clone to the other node without shared storage: %s", target)
+	}
+
+	// The VM is created immediately, but it is locked until the task is finished.
+	vm := copyVM(from)
+	vm.ID = NodeVMID{NodeID: id.NodeID, VMID: newID}
+	vm.Name = r.FormValue("name")
+	vm.Description = r.FormValue("description")
+	vm.Pool = r.FormValue("pool")
+	vm.Template = false
+	vm.Status = StoppedVMStatus
+	vm.Lock = "clone"
+	s.vms[newID] = vm
+
+	t := s.newTask(id.NodeID, "qmclone", id.VMID)
+	t.apply = func() {
+		vm.Lock = ""
+	}
+	t.rollback = func() {
+		delete(s.vms, newID)
+	}
+	return t.ID, nil
+}
+func (s *Server) getConfig(id NodeVMID) (interface{}, error) {
+	vm, err := s.vm(id)
+	if err != nil {
+		return nil, err
+	}
+	return vm.Config, nil
+}
+func (s *Server) updateConfig(id NodeVMID, r *http.Request) error {
+	vm, err := s.unlockedVM(id)
+	if err != nil {
+		return err
+	}
+	for key := range r.Form {
+		value := r.Form.Get(key)
+		var err error
+		switch key {
+		case "cores":
+			vm.Config.CPUCores, err = strconv.Atoi(value)
+		case "sockets":
+			vm.Config.CPUSockets, err = strconv.Atoi(value)
+		case "vcpus":
+			vm.Config.VCPUs, err = strconv.Atoi(value)
+		case "memory":
+			vm.Config.Memory, err = strconv.Atoi(value)
+		case "ciuser":
+			vm.Config.User = value
+		case "sshkeys":
+			vm.Config.SSHKeys = value
+		case "ipconfig0":
+			vm.Config.IPAddress = value
+		case "cicustom":
+			vm.Config.CICustom = value
+		default:
+			vm.Options[key] = value
+		}
+		if err != nil {
+			return badRequest("%s: invalid value: %s", key, value)
+		}
+	}
+	return nil
+}
+func (s *Server) resize(id NodeVMID, r *http.Request) error {
+	vm, err := s.unlockedVM(id)
+	if err != nil {
+		return err
+	}
+	disk := r.FormValue("disk")
+	size := r.FormValue("size")
+	if disk == "" {
+		return badRequest("disk: property is missing and it is not optional")
+	}
+	if !strings.HasPrefix(size, "+") || !strings.HasSuffix(size, "G") {
+		return badRequest("size: unsupported format: %s", size)
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(size, "+"), "G"))
+	if err != nil {
+		return badRequest("size: unsupported format: %s", size)
+	}
+	vm.DiskSizes[disk] += n
+	return nil
+}
+func (s *Server) currentStatus(id NodeVMID) (interface{}, error) {
+	vm, err := s.vm(id)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"vmid":   vm.ID.VMID,
+		"name":   vm.Name,
+		"cpus":   vm.cpus(),
+		"maxmem": vm.Config.Memory * 1024 * 1024,
+		"status": vm.Status,
+	}, nil
+}
+func (s *Server) setStatus(id NodeVMID, typ string, status VMStatus) (interface{}, error) {
+	vm, err := s.unlockedVM(id)
+	if err != nil {
+		return nil, err
+	}
+	if vm.Template {
+		return nil, errors.Errorf("VM %s is a template", id.VMID)
+	}
+	t := s.newTask(id.NodeID, typ, id.VMID)
+	t.apply = func() {
+		vm.Status = status
+	}
+	return t.ID, nil
+}
+func (s *Server) deleteVM(id NodeVMID) (interface{}, error) {
+	vm, err := s.unlockedVM(id)
+	if err != nil {
+		return nil, err
+	}
+	t := s.newTask(id.NodeID, "qmdestroy", id.VMID)
+	t.apply = func() {
+		if vm.Status == RunningVMStatus {
+			t.fail(errors.Errorf("VM %s is running - destroy failed", id.VMID))
+			return
+		}
+		delete(s.vms, id.VMID)
+	}
+	return t.ID, nil
+}
+func (s *Server) taskStatus(id TaskID) (interface{}, error) {
+	t, ok := s.tasks[id]
+	if !ok {
+		return nil, notFound("no such task: %s", id)
+	}
+	if !t.Finished {
+		return map[string]string{"status": "running"}, nil
+	}
+	return map[string]string{
+		"status":     "stopped",
+		"exitstatus": t.Exit,
+	}, nil
+}
+func (s *Server) taskLog(id TaskID, r *http.Request) (interface{}, error) {
+	t, ok := s.tasks[id]
+	if !ok {
+		return nil, notFound("no such task: %s", id)
+	}
+	start, _ := strconv.Atoi(r.FormValue("start"))
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil {
+		limit = 50
+	}
+
+	lines := []map[string]interface{}{}
+	for i := start; i < len(t.Log) && i < start+limit; i++ {
+		lines = append(lines, map[string]interface{}{
+			"n": i + 1,
+			"t": t.Log[i],
+		})
+	}
+	return lines, nil
+}
+
+// newTask starts a task.  The task is finished after the TaskDuration.
+func (s *Server) newTask(node NodeID, typ string, id VMID) *task {
+	s.nextPID++
+	t := &task{
+		ID:     TaskID(fmt.Sprintf("UPID:%s:%08X:%08X:%s:%s:%s:", node, s.nextPID, time.Now().Unix(), typ, id, s.User)),
+		Type:   typ,
+		VMID:   id,
+		Finish: time.Now().Add(s.TaskDuration),
+	}
+	s.tasks[t.ID] = t
+	return t
+}
+
+// updateTasks applies the results of finished tasks.
+func (s *Server) updateTasks() {
+	now := time.Now()
+	for _, t := range s.tasks {
+		if t.Finished || now.Before(t.Finish) {
+			continue
+		}
+		t.Finished = true
+		t.Exit = "OK"
+		if s.FailTask != nil {
+			if err := s.FailTask(t.Type, t.VMID); err != nil {
+				t.fail(err)
+			}
+		}
+		if t.Exit == "OK" && t.apply != nil {
+			t.apply()
+		}
+		if t.Exit != "OK" && t.rollback != nil {
+			t.rollback()
+		}
+		if t.Exit == "OK" {
+			t.Log = append(t.Log, "TASK OK")
+		} else {
+			t.Log = append(t.Log, "TASK ERROR: "+t.Exit)
+		}
+	}
+}
+func (s *Server) node(id NodeID) *Node {
+	for _, n := range s.nodes {
+		if n.ID == id {
+			return n
+		}
+	}
+	return nil
+}
+func (s *Server) vm(id NodeVMID) (*VM, error) {
+	vm, ok := s.vms[id.VMID]
+	if !ok || vm.ID.NodeID != id.NodeID {
+		return nil, notFound("Configuration file 'nodes/%s/qemu-server/%s.conf' does not exist", id.NodeID, id.VMID)
+	}
+	return vm, nil
+}
+
+// unlockedVM returns the VM if it can be modified.
+func (s *Server) unlockedVM(id NodeVMID) (*VM, error) {
+	vm, err := s.vm(id)
+	if err != nil {
+		return nil, err
+	}
+	if vm.Lock != "" {
+		return nil, errors.Errorf("VM is locked (%s)", vm.Lock)
+	}
+	return vm, nil
+}
+func (s *Server) nodeVMID(path []string) NodeVMID {
+	return NodeVMID{
+		NodeID: NodeID(path[1]),
+		VMID:   VMID(path[3]),
+	}
+}
+
+// usedMem returns the total memory size of running VMs in bytes.
+func (s *Server) usedMem(node NodeID) int {
+	var mem int
+	for _, vm := range s.vms {
+		if vm.ID.NodeID == node && vm.Status == RunningVMStatus {
+			mem += vm.Config.Memory * 1024 * 1024
+		}
+	}
+	return mem
+}
+
+func (t *task) fail(err error) {
+	t.Exit = err.Error()
+	t.Log = append(t.Log, err.Error())
+}
+
+func (vm *VM) cpus() int {
+	if vm.Config.VCPUs > 0 {
+		return vm.Config.VCPUs
+	}
+	if vm.Config.CPUCores > 0 {
+		return vm.Config.CPUCores
+	}
+	return 1
+}
+func copyVM(vm *VM) *VM {
+	newVM := &VM{}
+	*newVM = *vm
+	newVM.Options = map[string]string{}
+	for k, v := range vm.Options {
+		newVM.Options[k] = v
+	}
+	newVM.DiskSizes = map[string]int{}
+	for k, v := range vm.DiskSizes {
+		newVM.DiskSizes[k] = v
+	}
+	return newVM
+}
+
+// match returns true if the path matches the pattern.  The "*" matches any element.
+func match(path []string, pattern ...string) bool {
+	if len(path) != len(pattern) {
+		return false
+	}
+	for i := range pattern {
+		if pattern[i] != "*" && pattern[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+func writeData(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	json.NewEncoder(w).Encode(struct {
+		Data interface{} `json:"data"`
+	}{data})
+}
+func (e *httpError) Error() string {
+	return e.msg
+}
+func notFound(format string, args ...interface{}) error {
+	return &httpError{
+		code: http.StatusNotFound,
+		msg:  fmt.Sprintf(format, args...),
+	}
+}
+func badRequest(format string, args ...interface{}) error {
+	return &httpError{
+		code: http.StatusBadRequest,
+		msg:  fmt.Sprintf(format, args...),
+	}
+}
+func randomHex() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+func vmidLess(a, b VMID) bool {
+	x, _ := strconv.Atoi(string(a))
+	y, _ := strconv.Atoi(string(b))
+	return x < y
+}
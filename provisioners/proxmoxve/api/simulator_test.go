@@ -0,0 +1,186 @@
+package api_test
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	. "github.com/yuuki0xff/clustertest/provisioners/proxmoxve/api"
+	"github.com/yuuki0xff/clustertest/provisioners/proxmoxve/api/pvetest"
+	"testing"
+	"time"
+)
+
+func newTestServer() *pvetest.Server {
+	s := pvetest.NewServer()
+	s.AddNode(pvetest.Node{ID: "node1", MaxCPU: 4, MaxMem: 8 << 30})
+	s.AddVM(pvetest.VM{
+		ID:       NodeVMID{NodeID: "node1", VMID: "100"},
+		Name:     "template-node1",
+		Template: true,
+	})
+	return s
+}
+func newTestClient(t *testing.T, s *pvetest.Server) *PveClient {
+	c := NewPveClient(PveClientOption{
+		Address:  s.URL,
+		User:     pvetest.DefaultUser,
+		Password: pvetest.DefaultPassword,
+	})
+	if err := c.Ticket(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+func waitTask(t *testing.T, task *Task) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return task.Wait(ctx)
+}
+
+func TestPveClient_Ticket(t *testing.T) {
+	t.Run("should_fail_with_wrong_password", func(t *testing.T) {
+		s := newTestServer()
+		defer s.Close()
+		c := NewPveClient(PveClientOption{
+			Address:  s.URL,
+			User:     pvetest.DefaultUser,
+			Password: "wrong",
+		})
+		assert.Error(t, c.Ticket())
+	})
+	t.Run("should_reject_requests_without_ticket", func(t *testing.T) {
+		s := newTestServer()
+		defer s.Close()
+		c := NewPveClient(PveClientOption{Address: s.URL})
+		_, err := c.ListNodes()
+		if assert.Error(t, err) {
+			assert.Equal(t, 401, errors.Cause(err).(*StatusError).StatusCode)
+		}
+	})
+	t.Run("should_renew_expired_ticket", func(t *testing.T) {
+		s := newTestServer()
+		defer s.Close()
+		s.TicketLifetime = 100 * time.Millisecond
+		c := newTestClient(t, s)
+
+		time.Sleep(200 * time.Millisecond)
+		nodes, err := c.ListNodes()
+		assert.NoError(t, err)
+		assert.Len(t, nodes, 1)
+
+		s.ExpireTickets()
+		_, err = c.RandomVMID()
+		assert.NoError(t, err)
+	})
+	t.Run("should_fail_when_renewal_failed", func(t *testing.T) {
+		s := newTestServer()
+		defer s.Close()
+		c := newTestClient(t, s)
+
+		s.ExpireTickets()
+		s.Password = "changed"
+		_, err := c.ListNodes()
+		if assert.Error(t, err) {
+			assert.Equal(t, 401, errors.Cause(err).(*StatusError).StatusCode)
+		}
+	})
+}
+func TestPveClient_APIToken(t *testing.T) {
+	t.Run("should_authenticate_with_api_token", func(t *testing.T) {
+		s := newTestServer()
+		defer s.Close()
+		s.Tokens["root@pam!test"] = "secret"
+		c := NewPveClient(PveClientOption{
+			Address:     s.URL,
+			TokenID:     "root@pam!test",
+			TokenSecret: "secret",
+		})
+		assert.NoError(t, c.Ticket())
+
+		nodes, err := c.ListNodes()
+		assert.NoError(t, err)
+		assert.Len(t, nodes, 1)
+		vmid, err := c.RandomVMID()
+		if assert.NoError(t, err) {
+			to := NodeVMID{NodeID: "node1", VMID: vmid}
+			assert.NoError(t, waitTask(t, c.CloneVM(NodeVMID{NodeID: "node1", VMID: "100"}, to, "vm", "", "")))
+		}
+	})
+	t.Run("should_fail_with_wrong_secret", func(t *testing.T) {
+		s := newTestServer()
+		defer s.Close()
+		s.Tokens["root@pam!test"] = "secret"
+		c := NewPveClient(PveClientOption{
+			Address:     s.URL,
+			TokenID:     "root@pam!test",
+			TokenSecret: "wrong",
+		})
+		_, err := c.ListNodes()
+		if assert.Error(t, err) {
+			assert.Equal(t, 401, errors.Cause(err).(*StatusError).StatusCode)
+		}
+	})
+}
+func TestPveClient_VMLifecycle(t *testing.T) {
+	s := newTestServer()
+	defer s.Close()
+	c := newTestClient(t, s)
+
+	from, err := c.IDFromName("template-node1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	vmid, err := c.RandomVMID()
+	if !assert.NoError(t, err) {
+		return
+	}
+	to := NodeVMID{NodeID: "node1", VMID: vmid}
+	assert.NoError(t, waitTask(t, c.CloneVM(from, to, "vm", "description", "pool")))
+	assert.NoError(t, c.ResizeVolume(to, "scsi0", 10))
+	assert.NoError(t, c.UpdateConfig(to, &Config{
+		CPUCores: 2,
+		Memory:   1024,
+		User:     "user",
+		SSHKeys:  "ssh-ed25519 AAAA user@host",
+	}))
+	conf, err := c.Config(to)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, conf.CPUCores)
+		assert.Equal(t, "ssh-ed25519 AAAA user@host", conf.SSHKeys)
+	}
+
+	assert.NoError(t, waitTask(t, c.StartVM(to)))
+	info, err := c.VMInfo(to)
+	if assert.NoError(t, err) {
+		assert.Equal(t, RunningVMStatus, info.Status)
+	}
+	// A running VM cannot be deleted.
+	assert.Error(t, waitTask(t, c.DeleteVM(to)))
+
+	assert.NoError(t, waitTask(t, c.StopVM(to)))
+	assert.NoError(t, waitTask(t, c.DeleteVM(to)))
+	_, ok := s.VM(vmid)
+	assert.False(t, ok)
+}
+func TestTask_Wait(t *testing.T) {
+	t.Run("should_return_task_log_when_failed", func(t *testing.T) {
+		s := newTestServer()
+		defer s.Close()
+		s.FailTask = func(typ string, id VMID) error {
+			if typ == "qmclone" {
+				return errors.New("storage is full")
+			}
+			return nil
+		}
+		c := newTestClient(t, s)
+
+		to := NodeVMID{NodeID: "node1", VMID: "101"}
+		err := waitTask(t, c.CloneVM(NodeVMID{NodeID: "node1", VMID: "100"}, to, "vm", "", ""))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "storage is full")
+		}
+		// The failed clone is removed.
+		_, ok := s.VM("101")
+		assert.False(t, ok)
+	})
+}
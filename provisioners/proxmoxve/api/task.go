@@ -19,7 +19,10 @@ type Task struct {
 	// doneFn represents that fn() is executed.
 	doneFn chan struct{}
 	// done represents that the Task is finished.
-	done  chan struct{}
+	done chan struct{}
+	// fnError is the result of fn().  It is written before the doneFn is closed.
+	fnError error
+	// error is the result of the Task.  It is written before the done is closed.
 	error error
 
 	TaskID TaskID
@@ -45,11 +48,12 @@ func NewTask(fn func(task *Task) error) *Task {
 		defer taskSem.Release(1)
 		defer close(t.done)
 
-		t.error = func() error {
+		func() {
 			defer close(t.doneFn)
-			return fn(t)
+			t.fnError = fn(t)
 		}()
-		if t.error != nil {
+		if t.fnError != nil {
+			t.error = t.fnError
 			return
 		}
 
@@ -60,7 +64,7 @@ func NewTask(fn func(task *Task) error) *Task {
 func (t *Task) WaitFn(ctx context.Context) error {
 	select {
 	case <-t.doneFn:
-		return t.error
+		return t.fnError
 	case <-ctx.Done():
 		return errors.Errorf("task timeout")
 	}
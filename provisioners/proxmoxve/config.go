@@ -1,8 +1,12 @@
 package proxmoxve
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/yuuki0xff/clustertest/config"
 	"github.com/yuuki0xff/clustertest/models"
+	"net"
+	"sort"
 )
 
 func init() {
@@ -17,9 +21,15 @@ type PveSpec struct {
 		// URL of the Proxmox VE API server.
 		// Example: https://pve.local:8006
 		Address string
+		// Account to login.  Specify either User and Password or TokenID and TokenSecret.
 		Account struct {
-			User     string
+			User string
+			// Password can refer a secret (e.g. "${env:PVE_PASSWORD}").
 			Password string
+			// (Optional) ID of the API token (e.g. "clustertest@pve!ci").
+			TokenID string `yaml:"token_id"`
+			// (Optional) Secret of the API token.  It can refer a secret.
+			TokenSecret string `yaml:"token_secret"`
 		}
 		// Fingerprint of the Proxmox VE API server.
 		// If you need the server certificate pinning to make it more secure.
@@ -35,9 +45,30 @@ type PveSpec struct {
 	// User information.
 	// This user will create by cloud-init at VM start-up.
 	User *struct {
-		User         string
+		User string
+		// (Optional) Password can refer a secret (e.g. "${secret:vm-password}").
 		Password     string
 		SSHPublicKey string `yaml:"ssh_public_key"`
+		// (Optional) Path to the private key to connect VMs.
+		// If it is empty, the ssh-agent and the default private keys (~/.ssh/id_*) are used.
+		SSHPrivateKey string `yaml:"ssh_private_key"`
+		// (Optional) Inject the SSH host keys generated by clustertestd into VMs by cloud-init, and reject the
+		// connections if the VM presents a different host key.
+		// The cloud-init user-data is written to the snippet storage, and it replaces the user-data generated by
+		// Proxmox VE.
+		SSHHostKeys *struct {
+			// ID of the Proxmox VE storage that has the "snippets" content type (e.g. "shared").
+			// All nodes must be able to read it.
+			SnippetStorage string `yaml:"snippet_storage"`
+			// Path to the directory of the snippet storage on the host running clustertestd
+			// (e.g. "/mnt/pve/shared/snippets").
+			SnippetDir string `yaml:"snippet_dir"`
+		} `yaml:"ssh_host_keys"`
+		// (Optional) If true, the host key is trusted on first use (TOFU).  The key presented on the first connection
+		// is not verified, and the subsequent connections are rejected if the VM presents a different host key.
+		// The ssh_host_keys is more secure.  If both are specified, TOFU is used only for the VMs without the
+		// injected keys.
+		SSHHostKeyTOFU bool `yaml:"ssh_host_key_tofu"`
 	}
 	VMs map[string]*PveVM
 }
@@ -65,3 +96,123 @@ func (s *PveSpec) String() string {
 func (s *PveSpec) Type() models.SpecType {
 	return models.SpecType("proxmox-ve")
 }
+func (s *PveSpec) Validate() models.ValidationErrors {
+	var errs models.ValidationErrors
+	if px := s.Proxmox; px == nil {
+		errs.Add("proxmox", "must not be empty")
+	} else {
+		if px.Address == "" {
+			errs.Add("proxmox.address", "must not be empty")
+		}
+		a := px.Account
+		hasPassword := a.User != "" && a.Password != ""
+		hasToken := a.TokenID != "" && a.TokenSecret != ""
+		if !hasPassword && !hasToken {
+			errs.Add("proxmox.account", "either user and password or token_id and token_secret are required")
+		}
+	}
+
+	if len(s.AddressPools) == 0 {
+		errs.Add("address_pools", "must not be empty")
+	}
+	for i, pool := range s.AddressPools {
+		field := fmt.Sprintf("address_pools[%d]", i)
+		if pool == nil {
+			errs.Add(field, "must not be empty")
+			continue
+		}
+		start := parseIPv4(&errs, field+".start_address", pool.StartAddress)
+		end := parseIPv4(&errs, field+".end_address", pool.EndAddress)
+		gateway := parseIPv4(&errs, field+".gateway", pool.Gateway)
+		if pool.CIDR <= 0 || pool.CIDR > 32 {
+			errs.Add(field+".cidr", "must be between 1 and 32: %d", pool.CIDR)
+			continue
+		}
+		if start == nil {
+			continue
+		}
+		network := &net.IPNet{
+			IP:   start.Mask(net.CIDRMask(pool.CIDR, 32)),
+			Mask: net.CIDRMask(pool.CIDR, 32),
+		}
+		if end != nil {
+			if !network.Contains(end) {
+				errs.Add(field+".end_address", "out of network %s: %s", network, end)
+			} else if bytes.Compare(start, end) > 0 {
+				errs.Add(field+".end_address", "must not be smaller than the start_address: %s", end)
+			}
+		}
+		if gateway != nil && !network.Contains(gateway) {
+			errs.Add(field+".gateway", "out of network %s: %s", network, gateway)
+		}
+	}
+
+	if s.User == nil {
+		errs.Add("user", "must not be empty")
+	} else {
+		if s.User.User == "" {
+			errs.Add("user.user", "must not be empty")
+		}
+		if k := s.User.SSHHostKeys; k != nil {
+			if k.SnippetStorage == "" {
+				errs.Add("user.ssh_host_keys.snippet_storage", "must not be empty")
+			}
+			if k.SnippetDir == "" {
+				errs.Add("user.ssh_host_keys.snippet_dir", "must not be empty")
+			}
+		}
+	}
+
+	if len(s.VMs) == 0 {
+		errs.Add("vms", "must not be empty")
+	}
+	for _, name := range s.vmNames() {
+		vm := s.VMs[name]
+		field := "vms." + name
+		if vm == nil {
+			errs.Add(field, "must not be empty")
+			continue
+		}
+		if vm.Template == "" {
+			errs.Add(field+".template", "must not be empty")
+		}
+		if vm.Nodes <= 0 {
+			errs.Add(field+".nodes", "must be larger than 0")
+		}
+		if vm.Processors <= 0 {
+			errs.Add(field+".processors", "must be larger than 0")
+		}
+		if vm.MemorySize <= 0 {
+			errs.Add(field+".memory_size", "must be larger than 0")
+		}
+		if vm.StorageSize < 0 {
+			errs.Add(field+".storage_size", "must not be negative")
+		}
+		errs.Extend(field+".scripts", vm.Scripts.Validate())
+	}
+	return errs
+}
+
+// vmNames returns the sorted names of VM groups.
+func (s *PveSpec) vmNames() []string {
+	var names []string
+	for name := range s.VMs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseIPv4 parses the IPv4 address.  If it is invalid, it adds a problem to errs and returns nil.
+func parseIPv4(errs *models.ValidationErrors, field, addr string) net.IP {
+	if addr == "" {
+		errs.Add(field, "must not be empty")
+		return nil
+	}
+	ip := net.ParseIP(addr).To4()
+	if ip == nil {
+		errs.Add(field, "invalid IPv4 address: %s", addr)
+		return nil
+	}
+	return ip
+}
@@ -0,0 +1,108 @@
+package proxmoxve
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/pkg/errors"
+	. "github.com/yuuki0xff/clustertest/provisioners/proxmoxve/api"
+	"github.com/yuuki0xff/yaml"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// userData is the cloud-init user-data to inject the SSH host key.
+// It replaces the user-data generated by Proxmox VE, so it has the same settings as the generated one.
+type userData struct {
+	Hostname          string   `yaml:"hostname"`
+	ManageEtcHosts    bool     `yaml:"manage_etc_hosts"`
+	User              string   `yaml:"user"`
+	SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys,omitempty"`
+	Chpasswd          struct {
+		Expire bool `yaml:"expire"`
+	} `yaml:"chpasswd"`
+	Users []string `yaml:"users"`
+	// Remove the host keys copied from the template, and use only the injected key.
+	SSHDeleteKeys  bool              `yaml:"ssh_deletekeys"`
+	SSHGenKeyTypes []string          `yaml:"ssh_genkeytypes"`
+	SSHKeys        map[string]string `yaml:"ssh_keys"`
+}
+
+// newHostKey generates the SSH host key.  It returns the private key in PEM format and the public key.
+// ECDSA is used because the old versions of OpenSSH cannot read the ed25519 key in PEM format.
+func newHostKey() (string, ssh.PublicKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", nil, err
+	}
+	pub, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", nil, err
+	}
+	priv := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	return string(priv), pub, nil
+}
+
+// injectHostKey generates the SSH host key of the VM and writes the cloud-init user-data to the snippet storage.
+// It returns the value of the "cicustom" option and the public key to pin.
+func (p *PveProvisioner) injectHostKey(id NodeVMID, hostname string) (string, ssh.PublicKey, error) {
+	k := p.spec.User.SSHHostKeys
+	priv, pub, err := newHostKey()
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to generate SSH host key")
+	}
+
+	data := &userData{
+		Hostname:       hostname,
+		ManageEtcHosts: true,
+		User:           p.spec.User.User,
+		Users:          []string{"default"},
+		SSHDeleteKeys:  true,
+		SSHGenKeyTypes: []string{},
+		SSHKeys: map[string]string{
+			"ecdsa_private": priv,
+			"ecdsa_public":  strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))),
+		},
+	}
+	if key := p.spec.User.SSHPublicKey; key != "" {
+		data.SSHAuthorizedKeys = []string{key}
+	}
+	b, err := yaml.Marshal(data)
+	if err != nil {
+		return "", nil, err
+	}
+	name := snippetName(id)
+	// The user-data has the private key.
+	err = ioutil.WriteFile(filepath.Join(k.SnippetDir, name), append([]byte("#cloud-config\n"), b...), 0600)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to write cloud-init user-data")
+	}
+	return fmt.Sprintf("user=%s:snippets/%s", k.SnippetStorage, name), pub, nil
+}
+
+// removeHostKey removes the cloud-init user-data of the VM.  It does nothing if the host keys are not injected.
+func (p *PveProvisioner) removeHostKey(id NodeVMID) error {
+	if p.spec.User == nil || p.spec.User.SSHHostKeys == nil {
+		return nil
+	}
+	err := os.Remove(filepath.Join(p.spec.User.SSHHostKeys.SnippetDir, snippetName(id)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// snippetName returns the file name of the cloud-init user-data of the VM.
+func snippetName(id NodeVMID) string {
+	return fmt.Sprintf("clustertest-%s-%s.yaml", id.NodeID, id.VMID)
+}
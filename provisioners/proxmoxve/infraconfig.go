@@ -1,6 +1,7 @@
 package proxmoxve
 
 import (
+	"fmt"
 	"github.com/yuuki0xff/clustertest/models"
 	. "github.com/yuuki0xff/clustertest/provisioners/proxmoxve/api"
 	"net"
@@ -9,8 +10,10 @@ import (
 
 type PveInfraConfig struct {
 	PveSpec *PveSpec
-	VMs     map[string][]VMConfig
-	m       sync.Mutex
+	// Name of the user created by cloud-init.
+	User string
+	VMs  map[string][]VMConfig
+	m    sync.Mutex
 }
 type VMConfig struct {
 	ID   NodeVMID
@@ -19,10 +22,14 @@ type VMConfig struct {
 }
 
 func NewPveInfraConfig(spec *PveSpec) *PveInfraConfig {
-	return &PveInfraConfig{
+	c := &PveInfraConfig{
 		PveSpec: spec,
 		VMs:     map[string][]VMConfig{},
 	}
+	if spec.User != nil {
+		c.User = spec.User.User
+	}
+	return c
 }
 
 func (c *PveInfraConfig) String() string {
@@ -31,8 +38,53 @@ func (c *PveInfraConfig) String() string {
 func (c *PveInfraConfig) Spec() models.Spec {
 	return c.PveSpec
 }
+func (c *PveInfraConfig) Hosts() map[string][]string {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	user := c.User
+	if user == "" {
+		user = "root"
+	}
+	hosts := map[string][]string{}
+	for name, vms := range c.VMs {
+		for _, vm := range vms {
+			hosts[name] = append(hosts[name], fmt.Sprintf("%s@%s", user, vm.IP))
+		}
+	}
+	return hosts
+}
 func (c *PveInfraConfig) AddVM(name string, vm VMConfig) {
 	c.m.Lock()
 	defer c.m.Unlock()
 	c.VMs[name] = append(c.VMs[name], vm)
 }
+
+// RemoveVM removes the VM from the VM group.
+func (c *PveInfraConfig) RemoveVM(name string, id NodeVMID) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	vms := c.VMs[name]
+	for i := range vms {
+		if vms[i].ID == id {
+			c.VMs[name] = append(vms[:i:i], vms[i+1:]...)
+			break
+		}
+	}
+	if len(c.VMs[name]) == 0 {
+		delete(c.VMs, name)
+	}
+}
+
+// AllVMs returns a copy of the VMs.
+func (c *PveInfraConfig) AllVMs() map[string][]VMConfig {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	m := map[string][]VMConfig{}
+	for name, vms := range c.VMs {
+		m[name] = append([]VMConfig(nil), vms...)
+	}
+	return m
+}
@@ -9,13 +9,17 @@ import (
 	"github.com/yuuki0xff/clustertest/executors/callback"
 	"github.com/yuuki0xff/clustertest/executors/localshell"
 	"github.com/yuuki0xff/clustertest/executors/remoteshell"
+	"github.com/yuuki0xff/clustertest/executors/upload"
 	"github.com/yuuki0xff/clustertest/models"
 	"github.com/yuuki0xff/clustertest/provisioners"
 	"github.com/yuuki0xff/clustertest/provisioners/proxmoxve/addresspool"
 	. "github.com/yuuki0xff/clustertest/provisioners/proxmoxve/api"
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
+	"io"
 	"net"
+	"path"
 	"sync"
 	"time"
 )
@@ -27,6 +31,7 @@ const DeleteTimeout = 5 * time.Minute
 
 const specType = models.SpecType("proxmox-ve")
 const vmConfigsAttrName = "provisioners/proxmox-ve/vm-configs"
+const vmGroupNameAttrName = "provisioners/proxmox-ve/vm-group-name"
 
 // TODO
 // タスクが動いている最中、特にReserve()とCreate()の間にschedulerStatusが実行されてしまうと、
@@ -53,12 +58,21 @@ type PveProvisioner struct {
 	prefix string
 	spec   *PveSpec
 	config *PveInfraConfig
+	// SSH settings for the remote-shell executor.
+	sshAuth     []ssh.AuthMethod
+	sshPool     *remoteshell.ConnPool
+	sshHostKeys *remoteshell.HostKeyStore
 }
 
 // Reserve() reserves all resources (CPU, memory, storage, etc) of defined by PveSpec.
-func (p *PveProvisioner) Reserve() error {
+func (p *PveProvisioner) Reserve(ctx context.Context) error {
+	err := p.initSSH()
+	if err != nil {
+		return err
+	}
+
 	c := p.client()
-	err := c.Ticket()
+	err = c.Ticket()
 	if err != nil {
 		return errors.Wrap(err, "failed to get Proxmox VE API ticket")
 	}
@@ -75,31 +89,69 @@ func (p *PveProvisioner) Reserve() error {
 
 	// Create resources.
 	conf := NewPveInfraConfig(p.spec)
+	var allocated []VMConfig
+	var reserveErr error
 	err = GlobalScheduler.Transaction(func(scheduler *ScheduleTx) error {
 		return addresspool.GlobalPool.Transaction(func(pool *addresspool.AddressPoolTx) error {
 			eg := errgroup.Group{}
 			for vmGroupName, vm := range p.spec.VMs {
 				for i := 0; i < vm.Nodes; i++ {
-					err := p.allocateVM(c, conf, &eg, segs, scheduler, pool, vmGroupName, vm, i)
+					err := p.allocateVM(ctx, c, conf, &allocated, &eg, segs, scheduler, pool, vmGroupName, vm, i)
 					if err != nil {
-						return err
+						// Wait for background jobs before removing cloned VMs.
+						eg.Wait()
+						return p.revertVMs(c, conf, err, &reserveErr)
 					}
 				}
 			}
-			return eg.Wait()
+			if err := eg.Wait(); err != nil {
+				return p.revertVMs(c, conf, err, &reserveErr)
+			}
+			return nil
 		})
 	})
 	if err != nil {
-		// TODO: remove allocated resources
+		// All cloned VMs are removed, and the transactions released the IP addresses and the scheduler resources.
 		return err
 	}
+	if reserveErr != nil {
+		// Some cloned VMs could not be removed.  The transactions are committed to keep the resources of them, so
+		// release the resources of other VMs.  Delete() retries to remove the remaining VMs and releases the rest.
+		remaining := map[string]bool{}
+		for _, vms := range conf.AllVMs() {
+			for _, vm := range vms {
+				remaining[vm.IP.String()] = true
+			}
+		}
+		for _, vm := range allocated {
+			if !remaining[vm.IP.String()] {
+				addresspool.GlobalPool.Free(vm.IP)
+				if vm.ID.NodeID != "" {
+					GlobalScheduler.Free(vm.ID.NodeID, vm.Spec)
+				}
+			}
+		}
+		p.config = conf
+		return reserveErr
+	}
 	// Update the InfraConfig.
 	p.config = conf
 	return nil
 }
 
+// revertVMs removes the cloned VMs before the transactions release their resources.
+// If succeeded, it returns the err to revert the transactions.  Otherwise, it sets the reserveErr and returns nil to
+// commit the transactions, because the resources are still used by the remaining VMs.
+func (p *PveProvisioner) revertVMs(c *PveClient, conf *PveInfraConfig, err error, reserveErr *error) error {
+	if derr := p.deleteVMs(c, conf, false); derr != nil {
+		*reserveErr = errors.Wrapf(err, "failed to remove cloned VMs (%s)", derr)
+		return nil
+	}
+	return err
+}
+
 // Create starts all VMs of defined by PveSpec.
-func (p *PveProvisioner) Create() error {
+func (p *PveProvisioner) Create(ctx context.Context) error {
 	c := p.client()
 	err := c.Ticket()
 	if err != nil {
@@ -113,7 +165,8 @@ func (p *PveProvisioner) Create() error {
 		for _, vm := range vms {
 			vm := vm
 			eg.Go(func() error {
-				ctx, _ := context.WithTimeout(context.Background(), StartTimeout)
+				ctx, cancel := context.WithTimeout(ctx, StartTimeout)
+				defer cancel()
 				return c.StartVM(vm.ID).Wait(ctx)
 			})
 		}
@@ -145,60 +198,48 @@ func (p *PveProvisioner) Create() error {
 }
 
 // Delete deletes all resources of defined by PveSpec.
+// If resources are not reserved, Delete does nothing.
+// If failed to delete some VMs, the VMs remain in the InfraConfig.  You can retry to delete them.
 func (p *PveProvisioner) Delete() error {
 	if p.config == nil {
-		return errors.Errorf("still not provisioned")
+		// Still not provisioned.
+		return nil
 	}
 
 	c := p.client()
 	err := c.Ticket()
 	if err != nil {
-		return err
+		return errors.Wrap(err, "failed to get Proxmox VE API ticket")
 	}
 
-	// Delete resources.
-	eg := errgroup.Group{}
-	for _, vms := range p.config.VMs {
-		for _, vm := range vms {
-			vm := vm
-			eg.Go(func() error {
-				ctx, _ := context.WithTimeout(context.Background(), DeleteTimeout)
-				err := c.StopVM(vm.ID).Wait(ctx)
-				if err != nil {
-					return errors.Wrap(err, "failed to stop VM")
-				}
-				err = c.DeleteVM(vm.ID).Wait(ctx)
-				if err != nil {
-					return errors.Wrap(err, "failed to delete VM")
-				}
-
-				addresspool.GlobalPool.Free(vm.IP)
-				GlobalScheduler.Free(vm.ID.NodeID, vm.Spec)
-				return nil
-			})
-		}
-	}
-	err = eg.Wait()
+	err = p.deleteVMs(c, p.config, true)
 	if err != nil {
-		return nil
+		return err
 	}
 
 	// All resources are deleted.
 	// Should discard the InfraConfig.
 	p.config = nil
+	if p.sshPool != nil {
+		p.sshPool.Close()
+	}
 	return nil
 }
 func (p *PveProvisioner) Spec() models.Spec {
 	return p.spec
 }
 func (p *PveProvisioner) Config() models.InfraConfig {
+	if p.config == nil {
+		return nil
+	}
 	return p.config
 }
 func (p *PveProvisioner) ScriptSets() []*models.ScriptSet {
 	var sets []*models.ScriptSet
 	for name, vmGroup := range p.spec.VMs {
 		attrs := map[interface{}]interface{}{
-			vmConfigsAttrName: p.config.VMs[name],
+			vmConfigsAttrName:   p.config.VMs[name],
+			vmGroupNameAttrName: name,
 		}
 		s := &models.ScriptSet{
 			Before: vmGroup.Scripts.Before.SetAttrs(attrs).Get(),
@@ -215,9 +256,18 @@ func (p *PveProvisioner) ScriptExecutor(scriptType models.ScriptType) models.Scr
 	switch scriptType {
 	case models.ScriptType("remote-shell"):
 		newExecutor = func(config *VMConfig, script models.Script) models.ScriptExecutor {
-			return &remoteshell.Executor{
-				User: p.spec.User.User,
-				Host: config.IP.String(),
+			return p.remoteShellExecutor(config.IP.String())
+		}
+	case models.ScriptType("upload"):
+		newExecutor = func(config *VMConfig, script models.Script) models.ScriptExecutor {
+			host := config.IP.String()
+			return &upload.Executor{
+				Remote: p.remoteShellExecutor(host),
+				Data: &upload.TemplateData{
+					Host:  host,
+					Group: script.GetAttr(vmGroupNameAttrName).(string),
+					Hosts: p.hostAddresses(),
+				},
 			}
 		}
 	case models.ScriptType("local-shell"):
@@ -230,15 +280,17 @@ func (p *PveProvisioner) ScriptExecutor(scriptType models.ScriptType) models.Scr
 	}
 
 	return &callback.Executor{
-		Fn: func(script models.Script) models.ScriptResult {
-			mr := &executors.MergedResult{}
+		Fn: func(ctx context.Context, script models.Script) models.ScriptResult {
+			mr := &executors.MergedResult{
+				NameStr: script.GetAttr(vmGroupNameAttrName).(string),
+			}
 			lock := sync.Mutex{}
 			vmConfigs := script.GetAttr(vmConfigsAttrName).([]VMConfig)
 
 			co.ParForAll(vmConfigs, func(i int) {
 				c := vmConfigs[i]
 				e := newExecutor(&c, script)
-				result := e.Execute(script)
+				result := e.Execute(ctx, script)
 
 				lock.Lock()
 				mr.Append(result)
@@ -248,12 +300,82 @@ func (p *PveProvisioner) ScriptExecutor(scriptType models.ScriptType) models.Scr
 		},
 	}
 }
+func (p *PveProvisioner) CollectArtifacts(ctx context.Context, fn func(name string, r io.Reader) error) error {
+	if p.config == nil {
+		return nil
+	}
+	var m sync.Mutex
+	eg := errgroup.Group{}
+	for name, vms := range p.config.AllVMs() {
+		vmGroup := p.spec.VMs[name]
+		if vmGroup == nil || vmGroup.Scripts == nil || len(vmGroup.Scripts.Artifacts) == 0 {
+			continue
+		}
+		for _, vm := range vms {
+			name := name
+			host := vm.IP.String()
+			e := p.remoteShellExecutor(host)
+			eg.Go(func() error {
+				err := e.Fetch(ctx, vmGroup.Scripts.Artifacts, func(file string, r io.Reader) error {
+					// The fn may not be safe for concurrent use.
+					m.Lock()
+					defer m.Unlock()
+					return fn(path.Join(name, host, file), r)
+				})
+				return errors.Wrapf(err, "failed to collect artifacts from %s", host)
+			})
+		}
+	}
+	return eg.Wait()
+}
+
+// initSSH loads the credentials and prepares the connection pool for the remote-shell executor.
+func (p *PveProvisioner) initSSH() error {
+	var keyFile, password string
+	if u := p.spec.User; u != nil {
+		keyFile = u.SSHPrivateKey
+		password = u.Password
+		if u.SSHHostKeys != nil || u.SSHHostKeyTOFU {
+			p.sshHostKeys = remoteshell.NewHostKeyStore()
+			p.sshHostKeys.TOFU = u.SSHHostKeyTOFU
+		}
+	}
+	auth, err := remoteshell.AuthMethods(keyFile, password)
+	if err != nil {
+		return err
+	}
+	p.sshAuth = auth
+	p.sshPool = remoteshell.NewConnPool()
+	return nil
+}
+
+// hostAddresses returns the IP addresses of all VMs grouped by name of the VM group.
+func (p *PveProvisioner) hostAddresses() map[string][]string {
+	hosts := map[string][]string{}
+	for name, vms := range p.config.AllVMs() {
+		for _, vm := range vms {
+			hosts[name] = append(hosts[name], vm.IP.String())
+		}
+	}
+	return hosts
+}
+func (p *PveProvisioner) remoteShellExecutor(host string) *remoteshell.Executor {
+	return &remoteshell.Executor{
+		User:     p.spec.User.User,
+		Host:     host,
+		Auth:     p.sshAuth,
+		HostKeys: p.sshHostKeys,
+		Pool:     p.sshPool,
+	}
+}
 func (p *PveProvisioner) client() *PveClient {
 	px := p.spec.Proxmox
 	return NewPveClient(PveClientOption{
 		Address:     px.Address,
 		User:        px.Account.User,
 		Password:    px.Account.Password,
+		TokenID:     px.Account.TokenID,
+		TokenSecret: px.Account.TokenSecret,
 		Fingerprint: px.Fingerprint,
 	})
 }
@@ -336,8 +458,10 @@ func (p *PveProvisioner) updateSchedulerStatus(c *PveClient) (err error) {
 	return
 }
 func (p *PveProvisioner) allocateVM(
+	ctx context.Context,
 	c *PveClient,
 	conf *PveInfraConfig,
+	allocated *[]VMConfig,
 	eg *errgroup.Group,
 	segs []addresspool.Segment,
 	scheduler *ScheduleTx,
@@ -356,11 +480,16 @@ func (p *PveProvisioner) allocateVM(
 		Memory:     vm.MemorySize,
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), ScheduleTimeout)
-	nodeID, err := scheduler.ScheduleWait(ctx, vmSpec)
+	scheduleCtx, cancel := context.WithTimeout(ctx, ScheduleTimeout)
+	defer cancel()
+	// Record the allocated resources to release them if failed to remove the cloned VMs.
+	*allocated = append(*allocated, VMConfig{IP: ip})
+	nodeID, err := scheduler.ScheduleWait(scheduleCtx, vmSpec)
 	if err != nil {
 		return err
 	}
+	(*allocated)[len(*allocated)-1].ID.NodeID = nodeID
+	(*allocated)[len(*allocated)-1].Spec = vmSpec
 
 	// Clone template.
 	template := p.templateName(vm.Template, nodeID)
@@ -369,10 +498,14 @@ func (p *PveProvisioner) allocateVM(
 		return errors.Wrapf(err, "not found template (%s)", template)
 	}
 
+	vmName := fmt.Sprintf("%s-%s-%s-%d", p.prefix, p.spec.Name, vmGroupName, i)
 	var to NodeVMID
 	var task *Task
 	func() {
-		PveCloneSem.Acquire(context.Background(), 1)
+		err = PveCloneSem.Acquire(ctx, 1)
+		if err != nil {
+			return
+		}
 		defer PveCloneSem.Release(1)
 
 		// Generate Random ID
@@ -388,7 +521,6 @@ func (p *PveProvisioner) allocateVM(
 		}
 
 		// Clone specified VM and set up it.
-		vmName := fmt.Sprintf("%s-%s-%s-%d", p.prefix, p.spec.Name, vmGroupName, i)
 		description := fmt.Sprintf(
 			"This VM created by clustertest-proxmox-ve-provisioner.\n"+
 				"\n"+
@@ -407,7 +539,7 @@ func (p *PveProvisioner) allocateVM(
 			ip.String(),
 		)
 		task = c.CloneVM(from, to, vmName, description, vm.Pool)
-		err = task.WaitFn(context.Background())
+		err = task.WaitFn(ctx)
 		err = errors.Wrap(err, "failed to clone")
 	}()
 	if err != nil {
@@ -422,9 +554,15 @@ func (p *PveProvisioner) allocateVM(
 
 	eg.Go(func() error {
 		// Wait for clone operation to complete.
-		ctx, _ := context.WithTimeout(context.Background(), CloneTimeout)
-		err = task.Wait(ctx)
+		ctx, cancel := context.WithTimeout(ctx, CloneTimeout)
+		defer cancel()
+		err := task.Wait(ctx)
 		if err != nil {
+			if ctx.Err() == nil {
+				// The failed clone task removes the VM.
+				conf.RemoveVM(vmGroupName, to)
+				return errors.Wrap(err, "failed to clone")
+			}
 			return errors.Wrap(err, "clone operation is timeout")
 		}
 
@@ -441,7 +579,7 @@ func (p *PveProvisioner) allocateVM(
 			return errors.Wrap(err, "failed to reconnect cloud-init drive")
 		}
 
-		err = c.UpdateConfig(to, &Config{
+		vmConfig := &Config{
 			CPUCores:   vm.Processors,
 			CPUSockets: 1,
 			VCPUs:      vm.Processors,
@@ -449,7 +587,16 @@ func (p *PveProvisioner) allocateVM(
 			User:       p.spec.User.User,
 			SSHKeys:    p.spec.User.SSHPublicKey,
 			IPAddress:  addresspool.ToPveIPConf(s, ip),
-		})
+		}
+		if p.spec.User.SSHHostKeys != nil {
+			var hostKey ssh.PublicKey
+			vmConfig.CICustom, hostKey, err = p.injectHostKey(to, vmName)
+			if err != nil {
+				return err
+			}
+			p.sshHostKeys.Pin(ip.String(), hostKey)
+		}
+		err = c.UpdateConfig(to, vmConfig)
 		if err != nil {
 			return errors.Wrap(err, "failed to update config")
 		}
@@ -457,6 +604,41 @@ func (p *PveProvisioner) allocateVM(
 	})
 	return nil
 }
+
+// deleteVMs stops and deletes all VMs in the conf.
+// If release is true, it releases the IP addresses and scheduler resources of deleted VMs.
+// The deleted VMs are removed from the conf.
+func (p *PveProvisioner) deleteVMs(c *PveClient, conf *PveInfraConfig, release bool) error {
+	eg := errgroup.Group{}
+	for name, vms := range conf.AllVMs() {
+		for _, vm := range vms {
+			name := name
+			vm := vm
+			eg.Go(func() error {
+				ctx, cancel := context.WithTimeout(context.Background(), DeleteTimeout)
+				defer cancel()
+				err := c.StopVM(vm.ID).Wait(ctx)
+				if err != nil {
+					return errors.Wrapf(err, "failed to stop VM (id=%s)", vm.ID)
+				}
+				err = c.DeleteVM(vm.ID).Wait(ctx)
+				if err != nil {
+					return errors.Wrapf(err, "failed to delete VM (id=%s)", vm.ID)
+				}
+
+				conf.RemoveVM(name, vm.ID)
+				if release {
+					addresspool.GlobalPool.Free(vm.IP)
+					GlobalScheduler.Free(vm.ID.NodeID, vm.Spec)
+				}
+				// The VM is already deleted, so it is not retried even if failed.
+				err = p.removeHostKey(vm.ID)
+				return errors.Wrapf(err, "failed to remove cloud-init user-data (id=%s)", vm.ID)
+			})
+		}
+	}
+	return eg.Wait()
+}
 func (p *PveProvisioner) templateName(name string, node NodeID) string {
 	return fmt.Sprintf("%s-%s", name, node)
 }
@@ -0,0 +1,237 @@
+package proxmoxve
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/clustertest/provisioners/proxmoxve/addresspool"
+	. "github.com/yuuki0xff/clustertest/provisioners/proxmoxve/api"
+	"github.com/yuuki0xff/clustertest/provisioners/proxmoxve/api/pvetest"
+	"github.com/yuuki0xff/yaml"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestPveSpec(t *testing.T, address string) *PveSpec {
+	spec := &PveSpec{}
+	err := yaml.Unmarshal([]byte(fmt.Sprintf(`
+name: test
+proxmox:
+  address: %s
+  account:
+    user: %s
+    password: %s
+address_pools:
+  - start_address: 192.0.2.10
+    end_address: 192.0.2.20
+    cidr: 24
+    gateway: 192.0.2.1
+user:
+  user: admin
+  ssh_public_key: ssh-ed25519 AAAA admin@host
+vms:
+  web:
+    template: ubuntu
+    nodes: 2
+    processors: 2
+    memory_size: 1024
+    storage_size: 10
+`, address, pvetest.DefaultUser, pvetest.DefaultPassword)), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+// The scheduler and the address pool are shared by all tests because they are global variables.
+// All tests must use the same simulator.
+func TestPveProvisioner(t *testing.T) {
+	s := pvetest.NewServer()
+	defer s.Close()
+	for i, node := range []NodeID{"node1", "node2"} {
+		s.AddNode(pvetest.Node{ID: node, MaxCPU: 4, MaxMem: 16 << 30})
+		s.AddVM(pvetest.VM{
+			ID:       NodeVMID{NodeID: node, VMID: VMID(fmt.Sprint(100 + i))},
+			Name:     "ubuntu-" + string(node),
+			Template: true,
+		})
+	}
+	templates := len(s.VMs())
+
+	assertReleased := func(t *testing.T) {
+		assert.Len(t, s.VMs(), templates)
+		for _, n := range GlobalScheduler.nodes {
+			assert.Equal(t, 0, n.VCPU.Used+n.VCPU.Reserved, n.String())
+			assert.Equal(t, 0, n.VMem.Used+n.VMem.Reserved, n.String())
+		}
+		// All addresses are available.
+		_, ip, ok := addresspool.GlobalPool.AllocateIP([]addresspool.Segment{{
+			StartAddress: net.ParseIP("192.0.2.10"),
+			EndAddress:   net.ParseIP("192.0.2.10"),
+			Mask:         24,
+			Gateway:      net.ParseIP("192.0.2.1"),
+		}})
+		if assert.True(t, ok, "addresses are not released") {
+			addresspool.GlobalPool.Free(ip)
+		}
+	}
+
+	t.Run("should_create_and_delete_vms", func(t *testing.T) {
+		p := &PveProvisioner{
+			prefix: "task",
+			spec:   newTestPveSpec(t, s.URL),
+		}
+		if !assert.NoError(t, p.Reserve(context.Background())) {
+			return
+		}
+		hosts := p.Config().Hosts()["web"]
+		assert.Len(t, hosts, 2)
+		vms := p.config.AllVMs()["web"]
+		for _, vm := range vms {
+			svm, ok := s.VM(vm.ID.VMID)
+			if !assert.True(t, ok) {
+				continue
+			}
+			assert.Equal(t, 2, svm.Config.CPUCores)
+			assert.Equal(t, 1024, svm.Config.Memory)
+			assert.Equal(t, "admin", svm.Config.User)
+			assert.Equal(t, 10, svm.DiskSizes["scsi0"])
+			assert.Contains(t, svm.Config.IPAddress, vm.IP.String())
+			assert.Equal(t, StoppedVMStatus, svm.Status)
+		}
+
+		if !assert.NoError(t, p.Create(context.Background())) {
+			p.Delete()
+			return
+		}
+		for _, vm := range vms {
+			svm, _ := s.VM(vm.ID.VMID)
+			assert.Equal(t, RunningVMStatus, svm.Status)
+		}
+
+		assert.NoError(t, p.Delete())
+		assert.Nil(t, p.Config())
+		assertReleased(t)
+	})
+
+	t.Run("should_inject_ssh_host_keys", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "clustertest-snippets-")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		spec := newTestPveSpec(t, s.URL)
+		spec.User.SSHHostKeys = &struct {
+			SnippetStorage string `yaml:"snippet_storage"`
+			SnippetDir     string `yaml:"snippet_dir"`
+		}{SnippetStorage: "shared", SnippetDir: dir}
+		p := &PveProvisioner{
+			prefix: "task",
+			spec:   spec,
+		}
+		if !assert.NoError(t, p.Reserve(context.Background())) {
+			return
+		}
+		for _, vm := range p.config.AllVMs()["web"] {
+			svm, _ := s.VM(vm.ID.VMID)
+			assert.Equal(t, "user=shared:snippets/"+snippetName(vm.ID), svm.Config.CICustom)
+
+			b, err := ioutil.ReadFile(filepath.Join(dir, snippetName(vm.ID)))
+			if !assert.NoError(t, err) {
+				continue
+			}
+			assert.True(t, strings.HasPrefix(string(b), "#cloud-config\n"))
+			var data userData
+			if !assert.NoError(t, yaml.Unmarshal(b, &data)) {
+				continue
+			}
+			assert.Equal(t, "admin", data.User)
+			assert.Equal(t, []string{"ssh-ed25519 AAAA admin@host"}, data.SSHAuthorizedKeys)
+			signer, err := ssh.ParsePrivateKey([]byte(data.SSHKeys["ecdsa_private"]))
+			if !assert.NoError(t, err) {
+				continue
+			}
+			// The injected key is pinned, and other keys are rejected.
+			assert.NoError(t, p.sshHostKeys.Verify(vm.IP.String(), signer.PublicKey()))
+			_, other, _ := newHostKey()
+			assert.Error(t, p.sshHostKeys.Verify(vm.IP.String(), other))
+		}
+		_, unknown, _ := newHostKey()
+		assert.Error(t, p.sshHostKeys.Verify("192.0.2.250", unknown), "unknown hosts must be rejected")
+
+		assert.NoError(t, p.Delete())
+		files, _ := ioutil.ReadDir(dir)
+		assert.Empty(t, files)
+		assertReleased(t)
+	})
+
+	t.Run("should_delete_vms_when_create_failed", func(t *testing.T) {
+		s.FailTask = func(typ string, id VMID) error {
+			if typ == "qmstart" {
+				return errors.New("failed to start")
+			}
+			return nil
+		}
+		defer func() { s.FailTask = nil }()
+
+		p := &PveProvisioner{
+			prefix: "task",
+			spec:   newTestPveSpec(t, s.URL),
+		}
+		if !assert.NoError(t, p.Reserve(context.Background())) {
+			return
+		}
+		err := p.Create(context.Background())
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "failed to start")
+		}
+		assert.NoError(t, p.Delete())
+		assertReleased(t)
+	})
+
+	t.Run("should_keep_vms_when_failed_to_remove_cloned_vms", func(t *testing.T) {
+		var m sync.Mutex
+		var clones int
+		s.FailTask = func(typ string, id VMID) error {
+			m.Lock()
+			defer m.Unlock()
+			switch typ {
+			case "qmclone":
+				clones++
+				if clones > 1 {
+					return errors.New("failed to clone")
+				}
+			case "qmdestroy":
+				return errors.New("failed to destroy")
+			}
+			return nil
+		}
+		defer func() { s.FailTask = nil }()
+
+		p := &PveProvisioner{
+			prefix: "task",
+			spec:   newTestPveSpec(t, s.URL),
+		}
+		err := p.Reserve(context.Background())
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "failed to remove cloned VMs")
+		}
+		if !assert.NotNil(t, p.Config()) {
+			return
+		}
+		assert.Len(t, p.config.AllVMs()["web"], 1)
+
+		// Retry to remove the VM.
+		s.FailTask = nil
+		assert.NoError(t, p.Delete())
+		assertReleased(t)
+	})
+}
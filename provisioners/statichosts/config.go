@@ -0,0 +1,103 @@
+package statichosts
+
+import (
+	"fmt"
+	"github.com/yuuki0xff/clustertest/config"
+	"github.com/yuuki0xff/clustertest/models"
+	"sort"
+)
+
+func init() {
+	config.SpecInitializers[models.SpecType("static-hosts")] = func() models.Spec { return &StaticSpec{} }
+}
+
+type StaticSpec struct {
+	// Identifier of the spec.
+	Name string
+	// Default SSH settings of all hosts.
+	User *struct {
+		User     string
+		Password string
+		// (Optional) Path to the private key to connect hosts.
+		// If it is empty, the ssh-agent and the default private keys (~/.ssh/id_*) are used.
+		SSHPrivateKey string `yaml:"ssh_private_key"`
+		// (Optional) If true, the host key is trusted on first use (TOFU).  The key presented on the first connection
+		// is not verified, and the subsequent connections are rejected if the host presents a different host key.
+		SSHHostKeyTOFU bool `yaml:"ssh_host_key_tofu"`
+	}
+	// (Optional) Scripts to prepare/clean up hosts.
+	// These are executed on all hosts like scripts of host groups.
+	// The local-shell scripts are executed only once with the following environment variables:
+	//   CLUSTERTEST_GROUP: Name of the host group ("hooks" for the hooks).
+	//   CLUSTERTEST_HOSTS: Space-separated addresses of the hosts (e.g. "192.168.0.10 192.168.0.11").
+	Hooks *struct {
+		// Executed by Create().
+		Create *config.ScriptConfig
+		// Executed by Delete().
+		Delete *config.ScriptConfig
+	}
+	Hosts map[string]*StaticHostGroup
+}
+type StaticHostGroup struct {
+	// Addresses of hosts (e.g. "192.168.0.10" or "192.168.0.10:2222").
+	Addresses []string
+	// (Optional) SSH user of this group.  It overrides the StaticSpec.User.User.
+	User string
+	// Define tasks to execute on hosts.
+	Scripts *config.ScriptConfigSet
+}
+
+func (s *StaticSpec) String() string {
+	return "<StaticSpec>"
+}
+func (s *StaticSpec) Type() models.SpecType {
+	return specType
+}
+
+func (s *StaticSpec) Validate() models.ValidationErrors {
+	var errs models.ValidationErrors
+	if h := s.Hooks; h != nil {
+		errs.Extend("hooks.create", h.Create.Validate())
+		errs.Extend("hooks.delete", h.Delete.Validate())
+	}
+
+	if len(s.Hosts) == 0 {
+		errs.Add("hosts", "must not be empty")
+	}
+	var names []string
+	for name := range s.Hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g := s.Hosts[name]
+		field := "hosts." + name
+		if g == nil {
+			errs.Add(field, "must not be empty")
+			continue
+		}
+		if len(g.Addresses) == 0 {
+			errs.Add(field+".addresses", "must not be empty")
+		}
+		for i, addr := range g.Addresses {
+			if addr == "" {
+				errs.Add(fmt.Sprintf("%s.addresses[%d]", field, i), "must not be empty")
+			} else if _, err := parseAddress(addr); err != nil {
+				errs.Add(fmt.Sprintf("%s.addresses[%d]", field, i), "%s", err)
+			}
+		}
+		errs.Extend(field+".scripts", g.Scripts.Validate())
+	}
+	return errs
+}
+
+// user returns the SSH user of the group.
+func (s *StaticSpec) user(g *StaticHostGroup) string {
+	if g.User != "" {
+		return g.User
+	}
+	if s.User != nil && s.User.User != "" {
+		return s.User.User
+	}
+	return "root"
+}
@@ -0,0 +1,4 @@
+// Static Hosts Provisioner
+//
+// It uses pre-existing machines (e.g. bare-metal servers or running VMs) instead of creating VMs.
+package statichosts
@@ -0,0 +1,56 @@
+package statichosts
+
+import (
+	"fmt"
+	"github.com/yuuki0xff/clustertest/executors/remoteshell"
+	"github.com/yuuki0xff/clustertest/models"
+	"net"
+	"strconv"
+)
+
+type StaticInfraConfig struct {
+	StaticSpec *StaticSpec
+	// Reserved hosts grouped by name of host group.
+	Groups map[string][]StaticHost
+}
+type StaticHost struct {
+	User string
+	// Host name or IP address.
+	Host string
+	// Port of SSH server.  Zero means the default port.
+	Port int
+}
+
+func (c *StaticInfraConfig) String() string {
+	return "<StaticInfraConfig>"
+}
+func (c *StaticInfraConfig) Spec() models.Spec {
+	return c.StaticSpec
+}
+func (c *StaticInfraConfig) Hosts() map[string][]string {
+	hosts := map[string][]string{}
+	for name, hs := range c.Groups {
+		for _, h := range hs {
+			hosts[name] = append(hosts[name], fmt.Sprintf("%s@%s", h.User, h.Host))
+		}
+	}
+	return hosts
+}
+
+// AllHosts returns all hosts in all groups.
+func (c *StaticInfraConfig) AllHosts() []StaticHost {
+	var hosts []StaticHost
+	for _, hs := range c.Groups {
+		hosts = append(hosts, hs...)
+	}
+	return hosts
+}
+
+// Address returns the address of the SSH server.  It is used as the key of the host lock.
+func (h StaticHost) Address() string {
+	port := h.Port
+	if port == 0 {
+		port = remoteshell.DefaultPort
+	}
+	return net.JoinHostPort(h.Host, strconv.Itoa(port))
+}
@@ -0,0 +1,94 @@
+package statichosts
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+)
+
+// GlobalLocks prevents multiple tasks to use the same host.
+var GlobalLocks = NewHostLocks()
+
+// HostLocks manages the owner of each host.
+// The owner must be comparable.  Usually, it is a pointer to the provisioner.
+// It is safe for concurrent use.
+type HostLocks struct {
+	m      sync.Mutex
+	owners map[string]interface{}
+	// released is closed and replaced with a new channel when any host is unlocked.
+	released chan struct{}
+}
+
+func NewHostLocks() *HostLocks {
+	return &HostLocks{
+		owners:   map[string]interface{}{},
+		released: make(chan struct{}),
+	}
+}
+
+// TryLock locks all hosts atomically.
+// If some hosts are already locked by other owners, it locks nothing and returns false.
+func (l *HostLocks) TryLock(owner interface{}, hosts []string) bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	for _, h := range hosts {
+		if o, ok := l.owners[h]; ok && o != owner {
+			return false
+		}
+	}
+	for _, h := range hosts {
+		l.owners[h] = owner
+	}
+	return true
+}
+
+// Lock locks all hosts.  It waits until all hosts become available or the ctx is done.
+func (l *HostLocks) Lock(ctx context.Context, owner interface{}, hosts []string) error {
+	for {
+		// Get the channel before trying to lock to avoid missing the hosts released while trying.
+		l.m.Lock()
+		released := l.released
+		l.m.Unlock()
+
+		if l.TryLock(owner, hosts) {
+			return nil
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "hosts are used by other tasks: %v", l.lockedBy(owner, hosts))
+		}
+	}
+}
+
+// Unlock unlocks the hosts locked by the owner.
+func (l *HostLocks) Unlock(owner interface{}, hosts []string) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	for _, h := range hosts {
+		if l.owners[h] == owner {
+			delete(l.owners, h)
+		}
+	}
+	// Wake up the waiters.
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// lockedBy returns the hosts locked by other owners.
+func (l *HostLocks) lockedBy(owner interface{}, hosts []string) []string {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	var locked []string
+	for _, h := range hosts {
+		if o, ok := l.owners[h]; ok && o != owner {
+			locked = append(locked, h)
+		}
+	}
+	sort.Strings(locked)
+	return locked
+}
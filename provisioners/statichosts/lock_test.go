@@ -0,0 +1,67 @@
+package statichosts
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestHostLocks_TryLock(t *testing.T) {
+	t.Run("should_not_share_a_host", func(t *testing.T) {
+		l := NewHostLocks()
+		a, b := &struct{ int }{1}, &struct{ int }{2}
+		assert.True(t, l.TryLock(a, []string{"h1:22", "h2:22"}))
+		assert.False(t, l.TryLock(b, []string{"h2:22", "h3:22"}))
+		// Locking is atomic.  The h3 must not be locked by the failed call.
+		assert.True(t, l.TryLock(a, []string{"h3:22"}))
+	})
+	t.Run("should_lock_after_unlock", func(t *testing.T) {
+		l := NewHostLocks()
+		a, b := &struct{ int }{1}, &struct{ int }{2}
+		assert.True(t, l.TryLock(a, []string{"h1:22"}))
+		// Other owners cannot unlock it.
+		l.Unlock(b, []string{"h1:22"})
+		assert.False(t, l.TryLock(b, []string{"h1:22"}))
+		l.Unlock(a, []string{"h1:22"})
+		assert.True(t, l.TryLock(b, []string{"h1:22"}))
+	})
+}
+func TestHostLocks_Lock(t *testing.T) {
+	t.Run("should_wait_for_release", func(t *testing.T) {
+		l := NewHostLocks()
+		a, b := &struct{ int }{1}, &struct{ int }{2}
+		assert.True(t, l.TryLock(a, []string{"h1:22"}))
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			l.Unlock(a, []string{"h1:22"})
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		assert.NoError(t, l.Lock(ctx, b, []string{"h1:22"}))
+	})
+	t.Run("should_fail_when_timeout", func(t *testing.T) {
+		l := NewHostLocks()
+		a, b := &struct{ int }{1}, &struct{ int }{2}
+		assert.True(t, l.TryLock(a, []string{"h1:22"}))
+		ctx, cancel := context.WithTimeout(context.Background(), 0)
+		defer cancel()
+		err := l.Lock(ctx, b, []string{"h1:22"})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "h1:22")
+		}
+	})
+	t.Run("should_fail_when_canceled", func(t *testing.T) {
+		l := NewHostLocks()
+		a, b := &struct{ int }{1}, &struct{ int }{2}
+		assert.True(t, l.TryLock(a, []string{"h1:22"}))
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+		}()
+		err := l.Lock(ctx, b, []string{"h1:22"})
+		assert.Equal(t, context.Canceled, errors.Cause(err))
+	})
+}
@@ -0,0 +1,338 @@
+package statichosts
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/republicprotocol/co-go"
+	"github.com/yuuki0xff/clustertest/config"
+	"github.com/yuuki0xff/clustertest/executors"
+	"github.com/yuuki0xff/clustertest/executors/callback"
+	"github.com/yuuki0xff/clustertest/executors/localshell"
+	"github.com/yuuki0xff/clustertest/executors/remoteshell"
+	"github.com/yuuki0xff/clustertest/executors/upload"
+	"github.com/yuuki0xff/clustertest/models"
+	"github.com/yuuki0xff/clustertest/provisioners"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sync/errgroup"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LockTimeout is the maximum time to wait for other tasks to release the hosts.
+const LockTimeout = 30 * time.Minute
+const HookTimeout = 10 * time.Minute
+
+const specType = models.SpecType("static-hosts")
+const hostsAttrName = "provisioners/static-hosts/hosts"
+const hostGroupNameAttrName = "provisioners/static-hosts/host-group-name"
+const hookGroupName = "hooks"
+
+func init() {
+	provisioners.Provisioners[specType] = func(prefix string, spec models.Spec) models.Provisioner {
+		return &StaticProvisioner{
+			prefix: prefix,
+			spec:   spec.(*StaticSpec),
+			locks:  GlobalLocks,
+		}
+	}
+}
+
+// StaticProvisioner runs scripts on the pre-existing hosts.
+// The hosts are locked from Reserve() to Delete() to prevent multiple tasks to use the same host.
+type StaticProvisioner struct {
+	prefix string
+	spec   *StaticSpec
+	config *StaticInfraConfig
+	locks  *HostLocks
+	// SSH settings for the remote-shell executor.
+	sshAuth     []ssh.AuthMethod
+	sshPool     *remoteshell.ConnPool
+	sshHostKeys *remoteshell.HostKeyStore
+}
+
+// Reserve locks all hosts defined by StaticSpec.
+// If some hosts are used by other tasks, it waits for them to be released.
+func (p *StaticProvisioner) Reserve(ctx context.Context) error {
+	err := p.initSSH()
+	if err != nil {
+		return err
+	}
+
+	conf, err := p.newInfraConfig()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, LockTimeout)
+	defer cancel()
+	err = p.locks.Lock(ctx, p, lockKeys(conf))
+	if err != nil {
+		return err
+	}
+	p.config = conf
+	return nil
+}
+
+// Create executes the create hook if specified.
+func (p *StaticProvisioner) Create(ctx context.Context) error {
+	if p.spec.Hooks == nil {
+		return nil
+	}
+	return errors.Wrap(p.runHook(ctx, p.spec.Hooks.Create), "create hook failed")
+}
+
+// Delete executes the delete hook if specified, and releases all hosts.
+// If resources are not reserved, Delete does nothing.
+// The hosts are released even if the delete hook failed, because the hosts are not owned by clustertest.
+func (p *StaticProvisioner) Delete() error {
+	if p.config == nil {
+		// Still not reserved.
+		return nil
+	}
+	defer func() {
+		p.locks.Unlock(p, lockKeys(p.config))
+		p.config = nil
+		if p.sshPool != nil {
+			p.sshPool.Close()
+		}
+	}()
+
+	if p.spec.Hooks != nil {
+		err := p.runHook(context.Background(), p.spec.Hooks.Delete)
+		if err != nil {
+			return errors.Wrap(err, "delete hook failed")
+		}
+	}
+	return nil
+}
+func (p *StaticProvisioner) Spec() models.Spec {
+	return p.spec
+}
+func (p *StaticProvisioner) Config() models.InfraConfig {
+	if p.config == nil {
+		return nil
+	}
+	return p.config
+}
+func (p *StaticProvisioner) ScriptSets() []*models.ScriptSet {
+	var sets []*models.ScriptSet
+	for name, group := range p.spec.Hosts {
+		if group.Scripts == nil {
+			continue
+		}
+		attrs := map[interface{}]interface{}{
+			hostsAttrName:         p.config.Groups[name],
+			hostGroupNameAttrName: name,
+		}
+		s := &models.ScriptSet{
+			Before: group.Scripts.Before.SetAttrs(attrs).Get(),
+			Main:   group.Scripts.Main.SetAttrs(attrs).Get(),
+			After:  group.Scripts.After.SetAttrs(attrs).Get(),
+		}
+		sets = append(sets, s)
+	}
+	return sets
+}
+func (p *StaticProvisioner) ScriptExecutor(scriptType models.ScriptType) models.ScriptExecutor {
+	var newExecutor func(host *StaticHost, script models.Script) models.ScriptExecutor
+
+	switch scriptType {
+	case models.ScriptType("remote-shell"):
+		newExecutor = func(host *StaticHost, script models.Script) models.ScriptExecutor {
+			return p.remoteShellExecutor(host)
+		}
+	case models.ScriptType("upload"):
+		newExecutor = func(host *StaticHost, script models.Script) models.ScriptExecutor {
+			return &upload.Executor{
+				Remote: p.remoteShellExecutor(host),
+				Data: &upload.TemplateData{
+					Host:  host.Host,
+					Group: script.GetAttr(hostGroupNameAttrName).(string),
+					Hosts: p.hostAddresses(),
+				},
+			}
+		}
+	case models.ScriptType("local-shell"):
+		// The local-shell script runs on the local machine, so it is executed once per host group instead of per host.
+		return &callback.Executor{
+			Fn: func(ctx context.Context, script models.Script) models.ScriptResult {
+				group := script.GetAttr(hostGroupNameAttrName).(string)
+				var addrs []string
+				for _, h := range script.GetAttr(hostsAttrName).([]StaticHost) {
+					addrs = append(addrs, h.Host)
+				}
+				e := &localshell.Executor{
+					Env: []string{
+						"CLUSTERTEST_GROUP=" + group,
+						"CLUSTERTEST_HOSTS=" + strings.Join(addrs, " "),
+					},
+				}
+				mr := &executors.MergedResult{NameStr: group}
+				mr.Append(e.Execute(ctx, script))
+				return mr
+			},
+		}
+	default:
+		err := errors.Errorf("unsupported ScriptType: %s", scriptType)
+		panic(err)
+	}
+
+	return &callback.Executor{
+		Fn: func(ctx context.Context, script models.Script) models.ScriptResult {
+			mr := &executors.MergedResult{
+				NameStr: script.GetAttr(hostGroupNameAttrName).(string),
+			}
+			lock := sync.Mutex{}
+			hosts := script.GetAttr(hostsAttrName).([]StaticHost)
+
+			co.ParForAll(hosts, func(i int) {
+				h := hosts[i]
+				e := newExecutor(&h, script)
+				result := e.Execute(ctx, script)
+
+				lock.Lock()
+				mr.Append(result)
+				lock.Unlock()
+			})
+			return mr
+		},
+	}
+}
+func (p *StaticProvisioner) CollectArtifacts(ctx context.Context, fn func(name string, r io.Reader) error) error {
+	if p.config == nil {
+		return nil
+	}
+	var m sync.Mutex
+	eg := errgroup.Group{}
+	for name, hosts := range p.config.Groups {
+		group := p.spec.Hosts[name]
+		if group == nil || group.Scripts == nil || len(group.Scripts.Artifacts) == 0 {
+			continue
+		}
+		for _, h := range hosts {
+			name := name
+			h := h
+			e := p.remoteShellExecutor(&h)
+			eg.Go(func() error {
+				err := e.Fetch(ctx, group.Scripts.Artifacts, func(file string, r io.Reader) error {
+					// The fn may not be safe for concurrent use.
+					m.Lock()
+					defer m.Unlock()
+					return fn(path.Join(name, h.Host, file), r)
+				})
+				return errors.Wrapf(err, "failed to collect artifacts from %s", h.Host)
+			})
+		}
+	}
+	return eg.Wait()
+}
+
+// newInfraConfig parses the addresses of all hosts.
+func (p *StaticProvisioner) newInfraConfig() (*StaticInfraConfig, error) {
+	conf := &StaticInfraConfig{
+		StaticSpec: p.spec,
+		Groups:     map[string][]StaticHost{},
+	}
+	for name, group := range p.spec.Hosts {
+		if len(group.Addresses) == 0 {
+			return nil, errors.Errorf("host group %s has no address", name)
+		}
+		for _, addr := range group.Addresses {
+			h, err := parseAddress(addr)
+			if err != nil {
+				return nil, errors.Wrapf(err, "host group %s", name)
+			}
+			h.User = p.spec.user(group)
+			conf.Groups[name] = append(conf.Groups[name], h)
+		}
+	}
+	return conf, nil
+}
+
+// runHook executes the hook script on all hosts.  The local-shell hook is executed only once.
+func (p *StaticProvisioner) runHook(ctx context.Context, c *config.ScriptConfig) error {
+	script := c.Get()
+	if script == nil {
+		return nil
+	}
+	script.SetAttr(hostsAttrName, p.config.AllHosts())
+	script.SetAttr(hostGroupNameAttrName, hookGroupName)
+
+	ctx, cancel := context.WithTimeout(ctx, HookTimeout)
+	defer cancel()
+	result := p.ScriptExecutor(script.Type()).Execute(ctx, script)
+	if code := result.ExitCode(); code != 0 {
+		return errors.Errorf("exit code %d\n%s", code, result.Output())
+	}
+	return nil
+}
+
+// initSSH loads the credentials and prepares the connection pool for the remote-shell executor.
+func (p *StaticProvisioner) initSSH() error {
+	var keyFile, password string
+	if u := p.spec.User; u != nil {
+		keyFile = u.SSHPrivateKey
+		password = u.Password
+		if u.SSHHostKeyTOFU {
+			p.sshHostKeys = remoteshell.NewHostKeyStore()
+			p.sshHostKeys.TOFU = true
+		}
+	}
+	auth, err := remoteshell.AuthMethods(keyFile, password)
+	if err != nil {
+		return err
+	}
+	p.sshAuth = auth
+	p.sshPool = remoteshell.NewConnPool()
+	return nil
+}
+
+// hostAddresses returns the addresses of all hosts grouped by name of the host group.
+func (p *StaticProvisioner) hostAddresses() map[string][]string {
+	hosts := map[string][]string{}
+	for name, hs := range p.config.Groups {
+		for _, h := range hs {
+			hosts[name] = append(hosts[name], h.Host)
+		}
+	}
+	return hosts
+}
+func (p *StaticProvisioner) remoteShellExecutor(host *StaticHost) *remoteshell.Executor {
+	return &remoteshell.Executor{
+		User:     host.User,
+		Host:     host.Host,
+		Port:     host.Port,
+		Auth:     p.sshAuth,
+		HostKeys: p.sshHostKeys,
+		Pool:     p.sshPool,
+	}
+}
+
+// parseAddress parses "host" or "host:port".
+func parseAddress(addr string) (StaticHost, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		// The port is omitted.
+		return StaticHost{Host: addr}, nil
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return StaticHost{}, errors.Errorf("invalid port: %s", addr)
+	}
+	return StaticHost{Host: host, Port: p}, nil
+}
+
+// lockKeys returns the sorted addresses of all hosts.
+func lockKeys(conf *StaticInfraConfig) []string {
+	var keys []string
+	for _, h := range conf.AllHosts() {
+		keys = append(keys, h.Address())
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,98 @@
+package statichosts
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/clustertest/config"
+	localscript "github.com/yuuki0xff/clustertest/scripts/localshell"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStaticProvisioner_Reserve(t *testing.T) {
+	newProvisioner := func(locks *HostLocks, addrs ...string) *StaticProvisioner {
+		return &StaticProvisioner{
+			spec: &StaticSpec{
+				Hosts: map[string]*StaticHostGroup{
+					"web": {Addresses: addrs, User: "admin"},
+				},
+			},
+			locks: locks,
+		}
+	}
+
+	t.Run("should_lock_hosts_until_delete", func(t *testing.T) {
+		locks := NewHostLocks()
+		p := newProvisioner(locks, "192.0.2.1", "192.0.2.2:2222")
+		if !assert.NoError(t, p.Reserve(context.Background())) {
+			return
+		}
+		assert.Equal(t, map[string][]string{
+			"web": {"admin@192.0.2.1", "admin@192.0.2.2"},
+		}, p.Config().Hosts())
+		assert.False(t, locks.TryLock(&StaticProvisioner{}, []string{"192.0.2.1:22"}))
+		assert.False(t, locks.TryLock(&StaticProvisioner{}, []string{"192.0.2.2:2222"}))
+
+		assert.NoError(t, p.Delete())
+		assert.Nil(t, p.Config())
+		assert.True(t, locks.TryLock(&StaticProvisioner{}, []string{"192.0.2.1:22", "192.0.2.2:2222"}))
+	})
+	t.Run("should_release_hosts_when_delete_hook_failed", func(t *testing.T) {
+		locks := NewHostLocks()
+		p := newProvisioner(locks, "192.0.2.1")
+		p.spec.Hooks = &struct {
+			Create *config.ScriptConfig
+			Delete *config.ScriptConfig
+		}{
+			Delete: &config.ScriptConfig{Data: &localscript.Script{Commands: []string{"exit 1"}}},
+		}
+		if !assert.NoError(t, p.Reserve(context.Background())) {
+			return
+		}
+		err := p.Delete()
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "delete hook failed")
+		}
+
+		// Other tasks can reserve the host.
+		p2 := newProvisioner(locks, "192.0.2.1")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		assert.NoError(t, p2.Reserve(ctx))
+	})
+	t.Run("should_execute_local_shell_hook_once", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "clustertest-statichosts-")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer os.RemoveAll(dir)
+		out := filepath.Join(dir, "out")
+
+		p := newProvisioner(NewHostLocks(), "192.0.2.1", "192.0.2.2")
+		p.spec.Hooks = &struct {
+			Create *config.ScriptConfig
+			Delete *config.ScriptConfig
+		}{
+			Create: &config.ScriptConfig{Data: &localscript.Script{Commands: []string{
+				`echo "$CLUSTERTEST_GROUP $CLUSTERTEST_HOSTS" >>` + out,
+			}}},
+		}
+		if !assert.NoError(t, p.Reserve(context.Background())) {
+			return
+		}
+		defer p.Delete()
+		if !assert.NoError(t, p.Create(context.Background())) {
+			return
+		}
+		b, err := ioutil.ReadFile(out)
+		assert.NoError(t, err)
+		assert.Equal(t, "hooks 192.0.2.1 192.0.2.2\n", string(b))
+	})
+	t.Run("should_fail_with_invalid_port", func(t *testing.T) {
+		p := newProvisioner(NewHostLocks(), "192.0.2.1:ssh")
+		assert.Error(t, p.Reserve(context.Background()))
+	})
+}
@@ -0,0 +1,48 @@
+package rpc
+
+import (
+	"github.com/yuuki0xff/clustertest/databases"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// artifactsPath is the prefix of URLs to download artifacts.
+// The artifact is served at artifactsPath + "<task-id>/<name>".
+const artifactsPath = "/artifacts/"
+
+// serveArtifact sends the content of the artifact.
+// The artifacts are not transferred over JSON-RPC because they may be large.
+func (s *Server) serveArtifact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p := strings.TrimPrefix(r.URL.Path, artifactsPath)
+	i := strings.Index(p, "/")
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	tid := &databases.StringTaskID{
+		ID: p[:i],
+	}
+	f, err := s.DB.OpenArtifact(tid, p[i+1:])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	io.Copy(w, f)
+}
+
+// artifactURL returns the URL to download the artifact from the server.
+func artifactURL(server, id, name string) string {
+	segs := strings.Split(name, "/")
+	for i := range segs {
+		segs[i] = url.PathEscape(segs[i])
+	}
+	return strings.TrimSuffix(server, "/") + artifactsPath + url.PathEscape(id) + "/" + strings.Join(segs, "/")
+}
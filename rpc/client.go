@@ -5,24 +5,33 @@ import (
 	"github.com/pkg/errors"
 	"github.com/ybbus/jsonrpc"
 	"github.com/yuuki0xff/clustertest/models"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
+// waitTimeout is the timeout of each long polling request in Wait() and FollowLogs().
+const waitTimeout = 30 * time.Second
+
 type Client struct {
+	addr   string
 	client jsonrpc.RPCClient
 }
 
 func NewClient() (*Client, error) {
 	addr := os.Getenv("CLUSTERTEST_SERVER")
 	return &Client{
+		addr:   addr,
 		client: jsonrpc.NewClient(addr),
 	}, nil
 }
 
 func (c *Client) Create(task models.Task) (models.TaskID, error) {
 	var id string
-	err := c.call(&id, "run_task", task.SpecData())
+	err := c.call(&id, "run_task", task.SpecData(), task.Options())
 	if err != nil {
 		return nil, err
 	}
@@ -32,58 +41,108 @@ func (c *Client) List() ([]models.TaskDetail, error) {
 	return c.listTasks()
 }
 func (c *Client) Inspect(id models.TaskID) (models.TaskDetail, error) {
-	var err error
-	future := &Detail{}
-	future.ID = NewTaskID(id)
-	future.StatusStr, err = c.taskStatus(id)
+	d := &Detail{}
+	err := c.call(&d, "inspect_task", id.String())
 	if err != nil {
 		return nil, err
 	}
-	future.ResultObj, err = c.taskResult(id)
+	return d, nil
+}
+func (c *Client) Resolve(ref string) (models.TaskID, error) {
+	var id string
+	err := c.call(&id, "resolve_task", ref)
 	if err != nil {
 		return nil, err
 	}
-	return future, nil
+	return &TaskID{id}, nil
 }
 func (c *Client) Wait(id models.TaskID, ctx context.Context) error {
-	ticker := time.NewTicker(time.Second)
+	// The long polling requests are aborted when the ctx is done.
+	cc := c.withContext(ctx)
 	for {
-		select {
-		case <-ticker.C:
-			ready, err := c.isTaskReady(id)
-			if err != nil || !ready {
-				continue
-			}
+		// The server returns immediately when the task is finished.
+		ready, err := cc.waitTask(id, waitTimeout)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		if ready {
 			return nil
-		case <-ctx.Done():
-			return errors.Errorf("timeout")
 		}
 	}
 }
 func (c *Client) Cancel(id models.TaskID) error {
-	panic("not impl")
+	var ok bool
+	return c.call(&ok, "cancel_task", id.String())
+}
+func (c *Client) Release(id models.TaskID) error {
+	var ok bool
+	return c.call(&ok, "release_task", id.String())
 }
 func (c *Client) Delete(id models.TaskID) error {
-	panic("not impl")
+	var ok bool
+	return c.call(&ok, "delete_task", id.String())
 }
-func (c *Client) call(out interface{}, method string, args ...interface{}) error {
-	return c.client.CallFor(out, method, args)
+func (c *Client) Logs(id models.TaskID, offset int) ([]byte, error) {
+	var out []byte
+	err := c.call(&out, "task_logs", id.String(), offset)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FollowLogs waits for the output after the offset by the long polling and returns it.
+// It returns true if the task is finished and no more output will be written.
+func (c *Client) FollowLogs(id models.TaskID, offset int) ([]byte, bool, error) {
+	logs := &Logs{}
+	err := c.call(&logs, "wait_task_logs", id.String(), offset, int(waitTimeout/time.Second))
+	if err != nil {
+		return nil, false, err
+	}
+	return logs.Out, logs.Finished, nil
 }
-func (c *Client) taskStatus(id models.TaskID) (string, error) {
-	var s string
-	err := c.call(&s, "task_status", id.String())
-	return s, err
+func (c *Client) Artifacts(id models.TaskID) ([]models.Artifact, error) {
+	var artifacts []models.Artifact
+	err := c.call(&artifacts, "list_artifacts", id.String())
+	if err != nil {
+		return nil, err
+	}
+	return artifacts, nil
 }
-func (c *Client) isTaskReady(id models.TaskID) (bool, error) {
+func (c *Client) OpenArtifact(id models.TaskID, name string) (io.ReadCloser, error) {
+	resp, err := http.Get(artifactURL(c.addr, id.String(), name))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.Errorf("failed to download %s: %s", name, strings.TrimSpace(string(msg)))
+	}
+	return resp.Body, nil
+}
+
+// withContext returns a copy of the client that aborts the requests when the ctx is done.
+func (c *Client) withContext(ctx context.Context) *Client {
+	return &Client{
+		addr: c.addr,
+		client: jsonrpc.NewClientWithOpts(c.addr, &jsonrpc.RPCClientOpts{
+			HTTPClient: &http.Client{Transport: &ctxTransport{ctx: ctx}},
+		}),
+	}
+}
+func (c *Client) call(out interface{}, method string, args ...interface{}) error {
+	err := c.client.CallFor(out, method, args)
+	return decodeRPCError(err)
+}
+func (c *Client) waitTask(id models.TaskID, timeout time.Duration) (bool, error) {
 	var ready bool
-	err := c.call(&ready, "is_ready_task", id.String())
+	err := c.call(&ready, "wait_task", id.String(), int(timeout/time.Second))
 	return ready, err
 }
-func (c *Client) taskResult(id models.TaskID) (*Result, error) {
-	result := &Result{}
-	err := c.call(&result, "get_task_result", id.String())
-	return result, err
-}
 func (c *Client) listTasks() ([]models.TaskDetail, error) {
 	var ds []*Detail
 	err := c.call(&ds, "list_tasks")
@@ -98,3 +157,12 @@ func (c *Client) listTasks() ([]models.TaskDetail, error) {
 	}
 	return details, nil
 }
+
+// ctxTransport sends the requests with the ctx.
+type ctxTransport struct {
+	ctx context.Context
+}
+
+func (t *ctxTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return http.DefaultTransport.RoundTrip(req.WithContext(t.ctx))
+}
@@ -0,0 +1,28 @@
+package rpc
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/clustertest/databases"
+	"testing"
+	"time"
+)
+
+func TestClient_Wait(t *testing.T) {
+	t.Run("should_return_when_context_is_done", func(t *testing.T) {
+		db := databases.NewMemTaskDB()
+		c, closer := newTestClient(t, db)
+		defer closer()
+		id, err := db.Create(&databases.MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		assert.Equal(t, context.DeadlineExceeded, c.Wait(&TaskID{id.String()}, ctx))
+		// Should not wait for the long polling request.
+		assert.True(t, time.Since(start) < waitTimeout/2)
+	})
+}
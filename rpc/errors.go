@@ -0,0 +1,86 @@
+package rpc
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/semrush/zenrpc"
+	"github.com/ybbus/jsonrpc"
+	"github.com/yuuki0xff/clustertest/models"
+)
+
+// Error codes of the JSON-RPC.  The codes from -32000 to -32099 are reserved for implementation-defined errors.
+const (
+	TaskNotFoundCode   = -32001
+	InvalidStateCode   = -32002
+	AlreadyRunningCode = -32003
+	AmbiguousTaskCode  = -32004
+)
+
+// errorData is the "data" member of the JSON-RPC error.  It is used to restore the typed errors on the client.
+type errorData struct {
+	ID    string
+	Op    string   `json:",omitempty"`
+	State string   `json:",omitempty"`
+	IDs   []string `json:",omitempty"`
+}
+
+// newRPCError converts the typed errors to the JSON-RPC errors with distinct codes.
+// Other errors are returned as is.
+func newRPCError(err error) error {
+	switch e := errors.Cause(err).(type) {
+	case nil:
+		return nil
+	case *models.TaskNotFoundError:
+		return &zenrpc.Error{
+			Code:    TaskNotFoundCode,
+			Message: e.Error(),
+			Data:    &errorData{ID: e.ID},
+		}
+	case *models.InvalidStateError:
+		return &zenrpc.Error{
+			Code:    InvalidStateCode,
+			Message: e.Error(),
+			Data:    &errorData{ID: e.ID, Op: e.Op, State: e.State},
+		}
+	case *models.AlreadyRunningError:
+		return &zenrpc.Error{
+			Code:    AlreadyRunningCode,
+			Message: e.Error(),
+			Data:    &errorData{ID: e.ID, Op: e.Op, State: e.State},
+		}
+	case *models.AmbiguousTaskError:
+		return &zenrpc.Error{
+			Code:    AmbiguousTaskCode,
+			Message: e.Error(),
+			Data:    &errorData{ID: e.Ref, IDs: e.IDs},
+		}
+	default:
+		return err
+	}
+}
+
+// decodeRPCError converts the JSON-RPC errors to the typed errors.
+// Other errors are returned as is.
+func decodeRPCError(err error) error {
+	e, ok := err.(*jsonrpc.RPCError)
+	if !ok {
+		return err
+	}
+	data := &errorData{}
+	if b, err := json.Marshal(e.Data); err == nil {
+		json.Unmarshal(b, data)
+	}
+
+	switch e.Code {
+	case TaskNotFoundCode:
+		return &models.TaskNotFoundError{ID: data.ID}
+	case InvalidStateCode:
+		return &models.InvalidStateError{ID: data.ID, Op: data.Op, State: data.State}
+	case AlreadyRunningCode:
+		return &models.AlreadyRunningError{ID: data.ID, Op: data.Op, State: data.State}
+	case AmbiguousTaskCode:
+		return &models.AmbiguousTaskError{Ref: data.ID, IDs: data.IDs}
+	default:
+		return err
+	}
+}
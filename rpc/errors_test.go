@@ -0,0 +1,79 @@
+package rpc
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/semrush/zenrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/ybbus/jsonrpc"
+	"github.com/yuuki0xff/clustertest/databases"
+	"github.com/yuuki0xff/clustertest/models"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestClient(t *testing.T, db models.TaskDB) (*Client, func()) {
+	s := zenrpc.NewServer(zenrpc.Options{})
+	s.Register("", &Server{DB: db})
+	ts := httptest.NewServer(s)
+	return &Client{
+		addr:   ts.URL,
+		client: jsonrpc.NewClient(ts.URL),
+	}, ts.Close
+}
+
+func TestClient_errors(t *testing.T) {
+	t.Run("should_return_not_found_error", func(t *testing.T) {
+		c, closer := newTestClient(t, databases.NewMemTaskDB())
+		defer closer()
+
+		_, err := c.Inspect(&TaskID{"404"})
+		var nf *models.TaskNotFoundError
+		if assert.True(t, errors.As(err, &nf)) {
+			assert.Equal(t, "404", nf.ID)
+		}
+		assert.EqualError(t, err, "not found task: 404")
+		assert.IsType(t, &models.TaskNotFoundError{}, c.Cancel(&TaskID{"404"}))
+		assert.IsType(t, &models.TaskNotFoundError{}, c.Wait(&TaskID{"404"}, context.Background()))
+	})
+
+	t.Run("should_return_invalid_state_error", func(t *testing.T) {
+		db := databases.NewMemTaskDB()
+		c, closer := newTestClient(t, db)
+		defer closer()
+		id, err := db.Create(&databases.MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		err = c.Release(id)
+		var ise *models.InvalidStateError
+		if assert.True(t, errors.As(err, &ise)) {
+			assert.Equal(t, id.String(), ise.ID)
+			assert.Equal(t, "release", ise.Op)
+			assert.Equal(t, models.WaitingTaskState, ise.State)
+		}
+	})
+
+	t.Run("should_return_already_running_error", func(t *testing.T) {
+		db := databases.NewMemTaskDB()
+		c, closer := newTestClient(t, db)
+		defer closer()
+		id, err := db.Create(&databases.MemTask{})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		err = db.Consume(func(ctx context.Context, _ models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
+			err := c.Delete(id)
+			var are *models.AlreadyRunningError
+			if assert.True(t, errors.As(err, &are)) {
+				assert.Equal(t, "delete", are.Op)
+				assert.Equal(t, models.RunningTaskState, are.State)
+			}
+			return &databases.FileTaskResult{}, nil
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, c.Delete(id))
+	})
+}
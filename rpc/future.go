@@ -3,19 +3,28 @@ package rpc
 import (
 	"fmt"
 	"github.com/yuuki0xff/clustertest/models"
+	"time"
 )
 
 type Detail struct {
-	ID        *TaskID
-	StatusStr string
-	ResultObj *Result
+	ID          *TaskID
+	StatusStr   string
+	ResultObj   *Result
+	Created     time.Time
+	Hold        *models.HoldInfo
+	Opts        models.TaskOptions
+	Transitions []models.StateTransition
 }
 
 func NewDetail(d models.TaskDetail) *Detail {
 	return &Detail{
-		ID:        NewTaskID(d.TaskID()),
-		StatusStr: d.State(),
-		ResultObj: NewResult(d.TaskID(), d.Result()),
+		ID:          NewTaskID(d.TaskID()),
+		StatusStr:   d.State(),
+		ResultObj:   NewResult(d.TaskID(), d.Result()),
+		Created:     d.CreatedTime(),
+		Hold:        d.HoldInfo(),
+		Opts:        d.Options(),
+		Transitions: d.History(),
 	}
 }
 func (f *Detail) String() string {
@@ -27,6 +36,18 @@ func (f *Detail) TaskID() models.TaskID {
 func (f *Detail) State() string {
 	return f.StatusStr
 }
+func (f *Detail) CreatedTime() time.Time {
+	return f.Created
+}
+func (f *Detail) Options() models.TaskOptions {
+	return f.Opts
+}
+func (f *Detail) History() []models.StateTransition {
+	return f.Transitions
+}
+func (f *Detail) HoldInfo() *models.HoldInfo {
+	return f.Hold
+}
 func (f *Detail) Result() models.TaskResult {
 	if f.ResultObj != nil {
 		return f.ResultObj
@@ -7,22 +7,31 @@ import (
 	"time"
 )
 
+// Logs is the output of the task returned by the wait_task_logs.
+type Logs struct {
+	Out []byte
+	// Finished is true if the task is finished.  Then the output is complete.
+	Finished bool
+}
 type TaskID struct {
 	ID string
 }
 type Result struct {
-	ID     TaskID
-	ErrMsg string
-	Before *ScriptResult
-	Main   *ScriptResult
-	After  *ScriptResult
+	ID             TaskID
+	ErrMsg         string
+	TeardownErrMsg string
+	Before         *ScriptResult
+	Main           *ScriptResult
+	After          *ScriptResult
 }
 type ScriptResult struct {
-	Start    time.Time
-	End      time.Time
-	Hostname string
-	Out      []byte
-	Exit     int
+	NameStr      string
+	Start        time.Time
+	End          time.Time
+	Hostname     string
+	Out          []byte
+	Exit         int
+	ChildResults []*ScriptResult `json:",omitempty"`
 }
 
 func NewTaskID(id models.TaskID) *TaskID {
@@ -48,6 +57,9 @@ func NewResult(id models.TaskID, tr models.TaskResult) *Result {
 	if err := tr.Error(); err != nil {
 		r.ErrMsg = err.Error()
 	}
+	if err := tr.TeardownError(); err != nil {
+		r.TeardownErrMsg = err.Error()
+	}
 	return r
 }
 func (r *Result) String() string {
@@ -59,6 +71,12 @@ func (r *Result) Error() error {
 	}
 	return nil
 }
+func (r *Result) TeardownError() error {
+	if r.TeardownErrMsg != "" {
+		return errors.New(r.TeardownErrMsg)
+	}
+	return nil
+}
 func (r *Result) BeforeResult() models.ScriptResult {
 	if r.Before != nil {
 		return r.Before
@@ -82,17 +100,30 @@ func NewScriptResult(r models.ScriptResult) *ScriptResult {
 	if r == nil {
 		return nil
 	}
-	return &ScriptResult{
+	sr := &ScriptResult{
+		NameStr:  r.Name(),
 		Start:    r.StartTime(),
 		End:      r.EndTime(),
 		Hostname: r.Host(),
 		Out:      r.Output(),
 		Exit:     r.ExitCode(),
 	}
+	for _, c := range r.Children() {
+		sr.ChildResults = append(sr.ChildResults, NewScriptResult(c))
+	}
+	return sr
 }
 func (r *ScriptResult) String() string       { return "<ScriptResult>" }
+func (r *ScriptResult) Name() string         { return r.NameStr }
 func (r *ScriptResult) StartTime() time.Time { return r.Start }
 func (r *ScriptResult) EndTime() time.Time   { return r.End }
 func (r *ScriptResult) Host() string         { return r.Hostname }
 func (r *ScriptResult) Output() []byte       { return r.Out }
 func (r *ScriptResult) ExitCode() int        { return r.Exit }
+func (r *ScriptResult) Children() []models.ScriptResult {
+	var rs []models.ScriptResult
+	for _, c := range r.ChildResults {
+		rs = append(rs, c)
+	}
+	return rs
+}
@@ -8,16 +8,27 @@ import (
 
 	"github.com/semrush/zenrpc"
 	"github.com/semrush/zenrpc/smd"
+
+	"github.com/yuuki0xff/clustertest/models"
 )
 
 var RPC = struct {
-	Server struct{ Run_Task, Task_Status, Is_Ready_Task, Get_Task_Result, List_Tasks string }
+	Server struct{ Run_Task, Resolve_Task, Task_Status, Is_Ready_Task, Wait_Task, Get_Task_Result, Inspect_Task, Cancel_Task, Release_Task, Delete_Task, Task_Logs, Wait_Task_Logs, List_Artifacts, List_Tasks string }
 }{
-	Server: struct{ Run_Task, Task_Status, Is_Ready_Task, Get_Task_Result, List_Tasks string }{
+	Server: struct{ Run_Task, Resolve_Task, Task_Status, Is_Ready_Task, Wait_Task, Get_Task_Result, Inspect_Task, Cancel_Task, Release_Task, Delete_Task, Task_Logs, Wait_Task_Logs, List_Artifacts, List_Tasks string }{
 		Run_Task:        "run_task",
+		Resolve_Task:    "resolve_task",
 		Task_Status:     "task_status",
 		Is_Ready_Task:   "is_ready_task",
+		Wait_Task:       "wait_task",
 		Get_Task_Result: "get_task_result",
+		Inspect_Task:    "inspect_task",
+		Cancel_Task:     "cancel_task",
+		Release_Task:    "release_task",
+		Delete_Task:     "delete_task",
+		Task_Logs:       "task_logs",
+		Wait_Task_Logs:  "wait_task_logs",
+		List_Artifacts:  "list_artifacts",
 		List_Tasks:      "list_tasks",
 	},
 }
@@ -38,6 +49,29 @@ func (Server) SMD() smd.ServiceInfo {
 							"type": smd.Integer,
 						},
 					},
+					{
+						Name:        "options",
+						Optional:    true,
+						Description: ``,
+						Type:        smd.Object,
+						Properties:  map[string]smd.Property{},
+					},
+				},
+				Returns: smd.JSONSchema{
+					Description: ``,
+					Optional:    false,
+					Type:        smd.String,
+				},
+			},
+			"Resolve_Task": {
+				Description: `Resolve_Task returns the ID of the task specified by the ID or the name.`,
+				Parameters: []smd.JSONSchema{
+					{
+						Name:        "ref",
+						Optional:    false,
+						Description: ``,
+						Type:        smd.String,
+					},
 				},
 				Returns: smd.JSONSchema{
 					Description: ``,
@@ -77,6 +111,30 @@ func (Server) SMD() smd.ServiceInfo {
 					Type:        smd.Boolean,
 				},
 			},
+			"Wait_Task": {
+				Description: `Wait_Task waits until the task is finished or the timeout (in seconds) elapsed.
+It returns true if the task is finished.  The timeout is limited to MaxWaitTimeout.
+It also returns when the client disconnected.`,
+				Parameters: []smd.JSONSchema{
+					{
+						Name:        "id",
+						Optional:    false,
+						Description: ``,
+						Type:        smd.String,
+					},
+					{
+						Name:        "timeout",
+						Optional:    false,
+						Description: ``,
+						Type:        smd.Integer,
+					},
+				},
+				Returns: smd.JSONSchema{
+					Description: ``,
+					Optional:    false,
+					Type:        smd.Boolean,
+				},
+			},
 			"Get_Task_Result": {
 				Description: ``,
 				Parameters: []smd.JSONSchema{
@@ -101,6 +159,10 @@ func (Server) SMD() smd.ServiceInfo {
 							Description: ``,
 							Type:        smd.String,
 						},
+						"TeardownErrMsg": {
+							Description: ``,
+							Type:        smd.String,
+						},
 						"Before": {
 							Description: ``,
 							Ref:         "#/definitions/ScriptResult",
@@ -130,6 +192,10 @@ func (Server) SMD() smd.ServiceInfo {
 						"ScriptResult": {
 							Type: "object",
 							Properties: map[string]smd.Property{
+								"NameStr": {
+									Description: ``,
+									Type:        smd.String,
+								},
 								"Start": {
 									Description: ``,
 									Ref:         "#/definitions/time.Time",
@@ -155,6 +221,13 @@ func (Server) SMD() smd.ServiceInfo {
 									Description: ``,
 									Type:        smd.Integer,
 								},
+								"ChildResults": {
+									Description: ``,
+									Type:        smd.Array,
+									Items: map[string]string{
+										"$ref": "#/definitions/ScriptResult",
+									},
+								},
 							},
 						},
 						"time.Time": {
@@ -164,6 +237,286 @@ func (Server) SMD() smd.ServiceInfo {
 					},
 				},
 			},
+			"Inspect_Task": {
+				Description: ``,
+				Parameters: []smd.JSONSchema{
+					{
+						Name:        "id",
+						Optional:    false,
+						Description: ``,
+						Type:        smd.String,
+					},
+				},
+				Returns: smd.JSONSchema{
+					Description: ``,
+					Optional:    true,
+					Type:        smd.Object,
+					Properties: map[string]smd.Property{
+						"ID": {
+							Description: ``,
+							Ref:         "#/definitions/TaskID",
+							Type:        smd.Object,
+						},
+						"StatusStr": {
+							Description: ``,
+							Type:        smd.String,
+						},
+						"ResultObj": {
+							Description: ``,
+							Ref:         "#/definitions/Result",
+							Type:        smd.Object,
+						},
+						"Created": {
+							Description: ``,
+							Ref:         "#/definitions/time.Time",
+							Type:        smd.Object,
+						},
+						"Hold": {
+							Description: ``,
+							Ref:         "#/definitions/models.HoldInfo",
+							Type:        smd.Object,
+						},
+						"Opts": {
+							Description: ``,
+							Ref:         "#/definitions/models.TaskOptions",
+							Type:        smd.Object,
+						},
+						"Transitions": {
+							Description: ``,
+							Type:        smd.Array,
+							Items: map[string]string{
+								"$ref": "#/definitions/models.StateTransition",
+							},
+						},
+					},
+					Definitions: map[string]smd.Definition{
+						"TaskID": {
+							Type: "object",
+							Properties: map[string]smd.Property{
+								"ID": {
+									Description: ``,
+									Type:        smd.String,
+								},
+							},
+						},
+						"Result": {
+							Type: "object",
+							Properties: map[string]smd.Property{
+								"ID": {
+									Description: ``,
+									Ref:         "#/definitions/TaskID",
+									Type:        smd.Object,
+								},
+								"ErrMsg": {
+									Description: ``,
+									Type:        smd.String,
+								},
+								"TeardownErrMsg": {
+									Description: ``,
+									Type:        smd.String,
+								},
+								"Before": {
+									Description: ``,
+									Ref:         "#/definitions/ScriptResult",
+									Type:        smd.Object,
+								},
+								"Main": {
+									Description: ``,
+									Ref:         "#/definitions/ScriptResult",
+									Type:        smd.Object,
+								},
+								"After": {
+									Description: ``,
+									Ref:         "#/definitions/ScriptResult",
+									Type:        smd.Object,
+								},
+							},
+						},
+						"ScriptResult": {
+							Type: "object",
+							Properties: map[string]smd.Property{
+								"NameStr": {
+									Description: ``,
+									Type:        smd.String,
+								},
+								"Start": {
+									Description: ``,
+									Ref:         "#/definitions/time.Time",
+									Type:        smd.Object,
+								},
+								"End": {
+									Description: ``,
+									Ref:         "#/definitions/time.Time",
+									Type:        smd.Object,
+								},
+								"Hostname": {
+									Description: ``,
+									Type:        smd.String,
+								},
+								"Out": {
+									Description: ``,
+									Type:        smd.Array,
+									Items: map[string]string{
+										"type": smd.Integer,
+									},
+								},
+								"Exit": {
+									Description: ``,
+									Type:        smd.Integer,
+								},
+								"ChildResults": {
+									Description: ``,
+									Type:        smd.Array,
+									Items: map[string]string{
+										"$ref": "#/definitions/ScriptResult",
+									},
+								},
+							},
+						},
+						"time.Time": {
+							Type:       "object",
+							Properties: map[string]smd.Property{},
+						},
+						"models.HoldInfo": {
+							Type:       "object",
+							Properties: map[string]smd.Property{},
+						},
+						"models.TaskOptions": {
+							Type:       "object",
+							Properties: map[string]smd.Property{},
+						},
+						"models.StateTransition": {
+							Type:       "object",
+							Properties: map[string]smd.Property{},
+						},
+					},
+				},
+			},
+			"Cancel_Task": {
+				Description: ``,
+				Parameters: []smd.JSONSchema{
+					{
+						Name:        "id",
+						Optional:    false,
+						Description: ``,
+						Type:        smd.String,
+					},
+				},
+			},
+			"Release_Task": {
+				Description: ``,
+				Parameters: []smd.JSONSchema{
+					{
+						Name:        "id",
+						Optional:    false,
+						Description: ``,
+						Type:        smd.String,
+					},
+				},
+			},
+			"Delete_Task": {
+				Description: ``,
+				Parameters: []smd.JSONSchema{
+					{
+						Name:        "id",
+						Optional:    false,
+						Description: ``,
+						Type:        smd.String,
+					},
+				},
+			},
+			"Task_Logs": {
+				Description: ``,
+				Parameters: []smd.JSONSchema{
+					{
+						Name:        "id",
+						Optional:    false,
+						Description: ``,
+						Type:        smd.String,
+					},
+					{
+						Name:        "offset",
+						Optional:    false,
+						Description: ``,
+						Type:        smd.Integer,
+					},
+				},
+				Returns: smd.JSONSchema{
+					Description: ``,
+					Optional:    false,
+					Type:        smd.Array,
+					Items: map[string]string{
+						"type": smd.Integer,
+					},
+				},
+			},
+			"Wait_Task_Logs": {
+				Description: `Wait_Task_Logs waits until the output after the offset is available, the task is finished or the timeout (in
+seconds) elapsed, and returns the output after the offset.  The timeout is limited to MaxWaitTimeout.`,
+				Parameters: []smd.JSONSchema{
+					{
+						Name:        "id",
+						Optional:    false,
+						Description: ``,
+						Type:        smd.String,
+					},
+					{
+						Name:        "offset",
+						Optional:    false,
+						Description: ``,
+						Type:        smd.Integer,
+					},
+					{
+						Name:        "timeout",
+						Optional:    false,
+						Description: ``,
+						Type:        smd.Integer,
+					},
+				},
+				Returns: smd.JSONSchema{
+					Description: ``,
+					Optional:    true,
+					Type:        smd.Object,
+					Properties: map[string]smd.Property{
+						"Out": {
+							Description: ``,
+							Type:        smd.Array,
+							Items: map[string]string{
+								"type": smd.Integer,
+							},
+						},
+						"Finished": {
+							Description: `Finished is true if the task is finished.  Then the output is complete.`,
+							Type:        smd.Boolean,
+						},
+					},
+				},
+			},
+			"List_Artifacts": {
+				Description: ``,
+				Parameters: []smd.JSONSchema{
+					{
+						Name:        "id",
+						Optional:    false,
+						Description: ``,
+						Type:        smd.String,
+					},
+				},
+				Returns: smd.JSONSchema{
+					Description: ``,
+					Optional:    false,
+					Type:        smd.Array,
+					Items: map[string]string{
+						"$ref": "#/definitions/models.Artifact",
+					},
+					Definitions: map[string]smd.Definition{
+						"models.Artifact": {
+							Type:       "object",
+							Properties: map[string]smd.Property{},
+						},
+					},
+				},
+			},
 			"List_Tasks": {
 				Description: ``,
 				Parameters:  []smd.JSONSchema{},
@@ -192,6 +545,28 @@ func (Server) SMD() smd.ServiceInfo {
 									Ref:         "#/definitions/Result",
 									Type:        smd.Object,
 								},
+								"Created": {
+									Description: ``,
+									Ref:         "#/definitions/time.Time",
+									Type:        smd.Object,
+								},
+								"Hold": {
+									Description: ``,
+									Ref:         "#/definitions/models.HoldInfo",
+									Type:        smd.Object,
+								},
+								"Opts": {
+									Description: ``,
+									Ref:         "#/definitions/models.TaskOptions",
+									Type:        smd.Object,
+								},
+								"Transitions": {
+									Description: ``,
+									Type:        smd.Array,
+									Items: map[string]string{
+										"$ref": "#/definitions/models.StateTransition",
+									},
+								},
 							},
 						},
 						"TaskID": {
@@ -215,6 +590,10 @@ func (Server) SMD() smd.ServiceInfo {
 									Description: ``,
 									Type:        smd.String,
 								},
+								"TeardownErrMsg": {
+									Description: ``,
+									Type:        smd.String,
+								},
 								"Before": {
 									Description: ``,
 									Ref:         "#/definitions/ScriptResult",
@@ -235,6 +614,10 @@ func (Server) SMD() smd.ServiceInfo {
 						"ScriptResult": {
 							Type: "object",
 							Properties: map[string]smd.Property{
+								"NameStr": {
+									Description: ``,
+									Type:        smd.String,
+								},
 								"Start": {
 									Description: ``,
 									Ref:         "#/definitions/time.Time",
@@ -260,12 +643,31 @@ func (Server) SMD() smd.ServiceInfo {
 									Description: ``,
 									Type:        smd.Integer,
 								},
+								"ChildResults": {
+									Description: ``,
+									Type:        smd.Array,
+									Items: map[string]string{
+										"$ref": "#/definitions/ScriptResult",
+									},
+								},
 							},
 						},
 						"time.Time": {
 							Type:       "object",
 							Properties: map[string]smd.Property{},
 						},
+						"models.HoldInfo": {
+							Type:       "object",
+							Properties: map[string]smd.Property{},
+						},
+						"models.TaskOptions": {
+							Type:       "object",
+							Properties: map[string]smd.Property{},
+						},
+						"models.StateTransition": {
+							Type:       "object",
+							Properties: map[string]smd.Property{},
+						},
 					},
 				},
 			},
@@ -281,11 +683,12 @@ func (s Server) Invoke(ctx context.Context, method string, params json.RawMessag
 	switch method {
 	case RPC.Server.Run_Task:
 		var args = struct {
-			Spec []byte `json:"spec"`
+			Spec    []byte              `json:"spec"`
+			Options *models.TaskOptions `json:"options"`
 		}{}
 
 		if zenrpc.IsArray(params) {
-			if params, err = zenrpc.ConvertToObject([]string{"spec"}, params); err != nil {
+			if params, err = zenrpc.ConvertToObject([]string{"spec", "options"}, params); err != nil {
 				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
 			}
 		}
@@ -296,7 +699,26 @@ func (s Server) Invoke(ctx context.Context, method string, params json.RawMessag
 			}
 		}
 
-		resp.Set(s.Run_Task(args.Spec))
+		resp.Set(s.Run_Task(args.Spec, args.Options))
+
+	case RPC.Server.Resolve_Task:
+		var args = struct {
+			Ref string `json:"ref"`
+		}{}
+
+		if zenrpc.IsArray(params) {
+			if params, err = zenrpc.ConvertToObject([]string{"ref"}, params); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &args); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		resp.Set(s.Resolve_Task(args.Ref))
 
 	case RPC.Server.Task_Status:
 		var args = struct {
@@ -336,6 +758,26 @@ func (s Server) Invoke(ctx context.Context, method string, params json.RawMessag
 
 		resp.Set(s.Is_Ready_Task(args.Id))
 
+	case RPC.Server.Wait_Task:
+		var args = struct {
+			Id      string `json:"id"`
+			Timeout int    `json:"timeout"`
+		}{}
+
+		if zenrpc.IsArray(params) {
+			if params, err = zenrpc.ConvertToObject([]string{"id", "timeout"}, params); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &args); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		resp.Set(s.Wait_Task(ctx, args.Id, args.Timeout))
+
 	case RPC.Server.Get_Task_Result:
 		var args = struct {
 			Id string `json:"id"`
@@ -355,6 +797,142 @@ func (s Server) Invoke(ctx context.Context, method string, params json.RawMessag
 
 		resp.Set(s.Get_Task_Result(args.Id))
 
+	case RPC.Server.Inspect_Task:
+		var args = struct {
+			Id string `json:"id"`
+		}{}
+
+		if zenrpc.IsArray(params) {
+			if params, err = zenrpc.ConvertToObject([]string{"id"}, params); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &args); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		resp.Set(s.Inspect_Task(args.Id))
+
+	case RPC.Server.Cancel_Task:
+		var args = struct {
+			Id string `json:"id"`
+		}{}
+
+		if zenrpc.IsArray(params) {
+			if params, err = zenrpc.ConvertToObject([]string{"id"}, params); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &args); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		resp.Set(s.Cancel_Task(args.Id))
+
+	case RPC.Server.Release_Task:
+		var args = struct {
+			Id string `json:"id"`
+		}{}
+
+		if zenrpc.IsArray(params) {
+			if params, err = zenrpc.ConvertToObject([]string{"id"}, params); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &args); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		resp.Set(s.Release_Task(args.Id))
+
+	case RPC.Server.Delete_Task:
+		var args = struct {
+			Id string `json:"id"`
+		}{}
+
+		if zenrpc.IsArray(params) {
+			if params, err = zenrpc.ConvertToObject([]string{"id"}, params); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &args); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		resp.Set(s.Delete_Task(args.Id))
+
+	case RPC.Server.Task_Logs:
+		var args = struct {
+			Id     string `json:"id"`
+			Offset int    `json:"offset"`
+		}{}
+
+		if zenrpc.IsArray(params) {
+			if params, err = zenrpc.ConvertToObject([]string{"id", "offset"}, params); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &args); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		resp.Set(s.Task_Logs(args.Id, args.Offset))
+
+	case RPC.Server.Wait_Task_Logs:
+		var args = struct {
+			Id      string `json:"id"`
+			Offset  int    `json:"offset"`
+			Timeout int    `json:"timeout"`
+		}{}
+
+		if zenrpc.IsArray(params) {
+			if params, err = zenrpc.ConvertToObject([]string{"id", "offset", "timeout"}, params); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &args); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		resp.Set(s.Wait_Task_Logs(ctx, args.Id, args.Offset, args.Timeout))
+
+	case RPC.Server.List_Artifacts:
+		var args = struct {
+			Id string `json:"id"`
+		}{}
+
+		if zenrpc.IsArray(params) {
+			if params, err = zenrpc.ConvertToObject([]string{"id"}, params); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &args); err != nil {
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidParams, "", err.Error())
+			}
+		}
+
+		resp.Set(s.List_Artifacts(args.Id))
+
 	case RPC.Server.List_Tasks:
 		resp.Set(s.List_Tasks())
 
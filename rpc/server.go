@@ -3,12 +3,18 @@ package rpc
 //go:generate zenrpc
 
 import (
+	"context"
 	"github.com/semrush/zenrpc"
+	"github.com/yuuki0xff/clustertest/config"
 	"github.com/yuuki0xff/clustertest/databases"
 	"github.com/yuuki0xff/clustertest/models"
 	"net/http"
+	"time"
 )
 
+// MaxWaitTimeout is the maximum duration of the long polling by the wait_task.
+const MaxWaitTimeout = time.Minute
+
 type Server struct {
 	DB models.TaskDB
 } //zenrpc
@@ -19,45 +25,176 @@ func ServeServer(listenAddr string, db models.TaskDB) error {
 	}
 	s := zenrpc.NewServer(zenrpc.Options{})
 	s.Register("", srv)
-	return http.ListenAndServe(listenAddr, s)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", s)
+	mux.HandleFunc(artifactsPath, srv.serveArtifact)
+	return http.ListenAndServe(listenAddr, mux)
 }
 
-func (s *Server) Run_Task(spec []byte) string {
-	id, err := s.DB.Create(&databases.MemTask{
+func (s *Server) Run_Task(spec []byte, options *models.TaskOptions) (string, error) {
+	task := &databases.MemTask{
 		Spec: spec,
-	})
+	}
+	if options != nil {
+		task.Opts = *options
+	}
+	if task.Opts.Name == "" {
+		// Refer the task by the name of the config.
+		// The invalid config is ignored here.  The worker will report it.
+		task.Opts.Name, _ = config.LoadNameFromBytes(spec)
+	}
+	id, err := s.DB.Create(task)
+	if err != nil {
+		return "", newRPCError(err)
+	}
+	return id.String(), nil
+}
+
+// Resolve_Task returns the ID of the task specified by the ID or the name.
+func (s *Server) Resolve_Task(ref string) (string, error) {
+	id, err := s.DB.Resolve(ref)
+	if err != nil {
+		return "", newRPCError(err)
+	}
+	return id.String(), nil
+}
+func (s *Server) Task_Status(id string) (string, error) {
+	tid := &databases.StringTaskID{
+		ID: id,
+	}
+	detail, err := s.DB.Inspect(tid)
+	if err != nil {
+		return "", newRPCError(err)
+	}
+	return detail.State(), nil
+}
+func (s *Server) Is_Ready_Task(id string) (bool, error) {
+	state, err := s.Task_Status(id)
+	if err != nil {
+		return false, err
+	}
+	return models.IsTerminalState(state), nil
+}
+
+// Wait_Task waits until the task is finished or the timeout (in seconds) elapsed.
+// It returns true if the task is finished.  The timeout is limited to MaxWaitTimeout.
+// It also returns when the client disconnected.
+func (s *Server) Wait_Task(ctx context.Context, id string, timeout int) (bool, error) {
+	d := time.Duration(timeout) * time.Second
+	if d <= 0 || MaxWaitTimeout < d {
+		d = MaxWaitTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	tid := &databases.StringTaskID{
+		ID: id,
+	}
+	err := s.DB.Wait(tid, ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			// Timed out.  The client should retry.
+			return false, nil
+		}
+		return false, newRPCError(err)
+	}
+	return true, nil
+}
+func (s *Server) Get_Task_Result(id string) (*Result, error) {
+	tid := &databases.StringTaskID{
+		ID: id,
+	}
+	detail, err := s.DB.Inspect(tid)
 	if err != nil {
-		panic(err)
+		return nil, newRPCError(err)
 	}
-	return id.String()
+	return NewResult(&TaskID{id}, detail.Result()), nil
 }
-func (s *Server) Task_Status(id string) string {
+func (s *Server) Inspect_Task(id string) (*Detail, error) {
 	tid := &databases.StringTaskID{
 		ID: id,
 	}
 	detail, err := s.DB.Inspect(tid)
 	if err != nil {
-		panic(err)
+		return nil, newRPCError(err)
+	}
+	return NewDetail(detail), nil
+}
+func (s *Server) Cancel_Task(id string) error {
+	tid := &databases.StringTaskID{
+		ID: id,
+	}
+	return newRPCError(s.DB.Cancel(tid))
+}
+func (s *Server) Release_Task(id string) error {
+	tid := &databases.StringTaskID{
+		ID: id,
+	}
+	return newRPCError(s.DB.Release(tid))
+}
+func (s *Server) Delete_Task(id string) error {
+	tid := &databases.StringTaskID{
+		ID: id,
 	}
-	return detail.State()
+	return newRPCError(s.DB.Delete(tid))
 }
-func (s *Server) Is_Ready_Task(id string) bool {
-	return s.Task_Status(id) == "finished"
+func (s *Server) Task_Logs(id string, offset int) ([]byte, error) {
+	tid := &databases.StringTaskID{
+		ID: id,
+	}
+	out, err := s.DB.Logs(tid, offset)
+	if err != nil {
+		return nil, newRPCError(err)
+	}
+	return out, nil
 }
-func (s *Server) Get_Task_Result(id string) *Result {
+
+// Wait_Task_Logs waits until the output after the offset is available, the task is finished or the timeout (in
+// seconds) elapsed, and returns the output after the offset.  The timeout is limited to MaxWaitTimeout.
+func (s *Server) Wait_Task_Logs(ctx context.Context, id string, offset int, timeout int) (*Logs, error) {
+	d := time.Duration(timeout) * time.Second
+	if d <= 0 || MaxWaitTimeout < d {
+		d = MaxWaitTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
 	tid := &databases.StringTaskID{
 		ID: id,
 	}
+	err := s.DB.WaitLogs(tid, offset, ctx)
+	if err != nil && ctx.Err() == nil {
+		return nil, newRPCError(err)
+	}
+	// Get the state before fetching the output.  If the task was already finished, the output is complete.
 	detail, err := s.DB.Inspect(tid)
 	if err != nil {
-		panic(err)
+		return nil, newRPCError(err)
+	}
+	out, err := s.DB.Logs(tid, offset)
+	if err != nil {
+		return nil, newRPCError(err)
+	}
+	return &Logs{
+		Out:      out,
+		Finished: models.IsTerminalState(detail.State()),
+	}, nil
+}
+func (s *Server) List_Artifacts(id string) ([]models.Artifact, error) {
+	tid := &databases.StringTaskID{
+		ID: id,
+	}
+	artifacts, err := s.DB.Artifacts(tid)
+	if err != nil {
+		return nil, newRPCError(err)
 	}
-	return NewResult(&TaskID{id}, detail.Result())
+	return artifacts, nil
 }
-func (s *Server) List_Tasks() []*Detail {
+func (s *Server) List_Tasks() ([]*Detail, error) {
 	tasks, err := s.DB.List()
 	if err != nil {
-		panic(err)
+		return nil, newRPCError(err)
 	}
 
 	// Convert models.TaskDetail to []*Detail
@@ -65,5 +202,5 @@ func (s *Server) List_Tasks() []*Detail {
 	for _, t := range tasks {
 		ds = append(ds, NewDetail(t))
 	}
-	return ds
+	return ds, nil
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/yuuki0xff/clustertest/config"
 	"github.com/yuuki0xff/clustertest/models"
+	"strings"
 )
 
 const scriptType = models.ScriptType("local-shell")
@@ -37,3 +38,15 @@ func (s *Script) GetAttr(key interface{}) interface{} {
 	}
 	return s.attrs[key]
 }
+func (s *Script) Validate() models.ValidationErrors {
+	var errs models.ValidationErrors
+	if len(s.Commands) == 0 {
+		errs.Add("commands", "must not be empty")
+	}
+	for i, c := range s.Commands {
+		if strings.TrimSpace(c) == "" {
+			errs.Add(fmt.Sprintf("commands[%d]", i), "must not be empty")
+		}
+	}
+	return errs
+}
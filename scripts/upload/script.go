@@ -0,0 +1,90 @@
+package upload
+
+import (
+	"fmt"
+	"github.com/yuuki0xff/clustertest/config"
+	"github.com/yuuki0xff/clustertest/models"
+	"strconv"
+)
+
+const scriptType = models.ScriptType("upload")
+
+func init() {
+	config.ScriptInitializers[scriptType] = func() models.Script {
+		return &Script{}
+	}
+}
+
+// Script uploads local files to the hosts.
+type Script struct {
+	Files []*File
+	attrs map[interface{}]interface{}
+}
+
+// File is a file to upload.
+type File struct {
+	// Path of the source file on the host running the clustertest command.  The relative path is relative to the
+	// directory of the config file.  The clustertest command sends the content of the file with the task.
+	Src string
+	// Path of the destination on the remote host.  The parent directories are created if they do not exist.
+	Dest string
+	// (Optional) Permission of the destination in octal (e.g. "0755").  Default is "0644".
+	Mode string
+	// (Optional) If true, the source file is rendered as a text/template before uploading.
+	Template bool
+}
+
+func (*Script) String() string {
+	return fmt.Sprintf("<%s>", scriptType)
+}
+func (*Script) Type() models.ScriptType {
+	return scriptType
+}
+func (s *Script) SetAttr(key, value interface{}) {
+	if s.attrs == nil {
+		s.attrs = map[interface{}]interface{}{}
+	}
+	s.attrs[key] = value
+}
+func (s *Script) GetAttr(key interface{}) interface{} {
+	if s.attrs == nil {
+		return nil
+	}
+	return s.attrs[key]
+}
+
+// LocalFiles returns the source files.  They are attached to the task by the clustertest command.
+func (s *Script) LocalFiles() []string {
+	var paths []string
+	for _, f := range s.Files {
+		if f != nil {
+			paths = append(paths, f.Src)
+		}
+	}
+	return paths
+}
+func (s *Script) Validate() models.ValidationErrors {
+	var errs models.ValidationErrors
+	if len(s.Files) == 0 {
+		errs.Add("files", "must not be empty")
+	}
+	for i, f := range s.Files {
+		field := fmt.Sprintf("files[%d]", i)
+		if f == nil {
+			errs.Add(field, "must not be empty")
+			continue
+		}
+		if f.Src == "" {
+			errs.Add(field+".src", "must not be empty")
+		}
+		if f.Dest == "" {
+			errs.Add(field+".dest", "must not be empty")
+		}
+		if f.Mode != "" {
+			if m, err := strconv.ParseUint(f.Mode, 8, 32); err != nil || m > 07777 {
+				errs.Add(field+".mode", "invalid mode: %s", f.Mode)
+			}
+		}
+	}
+	return errs
+}
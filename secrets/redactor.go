@@ -0,0 +1,80 @@
+package secrets
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Placeholder replaces the secret values.
+const Placeholder = "********"
+
+// Redactor replaces the secret values in the output with the Placeholder.
+// It is safe for concurrent use.  The nil Redactor does nothing.
+type Redactor struct {
+	m      sync.Mutex
+	values []string
+}
+
+// redactWriter redacts the data written to the underlying writer.
+type redactWriter struct {
+	r *Redactor
+	w io.Writer
+}
+
+// Add registers the value to redact.
+// Each line of the multi-line value is also redacted because the output is written line by line.
+func (r *Redactor) Add(value string) {
+	if r == nil || value == "" {
+		return
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.values = append(r.values, value)
+	if strings.Contains(value, "\n") {
+		for _, line := range strings.Split(value, "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" {
+				r.values = append(r.values, line)
+			}
+		}
+	}
+	// Replace the longest value first.
+	sort.SliceStable(r.values, func(i, j int) bool {
+		return len(r.values[i]) > len(r.values[j])
+	})
+}
+
+// Redact returns b with the values replaced.  It does not modify b.
+func (r *Redactor) Redact(b []byte) []byte {
+	if r == nil {
+		return b
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for _, v := range r.values {
+		b = bytes.ReplaceAll(b, []byte(v), []byte(Placeholder))
+	}
+	return b
+}
+
+// RedactString returns s with the values replaced.
+func (r *Redactor) RedactString(s string) string {
+	return string(r.Redact([]byte(s)))
+}
+
+// Writer returns a writer that redacts the data before writing it to the w.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	return &redactWriter{r: r, w: w}
+}
+func (w *redactWriter) Write(p []byte) (int, error) {
+	_, err := w.w.Write(w.r.Redact(p))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
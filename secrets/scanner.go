@@ -0,0 +1,159 @@
+package secrets
+
+import (
+	"regexp"
+	"strings"
+)
+
+// scalarStyle is the style of the YAML scalar that contains the reference.
+type scalarStyle int
+
+const (
+	plainStyle scalarStyle = iota
+	singleQuotedStyle
+	doubleQuotedStyle
+	literalStyle
+	foldedStyle
+)
+
+// blockHeaderPattern matches the end of the line that starts a block scalar (e.g. "key: |" or "- >-").
+var blockHeaderPattern = regexp.MustCompile(`(^|\s)([|>])[-+1-9]*$`)
+
+// yamlScanner finds the references in the YAML document line by line.
+// It is not a complete YAML parser, but it recognizes the quotes, the comments and the block scalars to escape the
+// resolved values for the style of the scalar.
+type yamlScanner struct {
+	// quote is the style of the quoted scalar continued from the previous line.  It is plainStyle outside quotes.
+	quote scalarStyle
+	// block is the style of the current block scalar.
+	block scalarStyle
+	// blockIndent is the indentation of the line that started the block scalar.  It is -1 outside block scalars.
+	blockIndent int
+	// flowDepth is the nesting level of the flow collections (e.g. "[a, b]").
+	flowDepth int
+}
+
+func newYAMLScanner() *yamlScanner {
+	return &yamlScanner{blockIndent: -1}
+}
+
+// replaceFunc returns the text to replace the reference.  The indent is the indentation of the line.
+type replaceFunc func(style scalarStyle, indent string, ref string) (string, error)
+
+// scanLine calls the fn for each reference in the line, and returns the line that the references are replaced.
+// The references in comments are not replaced.
+func (sc *yamlScanner) scanLine(line string, fn replaceFunc) (string, error) {
+	body := strings.TrimRight(line, "\r\n")
+	eol := line[len(body):]
+	indent := body[:len(body)-len(strings.TrimLeft(body, " "))]
+
+	if sc.blockIndent >= 0 {
+		if strings.TrimSpace(body) == "" || len(indent) > sc.blockIndent {
+			// Contents of the block scalar.
+			out, err := replaceRefs(body, func(ref string) (string, error) {
+				return fn(sc.block, indent, ref)
+			})
+			return out + eol, err
+		}
+		sc.blockIndent = -1
+	}
+
+	var b strings.Builder
+	// valueStart is true if the next character starts a node.  The quotes are recognized only at the start.
+	valueStart := true
+	contentEnd := len(body)
+	for i := 0; i < len(body); {
+		if strings.HasPrefix(body[i:], "${") {
+			if loc := refPattern.FindStringIndex(body[i:]); loc != nil && loc[0] == 0 {
+				out, err := fn(sc.quote, indent, body[i:i+loc[1]])
+				if err != nil {
+					return "", err
+				}
+				b.WriteString(out)
+				i += loc[1]
+				valueStart = false
+				continue
+			}
+		}
+
+		c := body[i]
+		switch sc.quote {
+		case doubleQuotedStyle:
+			if c == '\\' && i+1 < len(body) {
+				b.WriteString(body[i : i+2])
+				i += 2
+				continue
+			}
+			if c == '"' {
+				sc.quote = plainStyle
+			}
+		case singleQuotedStyle:
+			if c == '\'' {
+				if i+1 < len(body) && body[i+1] == '\'' {
+					// Escaped quote.
+					b.WriteString("''")
+					i += 2
+					continue
+				}
+				sc.quote = plainStyle
+			}
+		default:
+			next := byte(' ')
+			if i+1 < len(body) {
+				next = body[i+1]
+			}
+			switch {
+			case c == '#' && (i == 0 || body[i-1] == ' ' || body[i-1] == '\t'):
+				// The rest of the line is a comment.
+				contentEnd = i
+				b.WriteString(body[i:])
+				i = len(body)
+				continue
+			case c == '"' && valueStart:
+				sc.quote = doubleQuotedStyle
+			case c == '\'' && valueStart:
+				sc.quote = singleQuotedStyle
+			case c == ' ' || c == '\t':
+			case (c == '-' || c == '?') && valueStart && next == ' ':
+			case (c == '[' || c == '{') && valueStart:
+				sc.flowDepth++
+			case c == ',' && sc.flowDepth > 0:
+				valueStart = true
+			case (c == ']' || c == '}') && sc.flowDepth > 0:
+				sc.flowDepth--
+			case c == ':' && (next == ' ' || next == '\t'):
+				valueStart = true
+			default:
+				valueStart = false
+			}
+		}
+		b.WriteByte(c)
+		i++
+	}
+
+	if sc.quote == plainStyle && sc.flowDepth == 0 {
+		m := blockHeaderPattern.FindStringSubmatch(strings.TrimRight(body[:contentEnd], " \t"))
+		if m != nil {
+			sc.blockIndent = len(indent)
+			sc.block = literalStyle
+			if m[2] == ">" {
+				sc.block = foldedStyle
+			}
+		}
+	}
+	return b.String() + eol, nil
+}
+
+// replaceRefs replaces all references in the s.
+func replaceRefs(s string, fn func(ref string) (string, error)) (string, error) {
+	var err error
+	out := refPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		var v string
+		v, err = fn(ref)
+		return v
+	})
+	return out, err
+}
@@ -0,0 +1,203 @@
+// Package secrets resolves references to secrets in configs.
+//
+// A string value in the config can contain the following references:
+//
+//	${env:NAME}     the environment variable of clustertestd (only the allowed names)
+//	${file:/path}   the content of the file in the secret store (or its subdirectories)
+//	${secret:name}  the secret in the secret store of clustertestd
+//
+// The references are resolved only inside clustertestd, so the values are never sent over RPC.
+package secrets
+
+import (
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// refPattern matches the reference to a secret.
+var refPattern = regexp.MustCompile(`\$\{(env|file|secret):([^}]+)\}`)
+
+// Store resolves references to secrets.
+// The zero value and nil are valid Store without the secret store.
+type Store struct {
+	// Dir is the directory of the secret store.  Each file in the directory is a secret named by the file name.
+	// If it is empty, the "secret" references are not available.
+	Dir string
+	// Envs is the names of the environment variables that the "env" references can refer.  The name ending with "*"
+	// matches all names with the prefix (e.g. "CLUSTERTEST_SECRET_*").  If it is empty, the "env" references are not
+	// available.  It prevents configs from reading the credentials of the daemon itself.
+	Envs []string
+}
+
+// Expand resolves all references in string values of the YAML document.
+// Only the references are replaced, and other parts of the document (e.g. comments, quotes and number formats) are
+// kept as is.  The resolved values are escaped for the style of the string.  If the value cannot be written in the
+// style (e.g. a multi-line value in a single-quoted string), it returns an error.  Use double-quoted strings for such
+// values.  The references in comments are not resolved.
+// The resolved values are added to the r.
+func (s *Store) Expand(data []byte, r *Redactor) ([]byte, error) {
+	if !refPattern.Match(data) {
+		return data, nil
+	}
+
+	var out strings.Builder
+	sc := newYAMLScanner()
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		line, err := sc.scanLine(line, func(style scalarStyle, indent string, ref string) (string, error) {
+			value, err := s.ExpandString(ref, r)
+			if err != nil {
+				return "", err
+			}
+			escaped, err := escapeValue(style, indent, value)
+			if err != nil {
+				return "", errors.Wrapf(err, "failed to resolve %s", ref)
+			}
+			return escaped, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		out.WriteString(line)
+	}
+	return []byte(out.String()), nil
+}
+
+// escapeValue escapes the value to write it in the scalar of the style.
+func escapeValue(style scalarStyle, indent string, value string) (string, error) {
+	multiLine := strings.ContainsAny(value, "\r\n")
+	switch style {
+	case doubleQuotedStyle:
+		q := strconv.Quote(value)
+		return q[1 : len(q)-1], nil
+	case singleQuotedStyle:
+		if multiLine {
+			return "", errors.New("multi-line value is not allowed in single-quoted string")
+		}
+		return strings.ReplaceAll(value, "'", "''"), nil
+	case literalStyle:
+		return strings.ReplaceAll(value, "\n", "\n"+indent), nil
+	case foldedStyle:
+		if multiLine {
+			return "", errors.New("multi-line value is not allowed in folded block scalar")
+		}
+		return value, nil
+	default:
+		if multiLine || !isPlainSafe(value) {
+			return "", errors.New("the value contains special characters: quote the string with double quotes")
+		}
+		return value, nil
+	}
+}
+
+// isPlainSafe returns true if the value can be written in the plain scalar without changing its meaning.
+func isPlainSafe(value string) bool {
+	if value == "" {
+		return true
+	}
+	if value != strings.TrimSpace(value) || strings.ContainsAny(value, "#,[]{}") || strings.ContainsAny(value[:1], "!&*-?|>'\"%@`") {
+		return false
+	}
+	return !strings.Contains(value, ": ") && !strings.HasSuffix(value, ":")
+}
+
+// ExpandString resolves all references in the string.
+// The resolved values are added to the r.
+func (s *Store) ExpandString(str string, r *Redactor) (string, error) {
+	return replaceRefs(str, func(ref string) (string, error) {
+		m := refPattern.FindStringSubmatch(ref)
+		value, err := s.Lookup(m[1], m[2])
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to resolve %s", ref)
+		}
+		r.Add(value)
+		return value, nil
+	})
+}
+
+// Lookup returns the value of the secret.  The kind is one of "env", "file" or "secret".
+func (s *Store) Lookup(kind, name string) (string, error) {
+	switch kind {
+	case "env":
+		if !s.allowEnv(name) {
+			return "", errors.Errorf("environment variable is not allowed: %s", name)
+		}
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", errors.Errorf("environment variable is not set: %s", name)
+		}
+		return v, nil
+	case "file":
+		if s == nil || s.Dir == "" {
+			return "", errors.New("secret store is not configured")
+		}
+		path, err := s.filePath(name)
+		if err != nil {
+			return "", err
+		}
+		return readSecretFile(path)
+	case "secret":
+		if s == nil || s.Dir == "" {
+			return "", errors.New("secret store is not configured")
+		}
+		if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+			return "", errors.Errorf("invalid secret name: %s", name)
+		}
+		return readSecretFile(filepath.Join(s.Dir, name))
+	default:
+		return "", errors.Errorf("unsupported secret kind: %s", kind)
+	}
+}
+
+// allowEnv returns true if the "env" references can refer the environment variable.
+func (s *Store) allowEnv(name string) bool {
+	if s == nil {
+		return false
+	}
+	for _, pattern := range s.Envs {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// filePath resolves the path of the "file" reference.  The relative path is relative to the Dir.
+// The file must be in the Dir to prevent configs from reading arbitrary files on the daemon host.
+func (s *Store) filePath(name string) (string, error) {
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.Dir, path)
+	}
+	// Resolve the symlinks to check the real location.
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	dir, err := filepath.EvalSymlinks(s.Dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.Errorf("file is outside the secret store: %s", name)
+	}
+	return path, nil
+}
+
+// readSecretFile reads the file without the trailing newline.
+func readSecretFile(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
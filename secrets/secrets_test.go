@@ -0,0 +1,172 @@
+package secrets
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/yaml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore_Expand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clustertest-secrets-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "vm-password"), []byte("s3cret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("CLUSTERTEST_TEST_PASSWORD", `p@ss: "word"`)
+	defer os.Unsetenv("CLUSTERTEST_TEST_PASSWORD")
+
+	t.Run("should_resolve_references", func(t *testing.T) {
+		s := &Store{Dir: dir, Envs: []string{"CLUSTERTEST_TEST_*"}}
+		r := &Redactor{}
+		b, err := s.Expand([]byte(`
+name: test
+account:
+  password: '${env:CLUSTERTEST_TEST_PASSWORD}'
+users:
+  - password: '${secret:vm-password}'
+  - password: 'x-${file:`+filepath.Join(dir, "vm-password")+`}'
+`), r)
+		if !assert.NoError(t, err) {
+			return
+		}
+		var conf struct {
+			Account struct{ Password string }
+			Users   []struct{ Password string }
+		}
+		if !assert.NoError(t, yaml.Unmarshal(b, &conf)) {
+			return
+		}
+		assert.Equal(t, `p@ss: "word"`, conf.Account.Password)
+		assert.Equal(t, "s3cret", conf.Users[0].Password)
+		assert.Equal(t, "x-s3cret", conf.Users[1].Password)
+		assert.Equal(t, "pw=********", r.RedactString("pw=s3cret"))
+	})
+
+	t.Run("should_keep_other_parts_of_config", func(t *testing.T) {
+		s := &Store{Dir: dir}
+		b, err := s.Expand([]byte(`# comment ${secret:undefined}
+mode: 0755
+version: "1.10"
+password: ${secret:vm-password}  # comment
+`), &Redactor{})
+		assert.NoError(t, err)
+		assert.Equal(t, `# comment ${secret:undefined}
+mode: 0755
+version: "1.10"
+password: s3cret  # comment
+`, string(b))
+	})
+
+	t.Run("should_escape_values_for_style", func(t *testing.T) {
+		os.Setenv("CLUSTERTEST_TEST_KEY", "line1\n'line2'\n")
+		defer os.Unsetenv("CLUSTERTEST_TEST_KEY")
+
+		s := &Store{Dir: dir, Envs: []string{"CLUSTERTEST_TEST_KEY", "CLUSTERTEST_TEST_PASSWORD"}}
+		b, err := s.Expand([]byte(`
+double: "${env:CLUSTERTEST_TEST_KEY}"
+single: '${env:CLUSTERTEST_TEST_PASSWORD}'
+literal: |
+  ${env:CLUSTERTEST_TEST_KEY}
+flow: [a, '${env:CLUSTERTEST_TEST_PASSWORD}']
+`), &Redactor{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		var conf struct {
+			Double  string
+			Single  string
+			Literal string
+			Flow    []string
+		}
+		if !assert.NoError(t, yaml.Unmarshal(b, &conf)) {
+			return
+		}
+		assert.Equal(t, "line1\n'line2'\n", conf.Double)
+		assert.Equal(t, `p@ss: "word"`, conf.Single)
+		// The trailing newlines are clipped.
+		assert.Equal(t, "line1\n'line2'\n", conf.Literal)
+		assert.Equal(t, []string{"a", `p@ss: "word"`}, conf.Flow)
+
+		// The value cannot be written without quotes.
+		_, err = s.Expand([]byte("password: ${env:CLUSTERTEST_TEST_PASSWORD}\n"), &Redactor{})
+		assert.Error(t, err)
+		_, err = s.Expand([]byte("key: '${env:CLUSTERTEST_TEST_KEY}'\n"), &Redactor{})
+		assert.Error(t, err)
+	})
+
+	t.Run("should_not_change_config_without_references", func(t *testing.T) {
+		data := []byte("name: test\n# comment\n")
+		b, err := (*Store)(nil).Expand(data, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, data, b)
+	})
+
+	t.Run("should_fail_when_secret_is_not_found", func(t *testing.T) {
+		_, err := (&Store{Envs: []string{"CLUSTERTEST_TEST_*"}}).ExpandString("${env:CLUSTERTEST_TEST_UNDEFINED}", nil)
+		assert.EqualError(t, err, "failed to resolve ${env:CLUSTERTEST_TEST_UNDEFINED}: environment variable is not set: CLUSTERTEST_TEST_UNDEFINED")
+		_, err = (&Store{}).ExpandString("${secret:vm-password}", nil)
+		assert.EqualError(t, err, "failed to resolve ${secret:vm-password}: secret store is not configured")
+		_, err = (&Store{Dir: dir}).ExpandString("${secret:../vm-password}", nil)
+		assert.EqualError(t, err, "failed to resolve ${secret:../vm-password}: invalid secret name: ../vm-password")
+	})
+
+	t.Run("should_not_read_disallowed_environment_variables", func(t *testing.T) {
+		s := &Store{Envs: []string{"CLUSTERTEST_TEST_PASS*", "CLUSTERTEST_TEST_KEY"}}
+		v, err := s.ExpandString("${env:CLUSTERTEST_TEST_PASSWORD}", &Redactor{})
+		assert.NoError(t, err)
+		assert.Equal(t, `p@ss: "word"`, v)
+
+		os.Setenv("CLUSTERTEST_TEST_TOKEN", "token")
+		defer os.Unsetenv("CLUSTERTEST_TEST_TOKEN")
+		_, err = s.ExpandString("${env:CLUSTERTEST_TEST_TOKEN}", nil)
+		assert.EqualError(t, err, "failed to resolve ${env:CLUSTERTEST_TEST_TOKEN}: environment variable is not allowed: CLUSTERTEST_TEST_TOKEN")
+		_, err = (&Store{}).ExpandString("${env:CLUSTERTEST_TEST_PASSWORD}", nil)
+		assert.EqualError(t, err, "failed to resolve ${env:CLUSTERTEST_TEST_PASSWORD}: environment variable is not allowed: CLUSTERTEST_TEST_PASSWORD")
+	})
+
+	t.Run("should_not_read_files_outside_secret_store", func(t *testing.T) {
+		outside, err := ioutil.TempDir("", "clustertest-outside-")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer os.RemoveAll(outside)
+		ioutil.WriteFile(filepath.Join(outside, "password"), []byte("s3cret"), 0600)
+		os.Symlink(filepath.Join(outside, "password"), filepath.Join(dir, "link"))
+
+		s := &Store{Dir: dir}
+		v, err := s.ExpandString("${file:vm-password}", &Redactor{})
+		assert.NoError(t, err)
+		assert.Equal(t, "s3cret", v)
+		for _, name := range []string{filepath.Join(outside, "password"), "../" + filepath.Base(outside) + "/password", "link"} {
+			_, err := s.ExpandString("${file:"+name+"}", &Redactor{})
+			if assert.Error(t, err, name) {
+				assert.Contains(t, err.Error(), "file is outside the secret store", name)
+			}
+		}
+		_, err = (&Store{}).ExpandString("${file:"+filepath.Join(dir, "vm-password")+"}", nil)
+		assert.EqualError(t, err, "failed to resolve ${file:"+filepath.Join(dir, "vm-password")+"}: secret store is not configured")
+	})
+}
+
+func TestRedactor(t *testing.T) {
+	t.Run("should_redact_written_data", func(t *testing.T) {
+		r := &Redactor{}
+		r.Add("abc")
+		r.Add("abcdef")
+		r.Add("line1\nline2")
+
+		var buf bytes.Buffer
+		w := r.Writer(&buf)
+		w.Write([]byte("abcdef abc\n"))
+		w.Write([]byte("line2\n"))
+		assert.Equal(t, "******** ********\n********\n", buf.String())
+	})
+}
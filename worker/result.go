@@ -3,21 +3,26 @@ package worker
 import (
 	"errors"
 	"github.com/yuuki0xff/clustertest/models"
+	"github.com/yuuki0xff/clustertest/secrets"
 	"time"
 )
 
 type Result struct {
 	ErrorMsg string
-	Before   *ScriptResult
-	Main     *ScriptResult
-	After    *ScriptResult
+	// TeardownErrorMsg is an error message that occurred while deleting resources.
+	TeardownErrorMsg string
+	Before           *ScriptResult
+	Main             *ScriptResult
+	After            *ScriptResult
 }
 type ScriptResult struct {
-	Start    time.Time
-	End      time.Time
-	Hostname string
-	Out      []byte
-	Exit     int
+	NameStr      string
+	Start        time.Time
+	End          time.Time
+	Hostname     string
+	Out          []byte
+	Exit         int
+	ChildResults []*ScriptResult `json:",omitempty"`
 }
 
 func (r *Result) String() string {
@@ -29,6 +34,12 @@ func (r *Result) Error() error {
 	}
 	return errors.New(r.ErrorMsg)
 }
+func (r *Result) TeardownError() error {
+	if r.TeardownErrorMsg == "" {
+		return nil
+	}
+	return errors.New(r.TeardownErrorMsg)
+}
 func (r *Result) BeforeResult() models.ScriptResult {
 	if r.Before == nil {
 		return nil
@@ -48,20 +59,51 @@ func (r *Result) AfterResult() models.ScriptResult {
 	return r.After
 }
 
+// redact removes the secret values from the result.
+func (r *Result) redact(rd *secrets.Redactor) {
+	r.ErrorMsg = rd.RedactString(r.ErrorMsg)
+	r.TeardownErrorMsg = rd.RedactString(r.TeardownErrorMsg)
+	for _, sr := range []*ScriptResult{r.Before, r.Main, r.After} {
+		sr.redact(rd)
+	}
+}
+
 func NewScriptResult(result models.ScriptResult) *ScriptResult {
-	return &ScriptResult{
+	sr := &ScriptResult{
+		NameStr:  result.Name(),
 		Start:    result.StartTime(),
 		End:      result.EndTime(),
 		Hostname: result.Host(),
 		Out:      result.Output(),
 		Exit:     result.ExitCode(),
 	}
+	for _, c := range result.Children() {
+		sr.ChildResults = append(sr.ChildResults, NewScriptResult(c))
+	}
+	return sr
+}
+func (sr *ScriptResult) redact(rd *secrets.Redactor) {
+	if sr == nil {
+		return
+	}
+	sr.Out = rd.Redact(sr.Out)
+	for _, c := range sr.ChildResults {
+		c.redact(rd)
+	}
 }
 func (sr *ScriptResult) String() string {
 	return "<ScriptResult>"
 }
+func (sr *ScriptResult) Name() string         { return sr.NameStr }
 func (sr *ScriptResult) StartTime() time.Time { return sr.Start }
 func (sr *ScriptResult) EndTime() time.Time   { return sr.End }
 func (sr *ScriptResult) Host() string         { return sr.Hostname }
 func (sr *ScriptResult) Output() []byte       { return sr.Out }
 func (sr *ScriptResult) ExitCode() int        { return sr.Exit }
+func (sr *ScriptResult) Children() []models.ScriptResult {
+	var rs []models.ScriptResult
+	for _, c := range sr.ChildResults {
+		rs = append(rs, c)
+	}
+	return rs
+}
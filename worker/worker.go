@@ -10,33 +10,41 @@ import (
 	"github.com/yuuki0xff/clustertest/executors"
 	"github.com/yuuki0xff/clustertest/models"
 	"github.com/yuuki0xff/clustertest/provisioners"
+	"github.com/yuuki0xff/clustertest/secrets"
+	"strings"
 	"time"
 )
 
+// ArtifactTimeout is the timeout for collecting artifacts from all hosts.
+const ArtifactTimeout = 10 * time.Minute
+
 type Worker struct {
 	Queue models.TaskQueue
+	// Secrets resolves references to secrets in the spec.
+	Secrets *secrets.Store
 }
 
 func (w *Worker) Serve(ctx context.Context) error {
-	ticker := time.NewTicker(time.Second)
-
 	for {
+		// Get the channel before consuming to avoid missing tasks submitted while consuming.
+		changed := w.Queue.Changed()
+		err := w.Queue.Consume(w.runTask)
+		if err == nil {
+			continue
+		}
+		if err != models.QueueEmpty {
+			return err
+		}
+
+		// Wait for new tasks.
 		select {
 		case <-ctx.Done():
-			return errors.Errorf("context canceled")
-
-		case <-ticker.C:
-			err := w.Queue.Consume(w.runTask)
-			if err != nil {
-				if err == models.QueueEmpty {
-					continue
-				}
-				return err
-			}
+			return ctx.Err()
+		case <-changed:
 		}
 	}
 }
-func (w *Worker) runTask(id models.TaskID, task models.Task) (models.TaskResult, error) {
+func (w *Worker) runTask(ctx context.Context, id models.TaskID, task models.Task, h models.TaskHandle) (models.TaskResult, error) {
 	result := &Result{}
 	fmt.Println("running", id, result)
 	defer func() {
@@ -44,12 +52,27 @@ func (w *Worker) runTask(id models.TaskID, task models.Task) (models.TaskResult,
 		fmt.Println("finished", id, string(js))
 	}()
 
-	data := task.SpecData()
+	// Resolve secrets and remove them from the output and the result.
+	redactor := &secrets.Redactor{}
+	defer result.redact(redactor)
+	data, err := w.Secrets.Expand(task.SpecData(), redactor)
+	if err != nil {
+		result.ErrorMsg = fmt.Sprintf("failed to load spec: %s", err)
+		return result, nil
+	}
 	conf, err := config.LoadFromBytes(data)
 	if err != nil {
 		result.ErrorMsg = fmt.Sprintf("failed to load spec: %s", err)
 		return result, nil
 	}
+	// Executors stream the output of scripts to the task.
+	out := redactor.Writer(h.Output())
+	ctx = models.WithOutputWriter(ctx, out)
+	ctx = models.WithLocalFiles(ctx, conf.LocalFiles)
+	holdOnFailure := task.Options().HoldOnFailure
+	if holdOnFailure == 0 {
+		holdOnFailure = conf.HoldOnFailure
+	}
 
 	// Create provisioners.
 	var pros []models.Provisioner
@@ -61,11 +84,24 @@ func (w *Worker) runTask(id models.TaskID, task models.Task) (models.TaskResult,
 		}
 		pros = append(pros, pro)
 	}
+	// Delete resources when the task is finished, failed or canceled.
+	// Provisioners must be able to delete the partially reserved/created resources.
+	created := false
+	defer func() {
+		h.SetPhase(models.DeletingTaskState)
+		if created {
+			w.collectArtifacts(h, pros)
+		}
+		if err := w.deleteAll(pros); err != nil {
+			result.TeardownErrorMsg = err.Error()
+		}
+	}()
 
 	// Reserve resources.
+	h.SetPhase(models.ReservingTaskState)
 	ec := make(chan error, len(pros))
 	co.ParForAll(pros, func(i int) {
-		err := pros[i].Reserve()
+		err := pros[i].Reserve(ctx)
 		if err != nil {
 			ec <- err
 		}
@@ -77,9 +113,10 @@ func (w *Worker) runTask(id models.TaskID, task models.Task) (models.TaskResult,
 	}
 
 	// Create resources.
+	h.SetPhase(models.CreatingTaskState)
 	ec = make(chan error, len(pros))
 	co.ParForAll(pros, func(i int) {
-		err := pros[i].Create()
+		err := pros[i].Create(ctx)
 		if err != nil {
 			ec <- err
 		}
@@ -89,78 +126,152 @@ func (w *Worker) runTask(id models.TaskID, task models.Task) (models.TaskResult,
 		result.ErrorMsg = err.Error()
 		return result, nil
 	}
+	created = true
+	if ctx.Err() != nil {
+		result.ErrorMsg = "canceled"
+		return result, nil
+	}
 
 	// Run the "before" script.
-	before := executors.MergedResult{}
+	before := executors.MergedResult{NameStr: "before"}
 	rc := make(chan models.ScriptResult, len(pros))
+	h.SetPhase(models.BeforeTaskState)
+	fmt.Fprintf(out, "-------------------- Before --------------------\n")
 	co.ParForAll(pros, func(i int) {
 		pro := pros[i]
 		sets := pro.ScriptSets()
-		rc <- executors.ExecuteBefore(pro, sets)
+		rc <- executors.ExecuteBefore(ctx, pro, sets)
 	})
 	close(rc)
 	for r := range rc {
 		before.Append(r)
-		if r.ExitCode() != 0 {
-			result.ErrorMsg = fmt.Sprintf("failed the \"before\" task: exitcode=%d", r.ExitCode())
-			result.Before = NewScriptResult(&before)
-			return result, nil
-		}
 	}
 	result.Before = NewScriptResult(&before)
+	if ctx.Err() != nil {
+		result.ErrorMsg = "canceled"
+		return result, nil
+	}
+	if before.ExitCode() != 0 {
+		result.ErrorMsg = fmt.Sprintf("failed the \"before\" task: exitcode=%d", before.ExitCode())
+		w.hold(ctx, h, holdOnFailure, "before", pros)
+		return result, nil
+	}
 
 	// Run the "main" script.
-	main := executors.MergedResult{}
+	main := executors.MergedResult{NameStr: "main"}
 	rc = make(chan models.ScriptResult, len(pros))
+	h.SetPhase(models.MainTaskState)
+	fmt.Fprintf(out, "-------------------- Main --------------------\n")
 	co.ParForAll(pros, func(i int) {
 		pro := pros[i]
 		sets := pro.ScriptSets()
-		rc <- executors.ExecuteMain(pro, sets)
+		rc <- executors.ExecuteMain(ctx, pro, sets)
 	})
 	close(rc)
 	for r := range rc {
 		main.Append(r)
-		if r.ExitCode() != 0 {
-			result.ErrorMsg = fmt.Sprintf("failed the \"main\" task: exitcode=%d", r.ExitCode())
-			result.Main = NewScriptResult(&main)
-			return result, nil
-		}
 	}
 	result.Main = NewScriptResult(&main)
+	if ctx.Err() != nil {
+		result.ErrorMsg = "canceled"
+		return result, nil
+	}
+	if main.ExitCode() != 0 {
+		result.ErrorMsg = fmt.Sprintf("failed the \"main\" task: exitcode=%d", main.ExitCode())
+		w.hold(ctx, h, holdOnFailure, "main", pros)
+		return result, nil
+	}
 
 	// Run the "after" script.
-	after := executors.MergedResult{}
+	after := executors.MergedResult{NameStr: "after"}
 	rc = make(chan models.ScriptResult, len(pros))
+	h.SetPhase(models.AfterTaskState)
+	fmt.Fprintf(out, "-------------------- After --------------------\n")
 	co.ParForAll(pros, func(i int) {
 		pro := pros[i]
 		sets := pro.ScriptSets()
-		rc <- executors.ExecuteAfter(pro, sets)
+		rc <- executors.ExecuteAfter(ctx, pro, sets)
 	})
 	close(rc)
 	for r := range rc {
 		after.Append(r)
-		if r.ExitCode() != 0 {
-			result.ErrorMsg = fmt.Sprintf("failed the \"after\" task: exitcode=%d", r.ExitCode())
-			result.After = NewScriptResult(&after)
-			return result, nil
-		}
 	}
 	result.After = NewScriptResult(&after)
+	if ctx.Err() != nil {
+		result.ErrorMsg = "canceled"
+		return result, nil
+	}
+	if after.ExitCode() != 0 {
+		result.ErrorMsg = fmt.Sprintf("failed the \"after\" task: exitcode=%d", after.ExitCode())
+		w.hold(ctx, h, holdOnFailure, "after", pros)
+		return result, nil
+	}
 
-	// Delete resources.
-	ec = make(chan error, len(pros))
+	return result, nil
+}
+
+// hold keeps the infrastructure for debugging until the hold is released or expired.
+// If the d is not positive, it returns immediately.
+func (w *Worker) hold(ctx context.Context, h models.TaskHandle, d time.Duration, phase string, pros []models.Provisioner) {
+	if d <= 0 {
+		return
+	}
+
+	info := models.HoldInfo{
+		Phase: phase,
+		Until: time.Now().Add(d),
+		Hosts: map[string][]string{},
+	}
+	for _, pro := range pros {
+		conf := pro.Config()
+		if conf == nil {
+			continue
+		}
+		for group, hosts := range conf.Hosts() {
+			info.Hosts[group] = append(info.Hosts[group], hosts...)
+		}
+	}
+	h.Hold(ctx, info)
+}
+
+// collectArtifacts fetches artifacts from hosts and saves them to the task.
+// The errors are written to the output of the task because the artifacts are not essential for the result.
+func (w *Worker) collectArtifacts(h models.TaskHandle, pros []models.Provisioner) {
+	// Should collect artifacts even if the task was canceled.
+	ctx, cancel := context.WithTimeout(context.Background(), ArtifactTimeout)
+	defer cancel()
+
+	for _, pro := range pros {
+		c, ok := pro.(models.ArtifactCollector)
+		if !ok {
+			continue
+		}
+		err := c.CollectArtifacts(ctx, h.SaveArtifact)
+		if err != nil {
+			fmt.Fprintf(h.Output(), "failed to collect artifacts: %s\n", err)
+		}
+	}
+}
+
+// deleteAll deletes resources of all provisioners in parallel.
+// It returns an error that contains all errors returned by provisioners.
+func (w *Worker) deleteAll(pros []models.Provisioner) error {
+	ec := make(chan error, len(pros))
 	co.ParForAll(pros, func(i int) {
 		pro := pros[i]
 		err := pro.Delete()
 		if err != nil {
-			ec <- err
+			ec <- errors.Wrapf(err, "failed to delete %s", pro.Spec())
 		}
 	})
 	close(ec)
-	if err = <-ec; err != nil {
-		result.ErrorMsg = err.Error()
-		return result, nil
-	}
 
-	return result, nil
+	var msgs []string
+	for err := range ec {
+		msgs = append(msgs, err.Error())
+	}
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
 }
@@ -0,0 +1,269 @@
+package worker
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/clustertest/config"
+	"github.com/yuuki0xff/clustertest/databases"
+	"github.com/yuuki0xff/clustertest/models"
+	_ "github.com/yuuki0xff/clustertest/provisioners/fake"
+	_ "github.com/yuuki0xff/clustertest/scripts/localshell"
+	_ "github.com/yuuki0xff/clustertest/scripts/remoteshell"
+	_ "github.com/yuuki0xff/clustertest/scripts/upload"
+	"github.com/yuuki0xff/clustertest/secrets"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeSpec returns a config that has a fake spec.
+// The spec is appended to the fields of the fake spec.
+func fakeSpec(spec string) []byte {
+	return []byte(`
+version: 1
+name: worker-test
+specs:
+  - type: fake
+    name: test
+` + spec)
+}
+
+// runTask runs the task with the spec and returns the detail of the finished task.
+// The fn is called while the task is running.
+func runTask(t *testing.T, spec []byte, fn func(db *databases.MemTaskDB, id models.TaskID)) (models.TaskDetail, []byte) {
+	db := databases.NewMemTaskDB()
+	w := &Worker{Queue: db, Secrets: &secrets.Store{Envs: []string{"CLUSTERTEST_TEST_*"}}}
+	id, err := db.Create(&databases.MemTask{Spec: spec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fn != nil {
+		go fn(db, id)
+	}
+	err = db.Consume(w.runTask)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := db.Inspect(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, err := db.Logs(id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, logs
+}
+
+func TestWorker_runTask(t *testing.T) {
+	t.Run("should_run_all_phases_on_all_vms", func(t *testing.T) {
+		d, logs := runTask(t, fakeSpec(`
+    vms:
+      web:
+        nodes: 2
+        scripts:
+          before:
+            type: local-shell
+            commands:
+              - echo before $CLUSTERTEST_GROUP $CLUSTERTEST_INDEX
+          main:
+            type: remote-shell
+            commands:
+              - echo main $CLUSTERTEST_HOST
+          after:
+            type: local-shell
+            commands:
+              - echo after
+`), nil)
+		assert.Equal(t, models.SucceededTaskState, d.State())
+		r := d.Result()
+		if !assert.NotNil(t, r) {
+			return
+		}
+		assert.NoError(t, r.Error())
+		assert.NoError(t, r.TeardownError())
+		assert.Equal(t, 0, r.BeforeResult().ExitCode())
+		assert.Equal(t, 0, r.ScriptResult().ExitCode())
+		assert.Equal(t, 0, r.AfterResult().ExitCode())
+		assert.Contains(t, string(logs), "[web-0] before web 0\n")
+		assert.Contains(t, string(logs), "[web-1] before web 1\n")
+		assert.Contains(t, string(logs), "[web-0] main web-0\n")
+		assert.Contains(t, string(logs), "[web-1] after\n")
+	})
+
+	t.Run("should_stop_when_script_failed", func(t *testing.T) {
+		d, _ := runTask(t, fakeSpec(`
+    vms:
+      web:
+        nodes: 1
+        scripts:
+          main:
+            type: local-shell
+            commands:
+              - exit 3
+          after:
+            type: local-shell
+            commands:
+              - echo after
+`), nil)
+		r := d.Result()
+		if !assert.NotNil(t, r) {
+			return
+		}
+		assert.Equal(t, models.FailedTaskState, d.State())
+		assert.EqualError(t, r.Error(), `failed the "main" task: exitcode=3`)
+		assert.Equal(t, 3, r.ScriptResult().ExitCode())
+		assert.Nil(t, r.AfterResult())
+		assert.NoError(t, r.TeardownError())
+	})
+
+	t.Run("should_fail_when_reserve_failed", func(t *testing.T) {
+		d, _ := runTask(t, fakeSpec(`
+    failures:
+      reserve: true
+    vms:
+      web:
+        nodes: 1
+`), nil)
+		r := d.Result()
+		if !assert.NotNil(t, r) {
+			return
+		}
+		assert.Equal(t, models.ErroredTaskState, d.State())
+		assert.EqualError(t, r.Error(), "injected failure: reserve")
+		assert.Nil(t, r.BeforeResult())
+		assert.NoError(t, r.TeardownError())
+	})
+
+	t.Run("should_delete_when_create_failed", func(t *testing.T) {
+		d, _ := runTask(t, fakeSpec(`
+    failures:
+      create: true
+      delete: true
+    vms:
+      web:
+        nodes: 1
+`), nil)
+		r := d.Result()
+		if !assert.NotNil(t, r) {
+			return
+		}
+		assert.EqualError(t, r.Error(), "injected failure: create")
+		assert.Error(t, r.TeardownError())
+		assert.Contains(t, r.TeardownError().Error(), "injected failure: delete")
+	})
+
+	t.Run("should_cancel_running_task", func(t *testing.T) {
+		start := time.Now()
+		d, _ := runTask(t, fakeSpec(`
+    delays:
+      create: 100ms
+    vms:
+      web:
+        nodes: 1
+        scripts:
+          main:
+            type: local-shell
+            commands:
+              - sleep 10
+`), func(db *databases.MemTaskDB, id models.TaskID) {
+			time.Sleep(500 * time.Millisecond)
+			assert.NoError(t, db.Cancel(id))
+		})
+		assert.Equal(t, models.CanceledTaskState, d.State())
+		assert.True(t, time.Since(start) < 5*time.Second)
+		if r := d.Result(); assert.NotNil(t, r) {
+			assert.EqualError(t, r.Error(), "canceled")
+		}
+	})
+
+	t.Run("should_upload_attached_local_files", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "clustertest-worker-")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer os.RemoveAll(dir)
+		ioutil.WriteFile(filepath.Join(dir, "server"), []byte("build"), 0755)
+		dest := filepath.Join(dir, "dest", "server")
+
+		spec, err := config.AttachLocalFiles(fakeSpec(`
+    vms:
+      web:
+        nodes: 1
+        scripts:
+          before:
+            type: upload
+            files:
+              - src: server
+                dest: `+dest+`
+          main:
+            type: local-shell
+            commands:
+              - "true"
+`), dir)
+		if !assert.NoError(t, err) {
+			return
+		}
+		// The daemon does not read the file.
+		os.Remove(filepath.Join(dir, "server"))
+
+		d, logs := runTask(t, spec, nil)
+		if !assert.Equal(t, models.SucceededTaskState, d.State()) {
+			t.Log(string(logs))
+			return
+		}
+		b, err := ioutil.ReadFile(dest)
+		assert.NoError(t, err)
+		assert.Equal(t, "build", string(b))
+	})
+
+	t.Run("should_redact_resolved_secrets", func(t *testing.T) {
+		os.Setenv("CLUSTERTEST_TEST_SECRET", "s3cret")
+		defer os.Unsetenv("CLUSTERTEST_TEST_SECRET")
+		d, logs := runTask(t, fakeSpec(`
+    vms:
+      web:
+        nodes: 1
+        scripts:
+          main:
+            type: local-shell
+            commands:
+              - echo '${env:CLUSTERTEST_TEST_SECRET}'
+`), nil)
+		assert.Equal(t, models.SucceededTaskState, d.State())
+		assert.Contains(t, string(logs), "[web-0] ********\n")
+		assert.NotContains(t, string(logs), "s3cret")
+		if r := d.Result(); assert.NotNil(t, r) {
+			assert.NotContains(t, string(r.ScriptResult().Output()), "s3cret")
+		}
+	})
+}
+
+func TestWorker_Serve(t *testing.T) {
+	t.Run("should_run_submitted_task_immediately", func(t *testing.T) {
+		db := databases.NewMemTaskDB()
+		w := &Worker{Queue: db}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go w.Serve(ctx)
+
+		// Wait for the worker to become idle.
+		time.Sleep(100 * time.Millisecond)
+		start := time.Now()
+		id, err := db.Create(&databases.MemTask{Spec: fakeSpec(`
+    vms:
+      web:
+        nodes: 1
+`)})
+		if !assert.NoError(t, err) {
+			return
+		}
+		waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+		defer waitCancel()
+		assert.NoError(t, db.Wait(id, waitCtx))
+		assert.True(t, time.Since(start) < 500*time.Millisecond)
+	})
+}